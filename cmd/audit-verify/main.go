@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+)
+
+// audit-verify checks an exported audit log for gaps and altered entries.
+// Input is JSON lines (the file sink) or concatenated JSON objects (an S3 export).
+// Given the chain head (-head-file for the file sink, -table for DynamoDB),
+// entries deleted from the end of the chain are reported too.
+//
+//	audit-verify [-key KEY] [-head-file audit.jsonl.head | -table TABLE] audit.jsonl [more.jsonl ...]
+func main() {
+	key := flag.String("key", os.Getenv("AUDIT_HMAC_KEY"), "HMAC key for checkpoint signatures (default $AUDIT_HMAC_KEY)")
+	headFile := flag.String("head-file", "", "chain head file written next to AUDIT_FILE")
+	table := flag.String("table", "", "DynamoDB audit table holding the chain head")
+	flag.Parse()
+
+	var entries []audit.Entry
+	if flag.NArg() == 0 {
+		read, err := readEntries(os.Stdin)
+		if err != nil {
+			fail("stdin: %v", err)
+		}
+		entries = read
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fail("%v", err)
+		}
+		read, err := readEntries(f)
+		f.Close()
+		if err != nil {
+			fail("%s: %v", path, err)
+		}
+		entries = append(entries, read...)
+	}
+
+	if len(entries) == 0 {
+		fail("no audit entries found")
+	}
+
+	head, err := loadHead(*headFile, *table)
+	if err != nil {
+		fail("%v", err)
+	}
+	problems := audit.Verify(entries, []byte(*key), head)
+
+	checkpoints := 0
+	for _, e := range entries {
+		if e.EventType == audit.EventCheckpoint {
+			checkpoints++
+		}
+	}
+	fmt.Printf("Verified %d entries (%d checkpoints)\n", len(entries), checkpoints)
+	if *key == "" {
+		fmt.Println("No HMAC key given, checkpoint signatures were not checked")
+	}
+	if head == nil {
+		last := audit.LastCheckpoint(entries)
+		fmt.Printf("No chain head given, entries deleted after the last checkpoint (seq %d) can't be detected\n", last)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("OK: chain is intact")
+		return
+	}
+
+	fmt.Printf("FAILED: %d problem(s)\n", len(problems))
+	for _, p := range problems {
+		fmt.Printf("  %s\n", p)
+	}
+	os.Exit(1)
+}
+
+// loadHead reads the chain head, or returns nil when none was asked for
+func loadHead(headFile, table string) (*audit.Head, error) {
+	var store audit.HeadStore
+	switch {
+	case headFile != "":
+		if _, err := os.Stat(headFile); err != nil {
+			return nil, err
+		}
+		store = audit.NewFileHeadStore(headFile)
+	case table != "":
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		store = audit.NewDynamoDBHeadStore(dynamodb.NewFromConfig(awsCfg), table)
+	default:
+		return nil, nil
+	}
+
+	head, err := store.Load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chain head: %w", err)
+	}
+	return &head, nil
+}
+
+func readEntries(r io.Reader) ([]audit.Entry, error) {
+	dec := json.NewDecoder(r)
+	// Keep numbers as written so re-hashing reproduces the original bytes
+	dec.UseNumber()
+
+	var entries []audit.Entry
+	for {
+		var e audit.Entry
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "audit-verify: "+format+"\n", args...)
+	os.Exit(2)
+}
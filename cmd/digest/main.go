@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/digest"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// DigestEvent is the input set on the EventBridge schedule
+type DigestEvent struct {
+	Period string `json:"period"`
+}
+
+var (
+	cfg         *config.Config
+	slack       *slackClient.Client
+	auditLogger *audit.Logger
+)
+
+func init() {
+	cfg = config.Load()
+	slack = slackClient.New(cfg)
+
+	var err error
+	auditLogger, err = audit.New(cfg, slack)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create audit logger: %v", err))
+	}
+}
+
+// handler runs on the EventBridge schedule
+func handler(ctx context.Context, event DigestEvent) error {
+	period := digest.Period(event.Period)
+	if period == "" {
+		period = digest.Daily
+	}
+	return run(ctx, period, time.Now(), false)
+}
+
+// run builds the digest for the period and posts it to the audit channel,
+// or prints it when dryRun is set
+func run(ctx context.Context, period digest.Period, now time.Time, dryRun bool) error {
+	report, err := digest.Build(ctx, auditLogger, period, now)
+	if errors.Is(err, audit.ErrNotQueryable) {
+		// S3 and the channel sink are write-only, so retrying won't help
+		fmt.Printf("Skipping %s digest: the audit log can't be read back, set AUDIT_DYNAMODB_TABLE or AUDIT_FILE\n", period)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Print(report.Text())
+		return nil
+	}
+
+	channel := cfg.Permissions.AuditChannel
+	if channel == "" {
+		return fmt.Errorf("no audit channel configured, set auditChannel in PERMISSIONS_JSON")
+	}
+	if _, err := slack.PostBlocksToChannel(channel, "", report.Title(), report.Blocks()...); err != nil {
+		return fmt.Errorf("failed to post digest: %w", err)
+	}
+	fmt.Printf("Posted %s digest to %s\n", period, channel)
+	return nil
+}
+
+// digest posts a summary of bot activity from the audit store. It runs on a
+// schedule in Lambda, or by hand:
+//
+//	digest [-period daily|weekly] [-at 2006-01-02] [-dry-run]
+func main() {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(handler)
+		return
+	}
+
+	period := flag.String("period", string(digest.Daily), "daily or weekly")
+	at := flag.String("at", "", "report the period before this date (YYYY-MM-DD, default today)")
+	dryRun := flag.Bool("dry-run", false, "print the digest instead of posting it")
+	flag.Parse()
+
+	now := time.Now()
+	if *at != "" {
+		t, err := time.Parse("2006-01-02", *at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "digest: invalid -at date %q\n", *at)
+			os.Exit(2)
+		}
+		now = t
+	}
+
+	if err := run(context.Background(), digest.Period(*period), now, *dryRun); err != nil {
+		fmt.Fprintf(os.Stderr, "digest: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
+)
+
+// dlq inspects the processing dead-letter queue. Replayed messages keep
+// their ID, so the processor's idempotency checks stop any write an earlier
+// attempt already ran.
+//
+//	dlq [-dlq URL] [-queue URL] list
+//	dlq [-dlq URL] [-queue URL] replay [-all] ID...
+//	dlq [-dlq URL] discard [-all] ID...
+//
+// With -local FILE, message bodies (one per line) are loaded into an
+// in-memory queue instead, to rehearse a replay without touching AWS.
+func main() {
+	cfg := config.Load()
+	dlqURL := flag.String("dlq", cfg.AWS.SQSDLQURL, "dead-letter queue URL (default $SQS_DLQ_URL)")
+	queueURL := flag.String("queue", cfg.AWS.SQSQueueURL, "queue to replay to (default $SQS_QUEUE_URL)")
+	local := flag.String("local", "", "read message bodies from this file into an in-memory queue instead of SQS")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if *local != "" {
+		c, err := localCLI(cfg, *local)
+		if err != nil {
+			fail("%v", err)
+		}
+		if err := c.run(context.Background(), flag.Args()); err != nil {
+			fail("%v", err)
+		}
+		return
+	}
+	if *dlqURL == "" {
+		fail("no dead-letter queue: set -dlq or SQS_DLQ_URL")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(cfg.AWS.Region),
+	)
+	if err != nil {
+		fail("failed to load AWS config: %v", err)
+	}
+	client := sqs.NewFromConfig(awsCfg)
+
+	c := &cli{
+		dead:     queue.NewSQSDeadLetters(client, *dlqURL),
+		target:   queue.NewSQS(client, *queueURL),
+		out:      os.Stdout,
+		redactor: redact.New(cfg),
+		now:      time.Now,
+	}
+	if err := c.run(context.Background(), flag.Args()); err != nil {
+		fail("%v", err)
+	}
+}
+
+// cli runs commands against any dead-letter queue and target, so it works
+// the same against the in-memory stand-ins
+type cli struct {
+	dead     queue.DeadLetters
+	target   queue.Queue
+	out      io.Writer
+	redactor *redact.Redactor
+	now      func() time.Time
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	command, args := args[0], args[1:]
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	all := fs.Bool("all", false, "act on every message")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ids := fs.Args()
+
+	switch command {
+	case "list":
+		return c.list(ctx)
+	case "replay", "discard":
+		if !*all && len(ids) == 0 {
+			return fmt.Errorf("%s needs message IDs or -all", command)
+		}
+		return c.each(ctx, command, *all, ids)
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// localCLI runs against in-memory stand-ins loaded from path; replayed
+// messages are printed rather than sent
+func localCLI(cfg *config.Config, path string) (*cli, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dead := queue.NewMemoryDeadLetters()
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			dead.Add(line, 0)
+		}
+	}
+	return &cli{
+		dead:     dead,
+		target:   printQueue{os.Stdout},
+		out:      os.Stdout,
+		redactor: redact.New(cfg),
+		now:      time.Now,
+	}, nil
+}
+
+// printQueue prints messages instead of sending them
+type printQueue struct{ out io.Writer }
+
+func (p printQueue) Send(ctx context.Context, msg *queue.Message) error {
+	body, err := queue.Encode(ctx, msg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "Would send: %s\n", body)
+	return nil
+}
+
+// list prints every message on the queue
+func (c *cli) list(ctx context.Context) error {
+	dead, err := queue.ReceiveAll(ctx, c.dead)
+	defer c.releaseAll(ctx, dead)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tUSER\tCHANNEL\tAGE\tRECEIVES\tTEXT")
+	for _, d := range dead {
+		if d.Message == nil {
+			fmt.Fprintf(w, "%s\t(unreadable)\t\t\t%s\t%d\t%s\n", d.QueueID, c.age(d), d.ReceiveCount, d.DecodeErr)
+			continue
+		}
+		fields := eventFieldsOf(d.Message)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			d.Message.ID, d.Message.Type, fields.User, fields.Channel, c.age(d), d.ReceiveCount, c.preview(fields.Text))
+	}
+	w.Flush()
+	fmt.Fprintf(c.out, "%d message(s)\n", len(dead))
+	return nil
+}
+
+// each replays or discards the selected messages, leaving the rest on the queue
+func (c *cli) each(ctx context.Context, command string, all bool, ids []string) error {
+	dead, err := queue.ReceiveAll(ctx, c.dead)
+	if err != nil {
+		c.releaseAll(ctx, dead)
+		return err
+	}
+
+	found := map[string]bool{}
+	done := 0
+	for _, d := range dead {
+		id, selected := selects(d, all, ids)
+		if !selected {
+			c.release(ctx, d)
+			continue
+		}
+		found[id] = true
+
+		if command == "replay" {
+			if d.Message == nil {
+				fmt.Fprintf(c.out, "Skipped %s: unreadable (%v), discard it instead\n", d.QueueID, d.DecodeErr)
+				c.release(ctx, d)
+				continue
+			}
+			// Unversioned messages were identified by their queue ID
+			if d.Message.ID == "" {
+				d.Message.ID = d.QueueID
+			}
+			// The ID stays, so write claims still dedupe; a FIFO queue would
+			// drop a replay within five minutes of the original send unless
+			// it is deduplicated as a new send
+			d.Message.DedupID = fmt.Sprintf("%s/replay/%d", d.Message.ID, c.now().UnixNano())
+			if err := c.target.Send(ctx, d.Message); err != nil {
+				c.release(ctx, d)
+				fmt.Fprintf(c.out, "Failed to replay %s: %v\n", d.QueueID, err)
+				continue
+			}
+		}
+
+		if err := c.dead.Delete(ctx, d); err != nil {
+			fmt.Fprintf(c.out, "Failed to remove %s from the dead-letter queue: %v\n", d.QueueID, err)
+			continue
+		}
+		done++
+		if command == "replay" {
+			fmt.Fprintf(c.out, "Replayed %s\n", d.Message.ID)
+		} else {
+			fmt.Fprintf(c.out, "Discarded %s\n", d.QueueID)
+		}
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			fmt.Fprintf(c.out, "Not found: %s\n", id)
+		}
+	}
+	if command == "replay" {
+		fmt.Fprintf(c.out, "%d message(s) replayed\n", done)
+	} else {
+		fmt.Fprintf(c.out, "%d message(s) discarded\n", done)
+	}
+	return nil
+}
+
+// selects returns the ID a message was selected by
+func selects(d *queue.Dead, all bool, ids []string) (string, bool) {
+	if all {
+		return d.QueueID, true
+	}
+	for _, id := range ids {
+		if d.Matches(id) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (c *cli) release(ctx context.Context, d *queue.Dead) {
+	if err := c.dead.Release(ctx, d); err != nil {
+		fmt.Fprintf(c.out, "Failed to release %s: %v\n", d.QueueID, err)
+	}
+}
+
+func (c *cli) releaseAll(ctx context.Context, dead []*queue.Dead) {
+	for _, d := range dead {
+		c.release(ctx, d)
+	}
+}
+
+func (c *cli) age(d *queue.Dead) string {
+	sent := d.SentAt
+	if d.Message != nil && !d.Message.EnqueuedAt.IsZero() {
+		sent = d.Message.EnqueuedAt
+	}
+	if sent.IsZero() {
+		return "?"
+	}
+	return c.now().Sub(sent).Round(time.Minute).String()
+}
+
+// preview is a redacted single-line excerpt of a message's text
+func (c *cli) preview(text string) string {
+	text = strings.Join(strings.Fields(c.redactor.Text(text)), " ")
+	if runes := []rune(text); len(runes) > 60 {
+		return string(runes[:59]) + "…"
+	}
+	return text
+}
+
+// eventFields are the fields most queued events share
+type eventFields struct {
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+	Text    string `json:"text"`
+}
+
+func eventFieldsOf(msg *queue.Message) eventFields {
+	var f eventFields
+	json.Unmarshal(msg.Event, &f)
+	return f
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  dlq [-dlq URL] [-queue URL] list
+  dlq [-dlq URL] [-queue URL] replay [-all] ID...
+  dlq [-dlq URL] discard [-all] ID...`)
+	flag.PrintDefaults()
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
+)
+
+// sentQueue records the messages sent to it
+type sentQueue struct {
+	sent []queue.Message
+}
+
+func (q *sentQueue) Send(ctx context.Context, msg *queue.Message) error {
+	q.sent = append(q.sent, *msg)
+	return nil
+}
+
+const (
+	mentionBody = `{"version":1,"id":"Ev001","type":"app_mention","event":{"user":"U1","channel":"C1","text":"refund 8815123456789012 card 4111 1111 1111 1111"}}`
+	commandBody = `{"version":1,"id":"Ev002","type":"slash_command","event":{"user":"U2","channel":"C2","text":"status"}}`
+	// Before the envelope was versioned messages had no ID
+	legacyBody     = `{"type":"message","event":{"user":"U3","channel":"D3","text":"hi"}}`
+	unreadableBody = `not json`
+)
+
+func newTestCLI(t *testing.T, bodies ...string) (*cli, *queue.MemoryDeadLetters, *sentQueue, *bytes.Buffer) {
+	t.Helper()
+	dead := queue.NewMemoryDeadLetters()
+	for _, body := range bodies {
+		dead.Add(body, 3)
+	}
+	target := &sentQueue{}
+	out := &bytes.Buffer{}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := &cli{
+		dead:     dead,
+		target:   target,
+		out:      out,
+		redactor: redact.New(&config.Config{}),
+		now:      func() time.Time { return now },
+	}
+	return c, dead, target, out
+}
+
+func remaining(t *testing.T, dead *queue.MemoryDeadLetters) []string {
+	t.Helper()
+	all, err := queue.ReceiveAll(context.Background(), dead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, d := range all {
+		ids = append(ids, d.QueueID)
+		dead.Release(context.Background(), d)
+	}
+	return ids
+}
+
+func TestList(t *testing.T) {
+	c, dead, target, out := newTestCLI(t, mentionBody, unreadableBody)
+	if err := c.run(context.Background(), []string{"list"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{"Ev001", "app_mention", "U1", "C1", "(unreadable)", "2 message(s)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("list output is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "4111 1111 1111 1111") {
+		t.Errorf("list shows an unredacted card number:\n%s", got)
+	}
+	// Listing leaves every message on the queue
+	if ids := remaining(t, dead); len(ids) != 2 {
+		t.Errorf("%d messages left after list, want 2", len(ids))
+	}
+	if len(target.sent) != 0 {
+		t.Errorf("list sent %d messages", len(target.sent))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	c, dead, target, out := newTestCLI(t, mentionBody, commandBody, legacyBody, unreadableBody)
+	if err := c.run(context.Background(), []string{"replay", "Ev001", "dead-3", "dead-4", "Ev999"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replays keep their ID, so write claims still dedupe, but get a fresh
+	// FIFO deduplication ID
+	if len(target.sent) != 2 {
+		t.Fatalf("replayed %d messages, want 2", len(target.sent))
+	}
+	tests := []struct {
+		id  string
+		typ string
+	}{
+		{"Ev001", "app_mention"},
+		{"dead-3", "message"}, // unversioned messages take their queue ID
+	}
+	for i, tt := range tests {
+		msg := target.sent[i]
+		if msg.ID != tt.id || msg.Type != tt.typ {
+			t.Errorf("replay %d = %s %s, want %s %s", i, msg.ID, msg.Type, tt.id, tt.typ)
+		}
+		if msg.DedupID == "" || msg.DedupID == msg.ID {
+			t.Errorf("replay %d has deduplication ID %q, want a fresh one", i, msg.DedupID)
+		}
+	}
+
+	got := out.String()
+	for _, want := range []string{"Replayed Ev001", "Replayed dead-3", "Skipped dead-4", "Not found: Ev999", "2 message(s) replayed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("replay output is missing %q:\n%s", want, got)
+		}
+	}
+	// Replayed messages leave the queue; the rest stay
+	if ids := strings.Join(remaining(t, dead), ","); ids != "dead-2,dead-4" {
+		t.Errorf("left on the queue: %s, want dead-2,dead-4", ids)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	c, dead, target, out := newTestCLI(t, mentionBody, commandBody, unreadableBody)
+	if err := c.run(context.Background(), []string{"discard", "Ev002", "dead-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.sent) != 0 {
+		t.Errorf("discard sent %d messages", len(target.sent))
+	}
+	if !strings.Contains(out.String(), "2 message(s) discarded") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if ids := strings.Join(remaining(t, dead), ","); ids != "dead-1" {
+		t.Errorf("left on the queue: %s, want dead-1", ids)
+	}
+
+	if err := c.run(context.Background(), []string{"discard", "-all"}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := remaining(t, dead); len(ids) != 0 {
+		t.Errorf("left on the queue after discard -all: %v", ids)
+	}
+}
+
+// expiringDeadLetters misses on its first receive, as SQS can, and makes
+// every message visible again once the queue first looks drained, as if the
+// visibility timeout ran out mid-read
+type expiringDeadLetters struct {
+	*queue.MemoryDeadLetters
+	received []*queue.Dead
+	calls    int
+	expired  bool
+}
+
+func (q *expiringDeadLetters) Receive(ctx context.Context, max int) ([]*queue.Dead, error) {
+	q.calls++
+	if q.calls == 1 {
+		return nil, nil
+	}
+	batch, err := q.MemoryDeadLetters.Receive(ctx, max)
+	if len(batch) == 0 && !q.expired {
+		q.expired = true
+		for _, d := range q.received {
+			q.MemoryDeadLetters.Release(ctx, d)
+		}
+		batch, err = q.MemoryDeadLetters.Receive(ctx, max)
+	}
+	q.received = append(q.received, batch...)
+	return batch, err
+}
+
+func TestReplayAllOnce(t *testing.T) {
+	c, dead, target, out := newTestCLI(t, mentionBody, commandBody, legacyBody)
+	c.dead = &expiringDeadLetters{MemoryDeadLetters: dead}
+	if err := c.run(context.Background(), []string{"replay", "-all"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, msg := range target.sent {
+		ids = append(ids, msg.ID)
+	}
+	if got := strings.Join(ids, ","); got != "Ev001,Ev002,dead-3" {
+		t.Errorf("replayed %s, want each message once", got)
+	}
+	if !strings.Contains(out.String(), "3 message(s) replayed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if ids := remaining(t, dead); len(ids) != 0 {
+		t.Errorf("left on the queue: %v", ids)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"replay"}, "needs message IDs or -all"},
+		{[]string{"discard"}, "needs message IDs or -all"},
+		{[]string{"purge"}, "unknown command"},
+	}
+	for _, tt := range tests {
+		c, _, _, _ := newTestCLI(t, mentionBody)
+		err := c.run(context.Background(), tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("run(%v) = %v, want an error containing %q", tt.args, err, tt.want)
+		}
+	}
+}
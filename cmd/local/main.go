@@ -0,0 +1,155 @@
+// Command local runs the webhook and the processor in one process for
+// development. Slack requests are served over HTTP (point a dev app at it
+// through a tunnel, or post recorded payloads), or received over Socket Mode
+// when SLACK_SOCKET_MODE is set, and the in-memory queue stands in for SQS.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/idempotency"
+	"github.com/getalternative/adyen-slack-assistant/internal/processor"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/socket"
+	"github.com/getalternative/adyen-slack-assistant/internal/webhook"
+)
+
+// queueSize bounds the in-memory queue; the webhook fails like SQS would when it's full
+const queueSize = 100
+
+func main() {
+	addr := flag.String("addr", ":3000", "address to serve Slack requests on")
+	logFormat := flag.String("log", "text", "log format: text or json")
+	flag.Parse()
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	if *logFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config.Load()
+	if err := processor.Init(cfg); err != nil {
+		fatal(logger, "failed to initialize processor", err)
+	}
+	if err := processor.Start(ctx); err != nil {
+		fatal(logger, "failed to start processor", err)
+	}
+	defer processor.Stop()
+
+	processing := queue.NewMemory(queueSize)
+	webhook.Init(cfg, processing, idempotency.NewMemory())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		process(ctx, logger, processing)
+	}()
+
+	if cfg.Slack.SocketMode {
+		logger.Info("receiving over socket mode")
+		if err := socket.Run(ctx, cfg); err != nil {
+			fatal(logger, "socket mode failed", err)
+		}
+		<-done
+		logger.Info("stopped")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/events", serve(logger))
+	mux.HandleFunc("POST /slack/interactions", serve(logger))
+	mux.HandleFunc("POST /slack/commands", serve(logger))
+	server := &http.Server{Addr: *addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	logger.Info("listening", "addr", *addr, "events", "/slack/events", "interactions", "/slack/interactions", "commands", "/slack/commands")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(logger, "server failed", err)
+	}
+	<-done
+	logger.Info("stopped")
+}
+
+// serve adapts an HTTP request to the webhook's API Gateway handler
+func serve(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		headers := make(map[string]string, len(r.Header))
+		for key := range r.Header {
+			headers[key] = r.Header.Get(key)
+		}
+		resp, _ := webhook.Handle(r.Context(), events.APIGatewayProxyRequest{
+			HTTPMethod: r.Method,
+			Path:       r.URL.Path,
+			Headers:    headers,
+			Body:       string(body),
+		})
+
+		for key, value := range resp.Headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.WriteString(w, resp.Body)
+
+		logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", resp.StatusCode, "duration_ms", time.Since(start).Milliseconds())
+	}
+}
+
+// process delivers queued messages to the processor one at a time, like the
+// SQS event source with a batch size of one
+func process(ctx context.Context, logger *slog.Logger, processing *queue.Memory) {
+	for {
+		msg, err := processing.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("invalid queue message", "error", err)
+			continue
+		}
+
+		start := time.Now()
+		err = processor.Handle(ctx, msg)
+		attrs := []any{"id", msg.ID, "trace", msg.TraceID, "type", msg.Type, "group", msg.GroupID,
+			"wait_ms", start.Sub(msg.EnqueuedAt).Milliseconds(), "duration_ms", time.Since(start).Milliseconds()}
+		if err != nil {
+			// Nothing is redelivered locally; retryable only says SQS would have tried again
+			logger.Error("message failed", append(attrs, "retryable", queue.IsRetryable(err), "error", err)...)
+			continue
+		}
+		logger.Info("message handled", attrs...)
+	}
+}
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,57 @@
+// Command socket receives Slack requests over Socket Mode and queues them on
+// SQS for the processor Lambda, for workspaces that can't expose the HTTP
+// webhook. It replaces the webhook function, not the processor: messages
+// get the same retries, dead-letter queue and write claims as webhook ones.
+// Run one instance on any host that can reach Slack and AWS.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/idempotency"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/socket"
+	"github.com/getalternative/adyen-slack-assistant/internal/webhook"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config.Load()
+	if cfg.AWS.SQSQueueURL == "" {
+		fail("SQS_QUEUE_URL is required: run cmd/local to process in-process instead")
+	}
+	if cfg.AWS.IdempotencyTable == "" {
+		// Slack redelivers over a new connection after a restart
+		fmt.Println("IDEMPOTENCY_DYNAMODB_TABLE is not set: events redelivered after a restart may be queued twice")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(cfg.AWS.Region),
+	)
+	if err != nil {
+		fail("failed to load AWS config: %v", err)
+	}
+	seen, err := idempotency.New(cfg)
+	if err != nil {
+		fail("failed to create idempotency store: %v", err)
+	}
+
+	webhook.Init(cfg, queue.NewSQS(sqs.NewFromConfig(awsCfg), cfg.AWS.SQSQueueURL), seen)
+	if err := socket.Run(ctx, cfg); err != nil {
+		fail("%v", err)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
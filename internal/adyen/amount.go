@@ -0,0 +1,105 @@
+package adyen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is an Adyen amount in minor units
+type Amount struct {
+	Value    int64  `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// currencyExponents lists currencies whose minor unit isn't 1/100
+var currencyExponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "CVE": 0, "DJF": 0, "GNF": 0, "IDR": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+var currencySymbols = map[string]string{
+	"EUR": "€", "USD": "$", "GBP": "£", "JPY": "¥",
+}
+
+// CurrencyExponent returns the number of decimals used by a currency
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Major returns the amount in major units, e.g. 1050 EUR -> 10.50
+func (a Amount) Major() float64 {
+	return float64(a.Value) / math.Pow10(CurrencyExponent(a.Currency))
+}
+
+// String formats the amount for display, e.g. "€1,234.50" or "1,234.500 KWD"
+func (a Amount) String() string {
+	exp := CurrencyExponent(a.Currency)
+	value := a.Value
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	unit := int64(math.Pow10(exp))
+	major := groupThousands(strconv.FormatInt(value/unit, 10))
+	if exp > 0 {
+		major += fmt.Sprintf(".%0*d", exp, value%unit)
+	}
+
+	if symbol, ok := currencySymbols[strings.ToUpper(a.Currency)]; ok {
+		return sign + symbol + major
+	}
+	return sign + major + " " + strings.ToUpper(a.Currency)
+}
+
+// ToMinorUnits converts a major-unit value, e.g. 10.5 EUR -> 1050
+func ToMinorUnits(major float64, currency string) int64 {
+	return int64(math.Round(major * math.Pow10(CurrencyExponent(currency))))
+}
+
+// AmountFrom reads an Adyen amount object from decoded JSON
+func AmountFrom(v interface{}) (Amount, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return Amount{}, false
+	}
+	currency, _ := m["currency"].(string)
+	if currency == "" {
+		return Amount{}, false
+	}
+	switch value := m["value"].(type) {
+	case float64:
+		return Amount{Value: int64(value), Currency: currency}, true
+	case int64:
+		return Amount{Value: value, Currency: currency}, true
+	case string:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return Amount{Value: n, Currency: currency}, err == nil
+	}
+	return Amount{}, false
+}
+
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	lead := len(digits) % 3
+	if lead > 0 {
+		b.WriteString(digits[:lead])
+	}
+	for i := lead; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
@@ -14,17 +14,26 @@ import (
 	"github.com/getalternative/adyen-slack-assistant/internal/llm"
 )
 
-// Client wraps the Adyen MCP server
+// Client wraps the Adyen MCP server. Requests are matched to responses by
+// ID, so tool calls can run concurrently.
 type Client struct {
 	cfg       *config.Config
 	cmd       *exec.Cmd
-	stdin     io.WriteCloser
-	stdout    *bufio.Reader
 	mu        sync.Mutex
+	session   *session
 	requestID int64
 	tools     []llm.Tool
 }
 
+// session is the connection to one MCP server process. Client.mu guards
+// pending and err; writeMu keeps requests from interleaving on stdin.
+type session struct {
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	pending map[int64]chan *MCPResponse
+	err     error // set once the server's output ends
+}
+
 // MCPRequest represents a JSON-RPC request to MCP
 type MCPRequest struct {
 	JSONRPC string      `json:"jsonrpc"`
@@ -100,26 +109,30 @@ func (c *Client) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
 	}
-	c.stdin = stdin
 
 	stdout, err := c.cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
-	c.stdout = bufio.NewReader(stdout)
 
 	if err := c.cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start MCP server: %w", err)
 	}
 
+	s := &session{stdin: stdin, pending: map[int64]chan *MCPResponse{}}
+	c.mu.Lock()
+	c.session = s
+	c.mu.Unlock()
+	go c.read(s, bufio.NewReader(stdout))
+
 	// Initialize the connection
-	if err := c.initialize(); err != nil {
+	if err := c.initialize(ctx); err != nil {
 		c.Stop()
 		return fmt.Errorf("failed to initialize MCP: %w", err)
 	}
 
 	// Load available tools
-	if err := c.loadTools(); err != nil {
+	if err := c.loadTools(ctx); err != nil {
 		c.Stop()
 		return fmt.Errorf("failed to load tools: %w", err)
 	}
@@ -129,9 +142,11 @@ func (c *Client) Start(ctx context.Context) error {
 
 // Stop stops the MCP server process
 func (c *Client) Stop() error {
-	if c.stdin != nil {
-		c.stdin.Close()
+	c.mu.Lock()
+	if c.session != nil {
+		c.session.stdin.Close()
 	}
+	c.mu.Unlock()
 	if c.cmd != nil && c.cmd.Process != nil {
 		return c.cmd.Process.Kill()
 	}
@@ -143,11 +158,8 @@ func (c *Client) GetTools() []llm.Tool {
 	return c.tools
 }
 
-// CallTool calls an Adyen MCP tool
+// CallTool calls an Adyen MCP tool. It is safe to call concurrently.
 func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	req := MCPRequest{
 		JSONRPC: "2.0",
 		ID:      atomic.AddInt64(&c.requestID, 1),
@@ -158,7 +170,7 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments map[string
 		},
 	}
 
-	resp, err := c.sendRequest(req)
+	resp, err := c.sendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -187,7 +199,7 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments map[string
 }
 
 // initialize sends the initialize request to MCP
-func (c *Client) initialize() error {
+func (c *Client) initialize(ctx context.Context) error {
 	req := MCPRequest{
 		JSONRPC: "2.0",
 		ID:      atomic.AddInt64(&c.requestID, 1),
@@ -202,19 +214,19 @@ func (c *Client) initialize() error {
 		},
 	}
 
-	_, err := c.sendRequest(req)
+	_, err := c.sendRequest(ctx, req)
 	return err
 }
 
 // loadTools fetches and converts available tools
-func (c *Client) loadTools() error {
+func (c *Client) loadTools(ctx context.Context) error {
 	req := MCPRequest{
 		JSONRPC: "2.0",
 		ID:      atomic.AddInt64(&c.requestID, 1),
 		Method:  "tools/list",
 	}
 
-	resp, err := c.sendRequest(req)
+	resp, err := c.sendRequest(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -237,32 +249,87 @@ func (c *Client) loadTools() error {
 	return nil
 }
 
-// sendRequest sends a JSON-RPC request and waits for response
-func (c *Client) sendRequest(req MCPRequest) (*MCPResponse, error) {
+// sendRequest sends a JSON-RPC request and waits for its response
+func (c *Client) sendRequest(ctx context.Context, req MCPRequest) (*MCPResponse, error) {
 	data, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Write request with newline delimiter
-	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
-		return nil, fmt.Errorf("failed to write request: %w", err)
+	// Register for the response, then write the request with a newline delimiter
+	ch := make(chan *MCPResponse, 1)
+	c.mu.Lock()
+	s := c.session
+	if s == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("MCP server is not running")
+	}
+	if s.err != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("failed to read response: %w", s.err)
 	}
+	s.pending[req.ID] = ch
+	c.mu.Unlock()
 
-	// Read response line
-	line, err := c.stdout.ReadBytes('\n')
+	s.writeMu.Lock()
+	_, err = s.stdin.Write(append(data, '\n'))
+	s.writeMu.Unlock()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		c.mu.Lock()
+		delete(s.pending, req.ID)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("failed to write request: %w", err)
 	}
 
-	var resp MCPResponse
-	if err := json.Unmarshal(line, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	var resp *MCPResponse
+	select {
+	case resp = <-ch:
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(s.pending, req.ID)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	if resp == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, fmt.Errorf("failed to read response: %w", s.err)
 	}
 
 	if resp.Error != nil {
 		return nil, fmt.Errorf("MCP error %d: %s", resp.Error.Code, resp.Error.Message)
 	}
 
-	return &resp, nil
+	return resp, nil
+}
+
+// read delivers each response line to the request waiting for it until the
+// server's output ends, then fails the requests still waiting
+func (c *Client) read(s *session, stdout *bufio.Reader) {
+	for {
+		line, err := stdout.ReadBytes('\n')
+		if err != nil {
+			c.mu.Lock()
+			s.err = err
+			for id, ch := range s.pending {
+				close(ch)
+				delete(s.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		// Notifications and unparseable lines have no waiting request
+		var resp MCPResponse
+		if err := json.Unmarshal(line, &resp); err != nil || resp.ID == 0 {
+			continue
+		}
+		c.mu.Lock()
+		ch := s.pending[resp.ID]
+		delete(s.pending, resp.ID)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- &resp
+		}
+	}
 }
@@ -0,0 +1,218 @@
+package approval
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the buttons on an approval prompt
+const (
+	ApproveAction = "approve_call"
+	RejectAction  = "reject_call"
+)
+
+// Block IDs that mark a message as an approval prompt, before and after the decision
+const (
+	actionsBlockID = "approval"
+	outcomeBlockID = "approval_outcome"
+)
+
+// maxShownItems is how many PSP references a prompt lists before summarizing
+// the rest, keeping the list within Slack's section text limit
+const maxShownItems = 100
+
+// ErrInvalidValue is returned for a button value that wasn't signed by us
+var ErrInvalidValue = errors.New("invalid approval button")
+
+// Request is a write action waiting for an admin. The request is stored
+// server-side under its ID; the prompt's buttons carry only the signed ID,
+// so a click can't change what runs.
+type Request struct {
+	ID       string                 `json:"id"`
+	Tool     string                 `json:"t"`
+	Args     map[string]interface{} `json:"a,omitempty"`
+	User     string                 `json:"u"`
+	Channel  string                 `json:"c"`
+	ThreadTs string                 `json:"th,omitempty"`
+	// Ts is the requester's message, which carries the status reaction
+	Ts string `json:"ts,omitempty"`
+	// Items makes the request a bulk job: Tool runs once for each PSP
+	// reference, with Args. One approval covers them all.
+	Items []string `json:"i,omitempty"`
+	// Total is what a bulk job moves in all, e.g. "€1,200.00", if known
+	Total string `json:"tt,omitempty"`
+	// Confirm asks the requester, an admin, to confirm rather than approve
+	Confirm bool `json:"cf,omitempty"`
+}
+
+// target describes what the request runs on, e.g. "`refund_payment` on 12 payments"
+func (r Request) target() string {
+	switch {
+	case len(r.Items) > 0 && r.Total != "":
+		return fmt.Sprintf("`%s` on %d payments, %s in total", r.Tool, len(r.Items), r.Total)
+	case len(r.Items) > 0:
+		return fmt.Sprintf("`%s` on %d payments", r.Tool, len(r.Items))
+	}
+	return fmt.Sprintf("`%s`", r.Tool)
+}
+
+// NewID returns a random request ID
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Encode serializes the request for storage
+func (r Request) Encode() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Decode reads a stored request
+func Decode(value string) (Request, error) {
+	var r Request
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return r, fmt.Errorf("invalid approval request: %w", err)
+	}
+	if r.ID == "" || r.Tool == "" || r.User == "" {
+		return r, errors.New("invalid approval request: missing ID, tool or user")
+	}
+	return r, nil
+}
+
+// Sign returns the button value for a request ID: the ID and its HMAC
+func Sign(key []byte, id string) string {
+	return id + "." + signature(key, id)
+}
+
+// Verify returns the request ID from a signed button value
+func Verify(key []byte, value string) (string, error) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(sig), []byte(signature(key, id))) {
+		return "", ErrInvalidValue
+	}
+	return id, nil
+}
+
+func signature(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("approval/" + id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Blocks renders the prompt asking admins to approve or reject the request,
+// with buttons signed by key. shown is the version of the arguments safe to
+// display, e.g. redacted.
+func Blocks(r Request, shown map[string]interface{}, admins []string, key []byte) []slack.Block {
+	value := Sign(key, r.ID)
+
+	mentions := make([]string, len(admins))
+	for i, admin := range admins {
+		mentions[i] = fmt.Sprintf("<@%s>", admin)
+	}
+	text := fmt.Sprintf(":raised_hand: <@%s> wants to run %s.", r.User, r.target())
+	if len(mentions) > 0 {
+		text += " " + strings.Join(mentions, " ") + ", please review."
+	}
+	approveLabel, rejectLabel := "Approve", "Reject"
+	if r.Confirm {
+		text = fmt.Sprintf(":raised_hand: <@%s>, please confirm running %s.", r.User, r.target())
+		approveLabel, rejectLabel = "Confirm", "Cancel"
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+	if args := formatArgs(shown); args != "" {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, "```\n"+args+"\n```", false, false), nil, nil))
+	}
+	if len(r.Items) > 0 {
+		items := r.Items
+		more := ""
+		if len(items) > maxShownItems {
+			items, more = items[:maxShownItems], fmt.Sprintf("\n…and %d more", len(r.Items)-maxShownItems)
+		}
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, "PSP references:\n```\n"+strings.Join(items, "\n")+"\n```"+more, false, false), nil, nil))
+	}
+
+	approve := slack.NewButtonBlockElement(ApproveAction, value, slack.NewTextBlockObject(slack.PlainTextType, approveLabel, false, false))
+	approve.Style = slack.StylePrimary
+	reject := slack.NewButtonBlockElement(RejectAction, value, slack.NewTextBlockObject(slack.PlainTextType, rejectLabel, false, false))
+	reject.Style = slack.StyleDanger
+	blocks = append(blocks, slack.NewActionBlock(actionsBlockID, approve, reject))
+	return blocks
+}
+
+// Resolved renders a prompt after a decision, without buttons
+func Resolved(r Request, outcome string) []slack.Block {
+	text := fmt.Sprintf("<@%s> asked to run %s.\n%s", r.User, r.target(), outcome)
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil,
+			slack.SectionBlockOptionBlockID(outcomeBlockID)),
+	}
+}
+
+// IsPrompt returns true if msg is an approval prompt, decided or not
+func IsPrompt(msg slack.Message) bool {
+	for _, block := range msg.Blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.ActionBlock:
+			if b.BlockID == actionsBlockID {
+				return true
+			}
+		case *slack.SectionBlock:
+			if b.BlockID == outcomeBlockID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pending returns the ID of the request on a prompt that is still waiting
+// for a decision, i.e. one that still has its buttons signed by key
+func Pending(msg slack.Message, key []byte) (string, bool) {
+	for _, block := range msg.Blocks.BlockSet {
+		actions, ok := block.(*slack.ActionBlock)
+		if !ok || actions.Elements == nil {
+			continue
+		}
+		for _, element := range actions.Elements.ElementSet {
+			button, ok := element.(*slack.ButtonBlockElement)
+			if !ok || button.ActionID != ApproveAction {
+				continue
+			}
+			id, err := Verify(key, button.Value)
+			return id, err == nil
+		}
+	}
+	return "", false
+}
+
+func formatArgs(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	data, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		return ""
+	}
+	if runes := []rune(string(data)); len(runes) > 2500 {
+		return string(runes[:2500]) + "…"
+	}
+	return string(data)
+}
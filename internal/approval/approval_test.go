@@ -0,0 +1,168 @@
+package approval
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+var testKey = []byte("test-key")
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{
+			name: "single call",
+			req: Request{
+				ID:      "a1",
+				Tool:    "refund_payment",
+				Args:    map[string]interface{}{"pspReference": "8815123456789012", "amount": 1000.0, "currency": "EUR"},
+				User:    "U1",
+				Channel: "C1",
+				Ts:      "1700000000.000100",
+			},
+		},
+		{
+			name: "in a thread",
+			req:  Request{ID: "a2", Tool: "cancel_payment", User: "U1", Channel: "C1", ThreadTs: "1700000000.000001", Ts: "1700000000.000100"},
+		},
+		{
+			name: "bulk job",
+			req: Request{
+				ID:      "a3",
+				Tool:    "refund_payment",
+				Args:    map[string]interface{}{"reason": "duplicate"},
+				User:    "U2",
+				Channel: "C2",
+				Items:   []string{"8815123456789012", "8815123456789013"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.req.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.req) {
+				t.Errorf("Decode(Encode()) = %+v, want %+v", got, tt.req)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not JSON", "approve"},
+		{"missing ID", `{"t":"refund_payment","u":"U1","c":"C1"}`},
+		{"missing tool", `{"id":"a1","u":"U1","c":"C1"}`},
+		{"missing user", `{"id":"a1","t":"refund_payment","c":"C1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.value); err == nil {
+				t.Errorf("Decode(%q) succeeded, want an error", tt.value)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	id := NewID()
+	if len(id) != 32 || id == NewID() {
+		t.Fatalf("NewID = %q, want 32 random hex characters", id)
+	}
+	value := Sign(testKey, id)
+	if len(value) > 2000 {
+		t.Errorf("button value is %d bytes, over Slack's limit", len(value))
+	}
+	if got, err := Verify(testKey, value); err != nil || got != id {
+		t.Errorf("Verify = %q, %v; want %q", got, err, id)
+	}
+
+	other := NewID()
+	_, sig, _ := strings.Cut(value, ".")
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"another ID", other + "." + sig},
+		{"other key", Sign([]byte("other-key"), id)},
+		{"unsigned", id},
+		{"empty ID", "." + sig},
+		{"old request JSON", `{"t":"refund_payment","u":"U1","c":"C1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(testKey, tt.value); !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("Verify(%q) = %v, want ErrInvalidValue", tt.value, err)
+			}
+		})
+	}
+}
+
+func TestBlocksItems(t *testing.T) {
+	r := Request{ID: "a1", Tool: "refund_payment", User: "U1", Channel: "C1"}
+	for i := 0; i < 200; i++ {
+		r.Items = append(r.Items, "8815123456789012")
+	}
+	blocks := Blocks(r, nil, nil, testKey)
+
+	// The list stays within Slack's 3000 character section limit
+	var list string
+	for _, block := range blocks {
+		if section, ok := block.(*slack.SectionBlock); ok && strings.HasPrefix(section.Text.Text, "PSP references") {
+			list = section.Text.Text
+		}
+	}
+	if len(list) > 3000 || strings.Count(list, "8815123456789012") != maxShownItems || !strings.HasSuffix(list, "…and 100 more") {
+		t.Errorf("PSP reference list of %d characters:\n%s", len(list), list)
+	}
+	if !strings.Contains(blocks[0].(*slack.SectionBlock).Text.Text, "on 200 payments") {
+		t.Errorf("prompt doesn't give the batch size: %s", blocks[0].(*slack.SectionBlock).Text.Text)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	r := Request{ID: "a1", Tool: "refund_payment", User: "U1", Channel: "C1", Items: []string{"8815123456789012"}}
+	blocks := Blocks(r, map[string]interface{}{"reason": "duplicate"}, []string{"UADMIN"}, testKey)
+
+	prompt := slack.Message{}
+	prompt.Blocks = slack.Blocks{BlockSet: blocks}
+	if !IsPrompt(prompt) {
+		t.Error("IsPrompt is false for a prompt")
+	}
+	got, ok := Pending(prompt, testKey)
+	if !ok || got != r.ID {
+		t.Errorf("Pending = %q, %v; want %q", got, ok, r.ID)
+	}
+	// Buttons signed with another key aren't ours to act on
+	if _, ok := Pending(prompt, []byte("other-key")); ok {
+		t.Error("Pending accepted a prompt signed with another key")
+	}
+
+	// Once decided, the prompt loses its buttons
+	decided := slack.Message{}
+	decided.Blocks = slack.Blocks{BlockSet: Resolved(r, "Approved by <@UADMIN>.")}
+	if !IsPrompt(decided) {
+		t.Error("IsPrompt is false for a decided prompt")
+	}
+	if _, ok := Pending(decided, testKey); ok {
+		t.Error("a decided prompt is still pending")
+	}
+	if IsPrompt(slack.Message{}) {
+		t.Error("IsPrompt is true for an ordinary message")
+	}
+}
@@ -1,10 +1,20 @@
 package audit
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
 	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
 	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
 )
 
@@ -17,148 +27,370 @@ const (
 	EventApproved EventType = "approved"
 	EventRejected EventType = "rejected"
 	EventError    EventType = "error"
+	EventRevealed EventType = "revealed"
+	// EventAttempted is recorded before a write action runs
+	EventAttempted EventType = "attempted"
+	// EventUsage records LLM token usage and latency for a message
+	EventUsage EventType = "usage"
+	// EventRequested records a write action sent to admins for approval
+	EventRequested EventType = "requested"
 )
 
+// maxSummaryLength bounds the result summary stored with each entry
+const maxSummaryLength = 500
+
 // Entry represents an audit log entry
 type Entry struct {
-	Timestamp  time.Time
-	UserID     string
-	Action     string
-	Channel    string
-	EventType  EventType
-	ApprovedBy string
-	Details    string
+	Timestamp     time.Time              `json:"timestamp"`
+	RequestID     string                 `json:"requestId,omitempty"`
+	Environment   string                 `json:"environment"`
+	UserID        string                 `json:"userId"`
+	Action        string                 `json:"action"`
+	Channel       string                 `json:"channel"`
+	EventType     EventType              `json:"eventType"`
+	ApprovedBy    string                 `json:"approvedBy,omitempty"`
+	Details       string                 `json:"details,omitempty"`
+	Arguments     map[string]interface{} `json:"arguments,omitempty"`
+	ResultSummary string                 `json:"resultSummary,omitempty"`
+	Duration      time.Duration          `json:"duration,omitempty"`
+
+	// Payment identifiers, taken from the arguments or the result
+	PSPReference    string        `json:"pspReference,omitempty"`
+	Amount          *adyen.Amount `json:"amount,omitempty"`
+	MerchantAccount string        `json:"merchantAccount,omitempty"`
+
+	// LLM consumption, set on EventUsage entries
+	Usage *Usage `json:"usage,omitempty"`
+
+	// Hash chain fields, see Chain
+	Sequence  uint64 `json:"sequence"`
+	PrevHash  string `json:"prevHash"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature,omitempty"` // HMAC, set on checkpoints only
+}
+
+// Usage is the LLM token consumption and cost recorded for a message
+type Usage struct {
+	InputTokens      int     `json:"inputTokens"`
+	OutputTokens     int     `json:"outputTokens"`
+	CacheWriteTokens int     `json:"cacheWriteTokens,omitempty"`
+	CacheReadTokens  int     `json:"cacheReadTokens,omitempty"`
+	CostUSD          float64 `json:"costUsd"`
+}
+
+// Sink persists audit entries somewhere
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, entry Entry) error
 }
 
-// Logger handles audit logging to Slack
+// Logger fans audit entries out to every configured sink
 type Logger struct {
-	cfg   *config.Config
-	slack *slackClient.Client
+	cfg      *config.Config
+	sinks    []Sink
+	spools   []Spool
+	chain    *Chain
+	redactor *redact.Redactor
+
+	// Async delivery, see startAsync
+	queue   chan Entry
+	pending sync.WaitGroup
+}
+
+// New creates a new audit logger with the Slack audit channel and any
+// durable sinks enabled in config
+func New(cfg *config.Config, slack *slackClient.Client) (*Logger, error) {
+	sinks := []Sink{}
+	if cfg.Permissions.AuditChannel != "" {
+		sinks = append(sinks, NewSlackSink(slack, cfg.Permissions.AuditChannel))
+	}
+
+	// The chain head lives with the most durable store available
+	var heads HeadStore = &MemoryHeadStore{}
+	if cfg.Audit.File != "" {
+		sinks = append(sinks, NewFileSink(cfg.Audit.File))
+		heads = NewFileHeadStore(cfg.Audit.File + ".head")
+	}
+
+	var spools []Spool
+	if cfg.Audit.SpoolFile != "" {
+		spools = append(spools, NewFileSpool(cfg.Audit.SpoolFile))
+	}
+
+	if cfg.Audit.S3Bucket != "" || cfg.Audit.DynamoDBTable != "" || cfg.Audit.DLQURL != "" {
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+			awsconfig.WithRegion(cfg.AWS.Region),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		if cfg.Audit.S3Bucket != "" {
+			sinks = append(sinks, NewS3Sink(s3.NewFromConfig(awsCfg), cfg.Audit.S3Bucket, cfg.Audit.S3Prefix))
+		}
+		if cfg.Audit.DynamoDBTable != "" {
+			client := dynamodb.NewFromConfig(awsCfg)
+			sinks = append(sinks, NewDynamoDBSink(client, cfg.Audit.DynamoDBTable))
+			heads = NewDynamoDBHeadStore(client, cfg.Audit.DynamoDBTable)
+		}
+		if cfg.Audit.DLQURL != "" {
+			spools = append(spools, NewSQSSpool(sqs.NewFromConfig(awsCfg), cfg.Audit.DLQURL))
+		}
+	}
+
+	l := NewWithSinks(cfg, heads, sinks...)
+	l.spools = spools
+	if cfg.Audit.Async {
+		l.startAsync(cfg.Audit.BufferSize)
+	}
+	return l, nil
 }
 
-// New creates a new audit logger
-func New(cfg *config.Config, slack *slackClient.Client) *Logger {
-	return &Logger{cfg: cfg, slack: slack}
+// NewWithSinks creates a logger writing to the given sinks only, chaining
+// entries through heads
+func NewWithSinks(cfg *config.Config, heads HeadStore, sinks ...Sink) *Logger {
+	return &Logger{
+		cfg:      cfg,
+		sinks:    sinks,
+		chain:    NewChain(heads, []byte(cfg.Audit.HMACKey), cfg.Audit.CheckpointInterval),
+		redactor: redact.New(cfg),
+	}
 }
 
-// Log sends an audit entry to the audit channel
-func (l *Logger) Log(entry Entry) error {
-	channel := l.cfg.Permissions.AuditChannel
-	if channel == "" {
-		return nil // No audit channel configured
+// Log writes an audit entry to every sink. In async mode the entry is
+// buffered and Log only fails if the buffer stays full until ctx is done;
+// otherwise all sinks are attempted and Log fails with ErrNotPersisted if none
+// accepted the entry.
+func (l *Logger) Log(ctx context.Context, entry Entry) error {
+	if l.queue == nil {
+		return l.LogSync(ctx, entry)
 	}
+	entry = l.prepare(ctx, entry)
 
-	emoji := l.getEmoji(entry.EventType)
-	text := l.formatEntry(entry, emoji)
+	l.pending.Add(1)
+	select {
+	case l.queue <- entry:
+		return nil
+	case <-ctx.Done():
+		l.pending.Done()
+		return fmt.Errorf("audit buffer full: %w", ctx.Err())
+	}
+}
 
-	_, err := l.slack.PostToChannel(channel, "", text)
+// prepare fills defaults and redacts an entry before delivery
+func (l *Logger) prepare(ctx context.Context, entry Entry) Entry {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	entry.Timestamp = entry.Timestamp.UTC()
+	if entry.RequestID == "" {
+		entry.RequestID = RequestIDFrom(ctx)
+	}
+	if entry.Environment == "" {
+		entry.Environment = l.cfg.Adyen.Environment
+	}
+
+	// Pull payment identifiers out before the result is redacted and truncated
+	extractPayment(&entry)
+
+	// Audit records must never hold the data that was redacted elsewhere
+	entry.Details = l.redactor.Text(entry.Details)
+	entry.Arguments = l.redactor.Map(entry.Arguments)
+	entry.ResultSummary = summarize(l.redactor.Result(entry.ResultSummary))
+	return entry
+}
+
+// checkpoint appends a signed entry attesting to the chain up to sequence
+func (l *Logger) checkpoint(ctx context.Context, sequence uint64) error {
+	entry := Entry{
+		Timestamp:   time.Now().UTC(),
+		Environment: l.cfg.Adyen.Environment,
+		Action:      "checkpoint",
+		EventType:   EventCheckpoint,
+		Details:     fmt.Sprintf("Checkpoint after entry %d", sequence),
+	}
+	if err := l.chain.Link(ctx, &entry); err != nil {
+		return err
+	}
+	l.chain.Sign(&entry)
+	_, err := l.writeWithRetry(ctx, entry)
 	return err
 }
 
-// LogAllowed logs a successful action
-func (l *Logger) LogAllowed(userID, action, channel, details string) error {
-	return l.Log(Entry{
-		Timestamp: time.Now(),
+// LogAllowed logs a successful action, a summary of its result and how long it took
+func (l *Logger) LogAllowed(ctx context.Context, userID, action, channel string, args map[string]interface{}, result string, duration time.Duration) error {
+	return l.Log(ctx, Entry{
+		UserID:        userID,
+		Action:        action,
+		Channel:       channel,
+		EventType:     EventAllowed,
+		Arguments:     args,
+		ResultSummary: result,
+		Duration:      duration,
+	})
+}
+
+// LogAttempted synchronously records that a write action is about to run.
+// An error means the attempt could not be persisted by any sink.
+func (l *Logger) LogAttempted(ctx context.Context, userID, action, channel string, args map[string]interface{}) error {
+	return l.LogSync(ctx, Entry{
 		UserID:    userID,
 		Action:    action,
 		Channel:   channel,
-		EventType: EventAllowed,
-		Details:   details,
+		EventType: EventAttempted,
+		Arguments: args,
+	})
+}
+
+// LogUsage records LLM usage and latency for a message
+func (l *Logger) LogUsage(ctx context.Context, userID, channel string, usage Usage, duration time.Duration) error {
+	return l.Log(ctx, Entry{
+		UserID:    userID,
+		Action:    "llm",
+		Channel:   channel,
+		EventType: EventUsage,
+		Usage:     &usage,
+		Duration:  duration,
 	})
 }
 
 // LogDenied logs a denied action
-func (l *Logger) LogDenied(userID, action, channel, reason string) error {
-	return l.Log(Entry{
-		Timestamp: time.Now(),
+func (l *Logger) LogDenied(ctx context.Context, userID, action, channel string, args map[string]interface{}, reason string) error {
+	return l.Log(ctx, Entry{
 		UserID:    userID,
 		Action:    action,
 		Channel:   channel,
 		EventType: EventDenied,
+		Arguments: args,
 		Details:   reason,
 	})
 }
 
+// LogRequested logs a write action waiting for an admin's approval
+func (l *Logger) LogRequested(ctx context.Context, userID, action, channel string, args map[string]interface{}) error {
+	return l.Log(ctx, Entry{
+		UserID:    userID,
+		Action:    action,
+		Channel:   channel,
+		EventType: EventRequested,
+		Arguments: args,
+		Details:   "Sent to admins for approval",
+	})
+}
+
 // LogApproved logs an approved action
-func (l *Logger) LogApproved(userID, action, channel, approvedBy, details string) error {
-	return l.Log(Entry{
-		Timestamp:  time.Now(),
+func (l *Logger) LogApproved(ctx context.Context, userID, action, channel, approvedBy string, args map[string]interface{}, details string) error {
+	return l.Log(ctx, Entry{
 		UserID:     userID,
 		Action:     action,
 		Channel:    channel,
 		EventType:  EventApproved,
 		ApprovedBy: approvedBy,
+		Arguments:  args,
 		Details:    details,
 	})
 }
 
 // LogRejected logs a rejected action
-func (l *Logger) LogRejected(userID, action, channel, rejectedBy string) error {
-	return l.Log(Entry{
-		Timestamp:  time.Now(),
+func (l *Logger) LogRejected(ctx context.Context, userID, action, channel, rejectedBy string, args map[string]interface{}) error {
+	return l.Log(ctx, Entry{
 		UserID:     userID,
 		Action:     action,
 		Channel:    channel,
 		EventType:  EventRejected,
 		ApprovedBy: rejectedBy, // reusing field for rejector
+		Arguments:  args,
 		Details:    "Request rejected",
 	})
 }
 
+// LogRevealed logs an admin viewing unredacted data
+func (l *Logger) LogRevealed(ctx context.Context, userID, action, channel string, args map[string]interface{}, details string) error {
+	return l.Log(ctx, Entry{
+		UserID:    userID,
+		Action:    action,
+		Channel:   channel,
+		EventType: EventRevealed,
+		Arguments: args,
+		Details:   details,
+	})
+}
+
 // LogError logs an error
-func (l *Logger) LogError(userID, action, channel, errMsg string) error {
-	return l.Log(Entry{
-		Timestamp: time.Now(),
+func (l *Logger) LogError(ctx context.Context, userID, action, channel string, args map[string]interface{}, errMsg string, duration time.Duration) error {
+	return l.Log(ctx, Entry{
 		UserID:    userID,
 		Action:    action,
 		Channel:   channel,
 		EventType: EventError,
+		Arguments: args,
 		Details:   errMsg,
+		Duration:  duration,
 	})
 }
 
-func (l *Logger) getEmoji(eventType EventType) string {
-	switch eventType {
-	case EventAllowed:
-		return ":white_check_mark:"
-	case EventDenied:
-		return ":no_entry:"
-	case EventApproved:
-		return ":heavy_check_mark:"
-	case EventRejected:
-		return ":x:"
-	case EventError:
-		return ":warning:"
-	default:
-		return ":grey_question:"
-	}
-}
-
-func (l *Logger) formatEntry(entry Entry, emoji string) string {
-	timestamp := entry.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC")
-
-	base := fmt.Sprintf("%s *%s* | `%s`\n"+
-		"*User:* <@%s> | *Channel:* <#%s>\n"+
-		"*Time:* %s",
-		emoji,
-		entry.EventType,
-		entry.Action,
-		entry.UserID,
-		entry.Channel,
-		timestamp,
-	)
-
-	if entry.ApprovedBy != "" {
-		verb := "Approved by"
-		if entry.EventType == EventRejected {
-			verb = "Rejected by"
+type requestIDKey struct{}
+
+// WithRequestID attaches a request ID that is recorded on every entry logged with ctx
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFrom returns the request ID attached to ctx, if any
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// extractPayment fills the payment fields from the arguments, falling back to the result
+func extractPayment(entry *Entry) {
+	var result map[string]interface{}
+	json.Unmarshal([]byte(entry.ResultSummary), &result)
+
+	for _, source := range []map[string]interface{}{entry.Arguments, result} {
+		if source == nil {
+			continue
+		}
+		if entry.PSPReference == "" {
+			entry.PSPReference = firstString(source, "pspReference", "paymentPspReference", "originalReference")
+		}
+		if entry.MerchantAccount == "" {
+			entry.MerchantAccount = firstString(source, "merchantAccount")
+		}
+		if entry.Amount == nil {
+			if amount, ok := adyen.AmountFrom(source["amount"]); ok {
+				entry.Amount = &amount
+			}
 		}
-		base += fmt.Sprintf("\n*%s:* <@%s>", verb, entry.ApprovedBy)
 	}
+}
 
-	if entry.Details != "" {
-		base += fmt.Sprintf("\n*Details:* %s", entry.Details)
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
 	}
+	return ""
+}
 
-	return base
+// summarize compacts a result and caps its length
+func summarize(result string) string {
+	if result == "" {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(result), &v); err == nil {
+		if compact, err := json.Marshal(v); err == nil {
+			result = string(compact)
+		}
+	}
+	if len(result) > maxSummaryLength {
+		// Cut on a rune boundary so the summary stays valid UTF-8 and hashes stably
+		n := maxSummaryLength
+		for n > 0 && !utf8.RuneStart(result[n]) {
+			n--
+		}
+		result = result[:n] + "…"
+	}
+	return result
 }
@@ -0,0 +1,359 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EventCheckpoint marks a signed checkpoint in the hash chain
+const EventCheckpoint EventType = "checkpoint"
+
+// maxChainRetries bounds how often Link retries after losing a race for the head
+const maxChainRetries = 10
+
+// ErrHeadMoved is returned by a HeadStore when another writer advanced the chain first
+var ErrHeadMoved = errors.New("audit chain head moved")
+
+// Head is the most recent link of the chain
+type Head struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// HeadStore persists the chain head so that sequence numbers are shared by every writer
+type HeadStore interface {
+	Load(ctx context.Context) (Head, error)
+	// CompareAndSwap moves the head from prev to next, or returns ErrHeadMoved
+	CompareAndSwap(ctx context.Context, prev, next Head) error
+}
+
+// Chain links entries together with sequence numbers and SHA-256 hashes,
+// signing every interval-th entry with an HMAC checkpoint
+type Chain struct {
+	store    HeadStore
+	key      []byte
+	interval uint64
+}
+
+// NewChain creates a chain. Checkpoints are disabled if key is empty or interval is zero.
+func NewChain(store HeadStore, key []byte, interval int) *Chain {
+	if interval < 0 {
+		interval = 0
+	}
+	return &Chain{store: store, key: key, interval: uint64(interval)}
+}
+
+// Link assigns the next sequence number to entry and sets its hashes. On
+// failure they are left empty: the head didn't move, so the entry has no
+// place in the chain and must not claim one.
+func (c *Chain) Link(ctx context.Context, entry *Entry) (err error) {
+	defer func() {
+		if err != nil {
+			entry.Sequence, entry.PrevHash, entry.Hash, entry.Signature = 0, "", "", ""
+		}
+	}()
+
+	for attempt := 0; attempt < maxChainRetries; attempt++ {
+		head, err := c.store.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load chain head: %w", err)
+		}
+
+		entry.Sequence = head.Sequence + 1
+		entry.PrevHash = head.Hash
+		entry.Hash = ""
+		entry.Signature = ""
+		entry.Hash = HashEntry(*entry)
+
+		err = c.store.CompareAndSwap(ctx, head, Head{Sequence: entry.Sequence, Hash: entry.Hash})
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrHeadMoved) {
+			return fmt.Errorf("failed to advance chain head: %w", err)
+		}
+	}
+	return fmt.Errorf("failed to advance chain head after %d attempts: %w", maxChainRetries, ErrHeadMoved)
+}
+
+// CheckpointDue returns true if a checkpoint should follow the entry with this sequence
+func (c *Chain) CheckpointDue(sequence uint64) bool {
+	return len(c.key) > 0 && c.interval > 0 && sequence%c.interval == 0
+}
+
+// Sign sets the checkpoint signature on an already linked entry
+func (c *Chain) Sign(entry *Entry) {
+	entry.Signature = SignHash(c.key, entry.Hash)
+}
+
+// HashEntry computes the hash of an entry, excluding its own hash and signature
+func HashEntry(entry Entry) string {
+	entry.Hash = ""
+	entry.Signature = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignHash computes the checkpoint HMAC over an entry hash
+func SignHash(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Problem describes an integrity failure found by Verify
+type Problem struct {
+	Sequence uint64
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("seq %d: %s", p.Sequence, p.Message)
+}
+
+// Verify walks entries in sequence order and reports gaps, duplicates,
+// altered entries, broken links and invalid checkpoint signatures.
+// Signatures are only checked when key is non-empty.
+//
+// The chain must start at entry 1, or at a checkpoint, whose signature
+// vouches for everything before it. When head is the chain head from the
+// HeadStore, the chain must also end there, so entries deleted from the end
+// are reported too; without it only the last checkpoint bounds the chain.
+func Verify(entries []Entry, key []byte, head *Head) []Problem {
+	sorted := append([]Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Sequence < sorted[j].Sequence })
+
+	var problems []Problem
+	var prev *Entry
+	for i := range sorted {
+		e := &sorted[i]
+
+		if e.Sequence == 0 {
+			problems = append(problems, Problem{Sequence: 0, Message: fmt.Sprintf("entry at %s has no sequence number", e.Timestamp)})
+			continue
+		}
+
+		if prev == nil && e.Sequence > 1 && e.EventType != EventCheckpoint {
+			problems = append(problems, Problem{Sequence: e.Sequence, Message: fmt.Sprintf("chain starts late, %s missing", missing(1, e.Sequence-1))})
+		}
+
+		if got := HashEntry(*e); got != e.Hash {
+			problems = append(problems, Problem{Sequence: e.Sequence, Message: "hash mismatch, entry was altered"})
+		}
+
+		if prev != nil {
+			switch {
+			case e.Sequence == prev.Sequence:
+				problems = append(problems, Problem{Sequence: e.Sequence, Message: "duplicate sequence number"})
+			case e.Sequence > prev.Sequence+1:
+				problems = append(problems, Problem{Sequence: e.Sequence, Message: fmt.Sprintf("gap, %s missing", missing(prev.Sequence+1, e.Sequence-1))})
+			case e.PrevHash != prev.Hash:
+				problems = append(problems, Problem{Sequence: e.Sequence, Message: "previous hash does not match, chain broken"})
+			}
+		}
+
+		if e.EventType == EventCheckpoint && len(key) > 0 {
+			if !hmac.Equal([]byte(e.Signature), []byte(SignHash(key, e.Hash))) {
+				problems = append(problems, Problem{Sequence: e.Sequence, Message: "invalid checkpoint signature"})
+			}
+		}
+
+		prev = e
+	}
+
+	if head != nil && head.Sequence > 0 {
+		switch {
+		case prev == nil:
+			problems = append(problems, Problem{Sequence: head.Sequence, Message: fmt.Sprintf("chain head is at %d but no entries were found", head.Sequence)})
+		case prev.Sequence < head.Sequence:
+			problems = append(problems, Problem{Sequence: head.Sequence, Message: fmt.Sprintf("chain truncated, %s missing after the last entry", missing(prev.Sequence+1, head.Sequence))})
+		case prev.Sequence > head.Sequence:
+			problems = append(problems, Problem{Sequence: prev.Sequence, Message: fmt.Sprintf("entries beyond the chain head at %d", head.Sequence)})
+		case prev.Hash != head.Hash:
+			problems = append(problems, Problem{Sequence: prev.Sequence, Message: "last entry does not match the chain head"})
+		}
+	}
+	return problems
+}
+
+// LastCheckpoint returns the sequence of the last checkpoint in entries, or 0
+func LastCheckpoint(entries []Entry) uint64 {
+	var last uint64
+	for _, e := range entries {
+		if e.EventType == EventCheckpoint && e.Sequence > last {
+			last = e.Sequence
+		}
+	}
+	return last
+}
+
+// missing describes the sequence numbers from..to
+func missing(from, to uint64) string {
+	if from == to {
+		return fmt.Sprintf("entry %d", from)
+	}
+	return fmt.Sprintf("entries %d-%d", from, to)
+}
+
+// MemoryHeadStore keeps the head in memory, for single-process use
+type MemoryHeadStore struct {
+	mu   sync.Mutex
+	head Head
+}
+
+func (s *MemoryHeadStore) Load(ctx context.Context) (Head, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head, nil
+}
+
+func (s *MemoryHeadStore) CompareAndSwap(ctx context.Context, prev, next Head) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.head != prev {
+		return ErrHeadMoved
+	}
+	s.head = next
+	return nil
+}
+
+// FileHeadStore keeps the head in a small JSON file next to a local audit log
+type FileHeadStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileHeadStore creates a head store backed by path
+func NewFileHeadStore(path string) *FileHeadStore {
+	return &FileHeadStore{path: path}
+}
+
+func (s *FileHeadStore) Load(ctx context.Context) (Head, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *FileHeadStore) CompareAndSwap(ctx context.Context, prev, next Head) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.read()
+	if err != nil {
+		return err
+	}
+	if current != prev {
+		return ErrHeadMoved
+	}
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileHeadStore) read() (Head, error) {
+	var head Head
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return head, nil
+	}
+	if err != nil {
+		return head, err
+	}
+	err = json.Unmarshal(data, &head)
+	return head, err
+}
+
+// DynamoDBHeadAPI is the subset of the DynamoDB client used by DynamoDBHeadStore
+type DynamoDBHeadAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBHeadStore keeps the head as a single item in the audit table,
+// advanced with a conditional write so concurrent Lambdas can't fork the chain
+type DynamoDBHeadStore struct {
+	client DynamoDBHeadAPI
+	table  string
+}
+
+// NewDynamoDBHeadStore creates a head store in table
+func NewDynamoDBHeadStore(client DynamoDBHeadAPI, table string) *DynamoDBHeadStore {
+	return &DynamoDBHeadStore{client: client, table: table}
+}
+
+var headKey = map[string]types.AttributeValue{
+	"pk": &types.AttributeValueMemberS{Value: "#chain"},
+	"sk": &types.AttributeValueMemberS{Value: "head"},
+}
+
+func (s *DynamoDBHeadStore) Load(ctx context.Context) (Head, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &s.table,
+		Key:            headKey,
+		ConsistentRead: boolPtr(true),
+	})
+	if err != nil {
+		return Head{}, err
+	}
+
+	var head Head
+	if seq, ok := out.Item["seq"].(*types.AttributeValueMemberN); ok {
+		head.Sequence, err = strconv.ParseUint(seq.Value, 10, 64)
+		if err != nil {
+			return Head{}, fmt.Errorf("invalid chain sequence: %w", err)
+		}
+	}
+	if hash, ok := out.Item["hash"].(*types.AttributeValueMemberS); ok {
+		head.Hash = hash.Value
+	}
+	return head, nil
+}
+
+func (s *DynamoDBHeadStore) CompareAndSwap(ctx context.Context, prev, next Head) error {
+	item := map[string]types.AttributeValue{
+		"seq":  &types.AttributeValueMemberN{Value: strconv.FormatUint(next.Sequence, 10)},
+		"hash": &types.AttributeValueMemberS{Value: next.Hash},
+	}
+	for k, v := range headKey {
+		item[k] = v
+	}
+
+	input := &dynamodb.PutItemInput{TableName: &s.table, Item: item}
+	if prev.Sequence == 0 {
+		input.ConditionExpression = stringPtr("attribute_not_exists(pk)")
+	} else {
+		input.ConditionExpression = stringPtr("seq = :prev")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":prev": &types.AttributeValueMemberN{Value: strconv.FormatUint(prev.Sequence, 10)},
+		}
+	}
+
+	_, err := s.client.PutItem(ctx, input)
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return ErrHeadMoved
+	}
+	return err
+}
+
+func boolPtr(b bool) *bool { return &b }
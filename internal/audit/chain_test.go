@@ -0,0 +1,319 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+var testKey = []byte("test-key")
+
+// buildChain links n entries, with a signed checkpoint after every third
+// entry like the Logger writes, and returns them with the chain head
+func buildChain(t *testing.T, n int) ([]Entry, *Head) {
+	t.Helper()
+	ctx := context.Background()
+	store := &MemoryHeadStore{}
+	chain := NewChain(store, testKey, 3)
+
+	var entries []Entry
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for len(entries) < n {
+		e := Entry{Timestamp: ts.Add(time.Duration(len(entries)) * time.Second), UserID: "U1", Action: "get_payment", EventType: EventAllowed}
+		if err := chain.Link(ctx, &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+
+		if chain.CheckpointDue(e.Sequence) && len(entries) < n {
+			cp := Entry{Timestamp: e.Timestamp, Action: "checkpoint", EventType: EventCheckpoint}
+			if err := chain.Link(ctx, &cp); err != nil {
+				t.Fatal(err)
+			}
+			chain.Sign(&cp)
+			entries = append(entries, cp)
+		}
+	}
+
+	head, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries, &head
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(entries []Entry, head *Head) ([]Entry, *Head)
+		key     []byte
+		wantSeq []uint64 // sequence of each problem expected
+		want    string   // substring of the first problem
+	}{
+		{
+			name:   "intact",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) { return e, h },
+			key:    testKey,
+		},
+		{
+			name:   "intact without head",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) { return e, nil },
+			key:    testKey,
+		},
+		{
+			name: "edited entry",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				e[1].Action = "refund_payment"
+				return e, h
+			},
+			wantSeq: []uint64{2},
+			want:    "hash mismatch",
+		},
+		{
+			name: "edited and rehashed entry",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				e[1].Action = "refund_payment"
+				e[1].Hash = HashEntry(e[1])
+				return e, h
+			},
+			// The next entry no longer links to it
+			wantSeq: []uint64{3},
+			want:    "chain broken",
+		},
+		{
+			name: "gap",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return append(e[:2:2], e[4:]...), h
+			},
+			wantSeq: []uint64{5},
+			want:    "gap, entries 3-4 missing",
+		},
+		{
+			name: "duplicate",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return append(e, e[2]), h
+			},
+			wantSeq: []uint64{3},
+			want:    "duplicate sequence number",
+		},
+		{
+			name: "truncated head",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return e[2:], h
+			},
+			wantSeq: []uint64{3},
+			want:    "chain starts late, entries 1-2 missing",
+		},
+		{
+			name: "starts at a checkpoint",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				// Entry 4 is the checkpoint after entry 3
+				return e[3:], h
+			},
+			key: testKey,
+		},
+		{
+			name: "starts at a forged checkpoint",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				e[3].Signature = SignHash([]byte("wrong-key"), e[3].Hash)
+				return e[3:], h
+			},
+			key:     testKey,
+			wantSeq: []uint64{4},
+			want:    "invalid checkpoint signature",
+		},
+		{
+			name: "truncated tail",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return e[:len(e)-2], h
+			},
+			wantSeq: []uint64{10},
+			want:    "chain truncated, entries 9-10 missing",
+		},
+		{
+			name: "truncated tail without head",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				// Undetectable past the last checkpoint; see LastCheckpoint
+				return e[:len(e)-2], nil
+			},
+		},
+		{
+			name: "last entry replaced",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				last := &e[len(e)-1]
+				last.Action = "cancel_payment"
+				last.Hash = HashEntry(*last)
+				return e, h
+			},
+			wantSeq: []uint64{10},
+			want:    "does not match the chain head",
+		},
+		{
+			name: "entries beyond head",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return e, &Head{Sequence: 8, Hash: e[7].Hash}
+			},
+			wantSeq: []uint64{10},
+			want:    "beyond the chain head",
+		},
+		{
+			name: "no sequence",
+			tamper: func(e []Entry, h *Head) ([]Entry, *Head) {
+				return append(e, Entry{Action: "get_payment"}), h
+			},
+			wantSeq: []uint64{0},
+			want:    "no sequence number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, head := buildChain(t, 10)
+			entries, head = tt.tamper(entries, head)
+
+			problems := Verify(entries, tt.key, head)
+			if len(problems) != len(tt.wantSeq) {
+				t.Fatalf("got %d problems, want %d: %v", len(problems), len(tt.wantSeq), problems)
+			}
+			for i, p := range problems {
+				if p.Sequence != tt.wantSeq[i] {
+					t.Errorf("problem %d at seq %d, want %d: %s", i, p.Sequence, tt.wantSeq[i], p)
+				}
+			}
+			if tt.want != "" && !strings.Contains(problems[0].Message, tt.want) {
+				t.Errorf("problem %q, want it to mention %q", problems[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestLastCheckpoint(t *testing.T) {
+	entries, _ := buildChain(t, 10)
+	// Checkpoints follow entries 3, 6 and 9, at 4, 7 and 10
+	if got := LastCheckpoint(entries); got != 10 {
+		t.Errorf("LastCheckpoint = %d, want 10", got)
+	}
+	if got := LastCheckpoint(entries[:3]); got != 0 {
+		t.Errorf("LastCheckpoint without checkpoints = %d, want 0", got)
+	}
+}
+
+func TestLinkConcurrent(t *testing.T) {
+	ctx := context.Background()
+	chain := NewChain(&MemoryHeadStore{}, nil, 0)
+
+	// Writers racing for the head retry until every entry has its own sequence
+	const writers = 5
+	entries := make([]Entry, writers)
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entries[i] = Entry{Action: "get_payment", EventType: EventAllowed}
+			if err := chain.Link(ctx, &entries[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if problems := Verify(entries, nil, nil); len(problems) != 0 {
+		t.Errorf("concurrent links don't verify: %v", problems)
+	}
+}
+
+// brokenHeadStore fails loads or swaps while their error is set
+type brokenHeadStore struct {
+	MemoryHeadStore
+	loadErr, swapErr error
+}
+
+func (s *brokenHeadStore) Load(ctx context.Context) (Head, error) {
+	if s.loadErr != nil {
+		return Head{}, s.loadErr
+	}
+	return s.MemoryHeadStore.Load(ctx)
+}
+
+func (s *brokenHeadStore) CompareAndSwap(ctx context.Context, prev, next Head) error {
+	if s.swapErr != nil {
+		return s.swapErr
+	}
+	return s.MemoryHeadStore.CompareAndSwap(ctx, prev, next)
+}
+
+func TestLinkFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		store *brokenHeadStore
+	}{
+		{"load fails", &brokenHeadStore{loadErr: errors.New("throttled")}},
+		{"swap fails", &brokenHeadStore{swapErr: errors.New("throttled")}},
+		{"head keeps moving", &brokenHeadStore{swapErr: ErrHeadMoved}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			chain := NewChain(tt.store, testKey, 1)
+			// A stale chain position, e.g. from an earlier delivery, is cleared too
+			e := Entry{Action: "refund_payment", Sequence: 7, PrevHash: "old", Hash: "old", Signature: "old"}
+			if err := chain.Link(ctx, &e); err == nil {
+				t.Fatal("Link succeeded")
+			}
+			if e.Sequence != 0 || e.PrevHash != "" || e.Hash != "" || e.Signature != "" {
+				t.Errorf("failed Link left chain fields set: %+v", e)
+			}
+			if head, _ := tt.store.MemoryHeadStore.Load(ctx); head.Sequence != 0 {
+				t.Errorf("head moved to %d", head.Sequence)
+			}
+		})
+	}
+}
+
+func TestDeliverUnchained(t *testing.T) {
+	ctx := context.Background()
+	store := &brokenHeadStore{}
+	sink := NewMemorySink()
+	cfg := &config.Config{Audit: config.AuditConfig{HMACKey: string(testKey), CheckpointInterval: 1}}
+	logger := NewWithSinks(cfg, store, sink)
+
+	if err := logger.LogSync(ctx, Entry{Action: "get_payment", EventType: EventAllowed}); err != nil {
+		t.Fatal(err)
+	}
+	store.swapErr = errors.New("throttled")
+	// The entry was persisted, so the chain failure is logged, not returned
+	if err := logger.LogSync(ctx, Entry{Action: "refund_payment", EventType: EventAllowed}); err != nil {
+		t.Errorf("LogSync = %v, want nil", err)
+	}
+	store.swapErr = nil
+	if err := logger.LogSync(ctx, Entry{Action: "cancel_payment", EventType: EventAllowed}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unchained entry is still written, without a sequence or a
+	// checkpoint, and the chain carries on without a false duplicate
+	var actions []string
+	var sequences []uint64
+	for _, e := range sink.Entries() {
+		actions = append(actions, e.Action)
+		sequences = append(sequences, e.Sequence)
+	}
+	wantActions := []string{"get_payment", "checkpoint", "refund_payment", "cancel_payment", "checkpoint"}
+	wantSequences := []uint64{1, 2, 0, 3, 4}
+	if strings.Join(actions, ",") != strings.Join(wantActions, ",") || fmt.Sprint(sequences) != fmt.Sprint(wantSequences) {
+		t.Errorf("wrote %v %v, want %v %v", actions, sequences, wantActions, wantSequences)
+	}
+
+	head, _ := store.Load(ctx)
+	problems := Verify(sink.Entries(), testKey, &head)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "no sequence number") {
+		t.Errorf("Verify = %v, want only the unchained entry", problems)
+	}
+}
@@ -0,0 +1,282 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// retryBaseDelay is the first backoff between sink retries; it doubles each attempt
+const retryBaseDelay = 200 * time.Millisecond
+
+// ErrNotPersisted is returned when no sink accepted an entry
+var ErrNotPersisted = errors.New("audit entry was not persisted by any sink")
+
+// Spool receives entries that every sink rejected, so they can be recovered later
+type Spool interface {
+	Name() string
+	Put(ctx context.Context, entry Entry) error
+}
+
+// startAsync delivers entries on a background goroutine, buffering up to size
+func (l *Logger) startAsync(size int) {
+	if size < 1 {
+		size = 1
+	}
+	l.queue = make(chan Entry, size)
+	go func() {
+		for entry := range l.queue {
+			// The request may be over by now, so its context can't be used
+			report(entry, l.deliver(context.Background(), entry))
+			l.pending.Done()
+		}
+	}()
+}
+
+// Flush waits until every buffered entry has been delivered or spooled.
+// Lambda handlers must call it before returning, as the process may be frozen.
+func (l *Logger) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit flush: %w", ctx.Err())
+	}
+}
+
+// report makes delivery failures visible in the function logs
+func report(entry Entry, err error) {
+	if err != nil {
+		fmt.Printf("Audit delivery failed for %s %s by %s: %v\n", entry.EventType, entry.Action, entry.UserID, err)
+	}
+}
+
+// LogSync writes an entry before returning, bypassing the buffer. It fails
+// with ErrNotPersisted if no sink accepted the entry, even if it was spooled,
+// and only then.
+func (l *Logger) LogSync(ctx context.Context, entry Entry) error {
+	entry = l.prepare(ctx, entry)
+	err := l.deliver(ctx, entry)
+	report(entry, err)
+	return err
+}
+
+// deliver links an entry into the chain and writes it to every sink with
+// retries, falling back to the spool if all sinks fail. It returns an error
+// wrapping ErrNotPersisted if no sink accepted the entry and nil otherwise;
+// failures that didn't stop the entry being persisted are only logged.
+func (l *Logger) deliver(ctx context.Context, entry Entry) error {
+	// An unchained entry is still written; the verifier reports it
+	report(entry, l.chain.Link(ctx, &entry))
+
+	persisted, err := l.writeWithRetry(ctx, entry)
+	if persisted {
+		report(entry, err)
+		err = nil
+	} else {
+		err = errors.Join(ErrNotPersisted, err, l.spoolEntry(ctx, entry))
+	}
+
+	if entry.Sequence > 0 && l.chain.CheckpointDue(entry.Sequence) {
+		report(entry, l.checkpoint(ctx, entry.Sequence))
+	}
+	return err
+}
+
+// writeWithRetry writes to each sink, retrying failures with exponential
+// backoff. It reports whether at least one sink accepted the entry.
+func (l *Logger) writeWithRetry(ctx context.Context, entry Entry) (bool, error) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		persisted bool
+		errs      []error
+	)
+	for _, sink := range l.sinks {
+		wg.Add(1)
+		go func(sink Sink) {
+			defer wg.Done()
+			err := l.retry(ctx, func() error { return sink.Write(ctx, entry) })
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s sink: %w", sink.Name(), err))
+				return
+			}
+			persisted = true
+		}(sink)
+	}
+	wg.Wait()
+	return persisted, errors.Join(errs...)
+}
+
+func (l *Logger) retry(ctx context.Context, fn func() error) error {
+	delay := retryBaseDelay
+	var err error
+	for attempt := 0; attempt <= l.cfg.Audit.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			}
+			delay *= 2
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (l *Logger) spoolEntry(ctx context.Context, entry Entry) error {
+	if len(l.spools) == 0 {
+		return errors.New("no audit spool configured, entry lost")
+	}
+	var errs []error
+	for _, spool := range l.spools {
+		if err := spool.Put(ctx, entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s spool: %w", spool.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplaySpool re-delivers entries left in a file spool by earlier failures.
+// Entries keep their original chain position; ones that fail again stay spooled.
+func (l *Logger) ReplaySpool(ctx context.Context) error {
+	for _, spool := range l.spools {
+		fileSpool, ok := spool.(*FileSpool)
+		if !ok {
+			continue
+		}
+		err := fileSpool.drain(func(entry Entry) bool {
+			persisted, _ := l.writeWithRetry(ctx, entry)
+			return persisted
+		})
+		if err != nil {
+			return fmt.Errorf("failed to replay audit spool: %w", err)
+		}
+	}
+	return nil
+}
+
+// FileSpool appends undeliverable entries to a local JSON-lines file
+type FileSpool struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSpool creates a spool at path
+func NewFileSpool(path string) *FileSpool {
+	return &FileSpool{path: path}
+}
+
+func (s *FileSpool) Name() string { return "file" }
+
+func (s *FileSpool) Put(ctx context.Context, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// drain calls deliver for each spooled entry and rewrites the spool with
+// the entries it couldn't deliver
+func (s *FileSpool) drain(deliver func(Entry) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var remaining [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil || !deliver(entry) {
+			remaining = append(remaining, line)
+		}
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(remaining) == 0 {
+		return os.Remove(s.path)
+	}
+	var out []byte
+	for _, line := range remaining {
+		out = append(append(out, line...), '\n')
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SQSAPI is the subset of the SQS client used by SQSSpool
+type SQSAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// SQSSpool sends undeliverable entries to a dead-letter queue
+type SQSSpool struct {
+	client   SQSAPI
+	queueURL string
+}
+
+// NewSQSSpool creates a spool sending to queueURL
+func NewSQSSpool(client SQSAPI, queueURL string) *SQSSpool {
+	return &SQSSpool{client: client, queueURL: queueURL}
+}
+
+func (s *SQSSpool) Name() string { return "sqs" }
+
+func (s *SQSSpool) Put(ctx context.Context, entry Entry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    &s.queueURL,
+		MessageBody: stringPtr(string(body)),
+	})
+	return err
+}
@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+// flakySink rejects the next failures writes, then accepts entries
+type flakySink struct {
+	MemorySink
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Write(ctx context.Context, entry Entry) error {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if fail {
+		return errors.New("unavailable")
+	}
+	return s.MemorySink.Write(ctx, entry)
+}
+
+func (s *flakySink) setFailures(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+func testLogger(retries int, sinks ...Sink) *Logger {
+	cfg := &config.Config{Audit: config.AuditConfig{Retries: retries}}
+	return NewWithSinks(cfg, &MemoryHeadStore{}, sinks...)
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	sink := &flakySink{failures: 1}
+	logger := testLogger(1, sink)
+
+	if err := logger.LogSync(context.Background(), Entry{Action: "refund_payment", EventType: EventAttempted}); err != nil {
+		t.Fatalf("LogSync = %v, want nil after a retry", err)
+	}
+	if sink.attempts != 2 || len(sink.Entries()) != 1 {
+		t.Errorf("%d attempts and %d entries, want 2 and 1", sink.attempts, len(sink.Entries()))
+	}
+
+	// Without retries the same failure loses the entry
+	sink = &flakySink{failures: 1}
+	logger = testLogger(0, sink)
+	if err := logger.LogSync(context.Background(), Entry{Action: "refund_payment", EventType: EventAttempted}); !errors.Is(err, ErrNotPersisted) {
+		t.Errorf("LogSync = %v, want ErrNotPersisted", err)
+	}
+}
+
+func TestDeliveryRetryCancelled(t *testing.T) {
+	sink := &flakySink{failures: 100}
+	logger := testLogger(10, sink)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := logger.LogSync(ctx, Entry{Action: "refund_payment", EventType: EventAttempted})
+	if !errors.Is(err, ErrNotPersisted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LogSync = %v, want ErrNotPersisted and the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("LogSync kept retrying for %v after the deadline", elapsed)
+	}
+}
+
+func TestDeliveryPersisted(t *testing.T) {
+	tests := []struct {
+		name   string
+		sinks  []Sink
+		spool  bool
+		wantOK bool
+	}{
+		{
+			// A sink that fails while another accepts the entry is only logged
+			name:   "partial failure",
+			sinks:  []Sink{NewMemorySink(), &flakySink{failures: 100}},
+			wantOK: true,
+		},
+		{
+			name:  "every sink fails",
+			sinks: []Sink{&flakySink{failures: 100}, &flakySink{failures: 100}},
+		},
+		{
+			// Spooling keeps the entry but doesn't persist it
+			name:  "every sink fails, spooled",
+			sinks: []Sink{&flakySink{failures: 100}},
+			spool: true,
+		},
+		{
+			name: "no sinks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := testLogger(0, tt.sinks...)
+			path := filepath.Join(t.TempDir(), "spool.jsonl")
+			if tt.spool {
+				logger.spools = []Spool{NewFileSpool(path)}
+			}
+
+			err := logger.LogSync(context.Background(), Entry{Action: "refund_payment", EventType: EventAttempted})
+			if tt.wantOK && err != nil {
+				t.Errorf("LogSync = %v, want nil", err)
+			}
+			if !tt.wantOK && !errors.Is(err, ErrNotPersisted) {
+				t.Errorf("LogSync = %v, want ErrNotPersisted", err)
+			}
+
+			if tt.spool {
+				data, _ := os.ReadFile(path)
+				if !strings.Contains(string(data), `"refund_payment"`) {
+					t.Errorf("spool holds %q, want the entry", data)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaySpool(t *testing.T) {
+	ctx := context.Background()
+	sink := &flakySink{failures: 100}
+	logger := testLogger(0, sink)
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	logger.spools = []Spool{NewFileSpool(path)}
+
+	for _, action := range []string{"refund_payment", "cancel_payment"} {
+		if err := logger.LogSync(ctx, Entry{Action: action, EventType: EventAttempted}); !errors.Is(err, ErrNotPersisted) {
+			t.Fatalf("LogSync = %v, want ErrNotPersisted", err)
+		}
+	}
+
+	// Entries that still fail stay spooled
+	sink.setFailures(1)
+	if err := logger.ReplaySpool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 || !strings.Contains(string(data), "refund_payment") {
+		t.Errorf("spool after a partial replay = %q, want only refund_payment", data)
+	}
+
+	if err := logger.ReplaySpool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("spool still exists after replay: %v", err)
+	}
+
+	// Replayed entries keep their place in the chain
+	var sequences []uint64
+	for _, e := range sink.Entries() {
+		sequences = append(sequences, e.Sequence)
+	}
+	if len(sequences) != 2 || sequences[0] != 2 || sequences[1] != 1 {
+		t.Errorf("replayed sequences %v, want [2 1]", sequences)
+	}
+}
+
+func TestAsyncDelivery(t *testing.T) {
+	sink := &flakySink{failures: 1}
+	logger := testLogger(1, sink)
+	logger.startAsync(2)
+
+	for i := 0; i < 5; i++ {
+		if err := logger.Log(context.Background(), Entry{Action: "get_payment", EventType: EventAllowed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sink.Entries()); got != 5 {
+		t.Errorf("%d entries delivered after Flush, want 5", got)
+	}
+}
@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// maxArgumentsLength bounds the arguments shown in the Slack post
+const maxArgumentsLength = 300
+
+func getEmoji(eventType EventType) string {
+	switch eventType {
+	case EventAllowed:
+		return ":white_check_mark:"
+	case EventDenied:
+		return ":no_entry:"
+	case EventApproved:
+		return ":heavy_check_mark:"
+	case EventRejected:
+		return ":x:"
+	case EventError:
+		return ":warning:"
+	case EventRevealed:
+		return ":eyes:"
+	case EventAttempted:
+		return ":hourglass_flowing_sand:"
+	case EventRequested:
+		return ":raised_hand:"
+	default:
+		return ":grey_question:"
+	}
+}
+
+// formatEntry renders the plain-text fallback shown in notifications
+func formatEntry(entry Entry, emoji string) string {
+	text := fmt.Sprintf("%s %s | %s by <@%s>", emoji, entry.EventType, entry.Action, entry.UserID)
+	if entry.PSPReference != "" {
+		text += " | " + entry.PSPReference
+	}
+	if entry.Amount != nil {
+		text += " | " + entry.Amount.String()
+	}
+	return text
+}
+
+// entryBlocks renders an entry as a compact Block Kit message
+func entryBlocks(entry Entry, emoji string) []slack.Block {
+	header := slack.NewSectionBlock(
+		slack.NewTextBlockObject(slack.MarkdownType,
+			fmt.Sprintf("%s *%s* | `%s`", emoji, entry.EventType, entry.Action), false, false),
+		nil, nil,
+	)
+
+	var fields []*slack.TextBlockObject
+	addField := func(label, value string) {
+		if value != "" {
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", label, value), false, false))
+		}
+	}
+	addField("User", fmt.Sprintf("<@%s>", entry.UserID))
+	if entry.Channel != "" {
+		addField("Channel", fmt.Sprintf("<#%s>", entry.Channel))
+	}
+	addField("PSP reference", entry.PSPReference)
+	if entry.Amount != nil {
+		addField("Amount", entry.Amount.String())
+	}
+	addField("Merchant account", entry.MerchantAccount)
+	if entry.ApprovedBy != "" {
+		label := "Approved by"
+		if entry.EventType == EventRejected {
+			label = "Rejected by"
+		}
+		addField(label, fmt.Sprintf("<@%s>", entry.ApprovedBy))
+	}
+
+	blocks := []slack.Block{header}
+	if len(fields) > 0 {
+		// Section blocks accept at most 10 fields; we never exceed 6
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+	}
+
+	var detail []string
+	if entry.Details != "" {
+		detail = append(detail, fmt.Sprintf("*Details:* %s", entry.Details))
+	}
+	if args := compactArguments(entry.Arguments); args != "" {
+		detail = append(detail, fmt.Sprintf("*Arguments:* `%s`", args))
+	}
+	if entry.ResultSummary != "" {
+		detail = append(detail, fmt.Sprintf("*Result:* `%s`", entry.ResultSummary))
+	}
+	if len(detail) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, strings.Join(detail, "\n"), false, false),
+			nil, nil,
+		))
+	}
+
+	meta := []string{entry.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC"), entry.Environment}
+	if entry.Duration > 0 {
+		meta = append(meta, entry.Duration.Round(time.Millisecond).String())
+	}
+	if entry.RequestID != "" {
+		meta = append(meta, "req "+entry.RequestID)
+	}
+	if entry.Sequence > 0 {
+		meta = append(meta, fmt.Sprintf("#%d", entry.Sequence))
+	}
+	blocks = append(blocks, slack.NewContextBlock("",
+		slack.NewTextBlockObject(slack.MarkdownType, strings.Join(meta, " · "), false, false),
+	))
+
+	return blocks
+}
+
+func compactArguments(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	if runes := []rune(string(data)); len(runes) > maxArgumentsLength {
+		return string(runes[:maxArgumentsLength]) + "…"
+	}
+	return string(data)
+}
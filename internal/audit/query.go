@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// defaultQueryLimit caps results when a query doesn't set Limit
+const defaultQueryLimit = 50
+
+// ErrNotQueryable is returned when no configured sink can be read back
+var ErrNotQueryable = errors.New("no queryable audit store configured")
+
+// Query filters audit entries. Zero values match everything.
+type Query struct {
+	UserID    string
+	Action    string
+	EventType EventType
+	Channel   string
+	Since     time.Time
+	Until     time.Time
+	Limit     int // Negative returns every match
+
+	// MinAmount matches entries at or above this amount in major units,
+	// restricted to Currency when set
+	MinAmount float64
+	Currency  string
+}
+
+// Match returns true if the entry satisfies every filter. Bookkeeping
+// entries (checkpoints, usage) only match when asked for by event type.
+func (q Query) Match(e Entry) bool {
+	if (e.EventType == EventCheckpoint || e.EventType == EventUsage) && q.EventType != e.EventType {
+		return false
+	}
+	if q.UserID != "" && e.UserID != q.UserID {
+		return false
+	}
+	if q.Action != "" && !strings.Contains(e.Action, q.Action) {
+		return false
+	}
+	if q.EventType != "" && e.EventType != q.EventType {
+		return false
+	}
+	if q.Channel != "" && e.Channel != q.Channel {
+		return false
+	}
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Currency != "" && (e.Amount == nil || !strings.EqualFold(e.Amount.Currency, q.Currency)) {
+		return false
+	}
+	if q.MinAmount > 0 && (e.Amount == nil || e.Amount.Major() < q.MinAmount) {
+		return false
+	}
+	return true
+}
+
+func (q Query) limit() int {
+	if q.Limit > 0 {
+		return q.Limit
+	}
+	return defaultQueryLimit
+}
+
+// Reader is implemented by sinks whose entries can be read back
+type Reader interface {
+	Query(ctx context.Context, q Query) ([]Entry, error)
+}
+
+// Query returns matching entries, newest first, from the first queryable sink
+func (l *Logger) Query(ctx context.Context, q Query) ([]Entry, error) {
+	for _, sink := range l.sinks {
+		if reader, ok := sink.(Reader); ok {
+			return reader.Query(ctx, q)
+		}
+	}
+	return nil, ErrNotQueryable
+}
+
+// filter applies q to entries, sorting newest first and truncating to the limit
+func filter(entries []Entry, q Query) []Entry {
+	var matched []Entry
+	for _, e := range entries {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp.After(matched[j].Timestamp) })
+	if q.Limit >= 0 && len(matched) > q.limit() {
+		matched = matched[:q.limit()]
+	}
+	return matched
+}
+
+func (s *MemorySink) Query(ctx context.Context, q Query) ([]Entry, error) {
+	return filter(s.Entries(), q), nil
+}
+
+func (s *FileSink) Query(ctx context.Context, q Query) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit file: %w", err)
+	}
+	return filter(entries, q), nil
+}
+
+// DynamoDBQueryAPI is the subset of the DynamoDB client used to read entries back
+type DynamoDBQueryAPI interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// Query reads entries back. A user filter uses the partition key; anything
+// else scans the table, which is fine at audit volumes, skipping the chain
+// head kept in the same table.
+func (s *DynamoDBSink) Query(ctx context.Context, q Query) ([]Entry, error) {
+	reader, ok := s.client.(DynamoDBQueryAPI)
+	if !ok {
+		return nil, ErrNotQueryable
+	}
+
+	var entries []Entry
+	collect := func(items []map[string]types.AttributeValue) {
+		for _, item := range items {
+			raw, ok := item["entry"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal([]byte(raw.Value), &e); err == nil && q.Match(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		if q.UserID != "" {
+			input := &dynamodb.QueryInput{
+				TableName:              &s.table,
+				KeyConditionExpression: stringPtr("pk = :user"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":user": &types.AttributeValueMemberS{Value: q.UserID},
+				},
+				ExclusiveStartKey: startKey,
+			}
+			if !q.Since.IsZero() {
+				input.KeyConditionExpression = stringPtr("pk = :user AND sk >= :since")
+				input.ExpressionAttributeValues[":since"] = &types.AttributeValueMemberS{Value: q.Since.UTC().Format(sortKeyLayout)}
+			}
+			out, err := reader.Query(ctx, input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to query audit table: %w", err)
+			}
+			collect(out.Items)
+			startKey = out.LastEvaluatedKey
+		} else {
+			out, err := reader.Scan(ctx, &dynamodb.ScanInput{
+				TableName:        &s.table,
+				FilterExpression: stringPtr("pk <> :head"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":head": headKey["pk"],
+				},
+				ExclusiveStartKey: startKey,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan audit table: %w", err)
+			}
+			collect(out.Items)
+			startKey = out.LastEvaluatedKey
+		}
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	return filter(entries, q), nil
+}
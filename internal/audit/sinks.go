@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// SlackSink posts human-readable entries to the audit channel
+type SlackSink struct {
+	slack   *slackClient.Client
+	channel string
+}
+
+// NewSlackSink creates a sink posting to the given channel
+func NewSlackSink(slack *slackClient.Client, channel string) *SlackSink {
+	return &SlackSink{slack: slack, channel: channel}
+}
+
+func (s *SlackSink) Name() string { return "slack" }
+
+func (s *SlackSink) Write(ctx context.Context, entry Entry) error {
+	// Checkpoints and usage only matter to the durable trail
+	if entry.EventType == EventCheckpoint || entry.EventType == EventUsage {
+		return nil
+	}
+	emoji := getEmoji(entry.EventType)
+	_, err := s.slack.PostBlocksToChannel(s.channel, "", formatEntry(entry, emoji), entryBlocks(entry, emoji)...)
+	return err
+}
+
+// FileSink appends entries as JSON lines to a local file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSink creates a sink appending to path
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+func (s *FileSink) Write(ctx context.Context, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit file: %w", err)
+	}
+	return f.Sync()
+}
+
+// S3API is the subset of the S3 client used by S3Sink
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Sink writes each entry as its own JSON object, partitioned by date
+type S3Sink struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+// NewS3Sink creates a sink writing to bucket under prefix
+func NewS3Sink(client S3API, bucket, prefix string) *S3Sink {
+	return &S3Sink{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (s *S3Sink) Name() string { return "s3" }
+
+func (s *S3Sink) Write(ctx context.Context, entry Entry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+
+	ts := entry.Timestamp.UTC()
+	key := fmt.Sprintf("%s%s/%s-%s-%s.json",
+		s.prefix,
+		ts.Format("2006/01/02"),
+		ts.Format("150405.000000000"),
+		entry.EventType,
+		entryID(entry),
+	)
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: stringPtr("application/json"),
+	})
+	return err
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client used by DynamoDBSink
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// sortKeyLayout is RFC 3339 with a fixed nine-digit fraction, so sort keys
+// compare in time order. RFC3339Nano drops trailing zeros, which puts
+// 12:00:00.5 before 12:00:00.
+const sortKeyLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// DynamoDBSink stores entries in a table keyed by user (pk) and timestamp (sk)
+type DynamoDBSink struct {
+	client DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBSink creates a sink writing to table
+func NewDynamoDBSink(client DynamoDBAPI, table string) *DynamoDBSink {
+	return &DynamoDBSink{client: client, table: table}
+}
+
+func (s *DynamoDBSink) Name() string { return "dynamodb" }
+
+func (s *DynamoDBSink) Write(ctx context.Context, entry Entry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+
+	// Checkpoints have no user; key attributes can't be empty
+	pk := entry.UserID
+	if pk == "" {
+		pk = "#system"
+	}
+
+	item := map[string]types.AttributeValue{
+		"pk":          &types.AttributeValueMemberS{Value: pk},
+		"sk":          &types.AttributeValueMemberS{Value: entry.Timestamp.UTC().Format(sortKeyLayout) + "#" + entryID(entry)},
+		"eventType":   &types.AttributeValueMemberS{Value: string(entry.EventType)},
+		"action":      &types.AttributeValueMemberS{Value: entry.Action},
+		"channel":     &types.AttributeValueMemberS{Value: entry.Channel},
+		"environment": &types.AttributeValueMemberS{Value: entry.Environment},
+		"sequence":    &types.AttributeValueMemberN{Value: strconv.FormatUint(entry.Sequence, 10)},
+		"entry":       &types.AttributeValueMemberS{Value: string(body)},
+	}
+	if entry.RequestID != "" {
+		item["requestId"] = &types.AttributeValueMemberS{Value: entry.RequestID}
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.table,
+		Item:      item,
+	})
+	return err
+}
+
+// MemorySink keeps entries in memory; a stand-in for durable sinks in local runs and tests
+type MemorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewMemorySink creates an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Name() string { return "memory" }
+
+func (s *MemorySink) Write(ctx context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Entries returns a copy of everything written so far
+func (s *MemorySink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+// entryID distinguishes entries logged in the same instant
+func entryID(entry Entry) string {
+	if entry.RequestID != "" {
+		return entry.RequestID
+	}
+	return fmt.Sprintf("%d", entry.Timestamp.UnixNano())
+}
+
+func stringPtr(s string) *string { return &s }
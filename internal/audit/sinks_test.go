@@ -0,0 +1,327 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3 records the objects put to it
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.objects == nil {
+		f.objects = map[string][]byte{}
+	}
+	f.objects[*params.Bucket+"/"+*params.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+// fakeDynamoDB records the items put to it and reads them back, applying
+// the sort key condition and scan filter the sink uses
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	table string
+	items []map[string]types.AttributeValue
+}
+
+func attr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.table = *params.TableName
+	f.items = append(f.items, params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user := attr(params.ExpressionAttributeValues, ":user")
+	since := attr(params.ExpressionAttributeValues, ":since")
+	var items []map[string]types.AttributeValue
+	for _, item := range f.items {
+		if attr(item, "pk") == user && attr(item, "sk") >= since {
+			items = append(items, item)
+		}
+	}
+	return &dynamodb.QueryOutput{Items: items}, nil
+}
+
+func (f *fakeDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if params.FilterExpression == nil || *params.FilterExpression != "pk <> :head" {
+		return &dynamodb.ScanOutput{Items: f.items}, nil
+	}
+	head := attr(params.ExpressionAttributeValues, ":head")
+	var items []map[string]types.AttributeValue
+	for _, item := range f.items {
+		if attr(item, "pk") != head {
+			items = append(items, item)
+		}
+	}
+	return &dynamodb.ScanOutput{Items: items}, nil
+}
+
+func testEntries() []Entry {
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 8, time.UTC)
+	return []Entry{
+		{Timestamp: ts, RequestID: "req-1", UserID: "U1", Action: "get_payment", Channel: "C1", EventType: EventAllowed, Sequence: 1},
+		{Timestamp: ts.Add(time.Second), RequestID: "req-2", UserID: "U2", Action: "refund_payment", Channel: "C1", EventType: EventDenied, Sequence: 2},
+		{Timestamp: ts.Add(2 * time.Second), EventType: EventCheckpoint, Sequence: 3},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := NewFileSink(path)
+
+	// Nothing written yet reads back as nothing
+	entries, err := sink.Query(ctx, Query{Limit: -1})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Query before writing = %v, %v; want no entries", entries, err)
+	}
+
+	for _, e := range testEntries() {
+		if err := sink.Write(ctx, e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	for i, line := range lines {
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+		if e.Sequence != uint64(i+1) {
+			t.Errorf("line %d has sequence %d", i+1, e.Sequence)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string // request IDs, newest first
+	}{
+		{"all", Query{}, []string{"req-2", "req-1"}},
+		{"user", Query{UserID: "U1"}, []string{"req-1"}},
+		{"event type", Query{EventType: EventDenied}, []string{"req-2"}},
+		{"limit", Query{Limit: 1}, []string{"req-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := sink.Query(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requestIDs(entries); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeS3{}
+	sink := NewS3Sink(client, "audit-bucket", "audit/")
+
+	for _, e := range testEntries() {
+		if err := sink.Write(ctx, e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	wantKeys := []string{
+		"audit-bucket/audit/2026/03/04/050607.000000008-allowed-req-1.json",
+		"audit-bucket/audit/2026/03/04/050608.000000008-denied-req-2.json",
+		// Without a request ID the key falls back to the timestamp
+		"audit-bucket/audit/2026/03/04/050609.000000008-checkpoint-1772600769000000008.json",
+	}
+	if len(client.objects) != len(wantKeys) {
+		t.Fatalf("got %d objects, want %d: %v", len(client.objects), len(wantKeys), client.objects)
+	}
+	for i, key := range wantKeys {
+		body, ok := client.objects[key]
+		if !ok {
+			t.Errorf("missing object %s", key)
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatalf("object %s is not JSON: %v", key, err)
+		}
+		if e.Sequence != uint64(i+1) {
+			t.Errorf("object %s has sequence %d, want %d", key, e.Sequence, i+1)
+		}
+	}
+}
+
+func TestDynamoDBSink(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{}
+	sink := NewDynamoDBSink(client, "audit-table")
+
+	for _, e := range testEntries() {
+		if err := sink.Write(ctx, e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if client.table != "audit-table" {
+		t.Errorf("wrote to table %q", client.table)
+	}
+	if len(client.items) != 3 {
+		t.Fatalf("got %d items, want 3", len(client.items))
+	}
+
+	tests := []struct {
+		attr string
+		want []string
+	}{
+		// Checkpoints have no user, and key attributes can't be empty
+		{"pk", []string{"U1", "U2", "#system"}},
+		{"sk", []string{"2026-03-04T05:06:07.000000008Z#req-1", "2026-03-04T05:06:08.000000008Z#req-2", "2026-03-04T05:06:09.000000008Z#1772600769000000008"}},
+		{"eventType", []string{"allowed", "denied", "checkpoint"}},
+		{"sequence", []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attr, func(t *testing.T) {
+			for i, item := range client.items {
+				var got string
+				switch v := item[tt.attr].(type) {
+				case *types.AttributeValueMemberS:
+					got = v.Value
+				case *types.AttributeValueMemberN:
+					got = v.Value
+				}
+				if got != tt.want[i] {
+					t.Errorf("item %d: %s = %q, want %q", i, tt.attr, got, tt.want[i])
+				}
+			}
+		})
+	}
+	if _, ok := client.items[2]["requestId"]; ok {
+		t.Error("an entry without a request ID has a requestId attribute")
+	}
+
+	// Entries read back through Query and Scan
+	entries, err := sink.Query(ctx, Query{UserID: "U2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requestIDs(entries); len(got) != 1 || got[0] != "req-2" {
+		t.Errorf("Query by user = %v, want [req-2]", got)
+	}
+	entries, err = sink.Query(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requestIDs(entries); len(got) != 2 {
+		t.Errorf("Scan = %v, want two entries without the checkpoint", got)
+	}
+}
+
+func TestDynamoDBSinkTimeOrder(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{}
+	sink := NewDynamoDBSink(client, "audit-table")
+
+	midnight := time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Time{
+		midnight.Add(-time.Millisecond),
+		midnight,
+		midnight.Add(500 * time.Millisecond),
+		midnight.Add(time.Second),
+	} {
+		e := Entry{Timestamp: ts, RequestID: fmt.Sprintf("req-%d", i), UserID: "U1", Action: "get_payment", EventType: EventAllowed}
+		if err := sink.Write(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sort keys are fixed width, so they sort like the times they hold
+	var keys []string
+	for _, item := range client.items {
+		keys = append(keys, attr(item, "sk"))
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("sort keys out of time order: %v", keys)
+	}
+
+	// Entries just after a whole second aren't lost from "since:today"
+	entries, err := sink.Query(ctx, Query{UserID: "U1", Since: midnight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(requestIDs(entries), ","); got != "req-3,req-2,req-1" {
+		t.Errorf("Query since midnight = %s, want req-3,req-2,req-1", got)
+	}
+}
+
+func TestDynamoDBSinkSkipsChainHead(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{}
+	sink := NewDynamoDBSink(client, "audit-table")
+	if err := sink.Write(ctx, testEntries()[0]); err != nil {
+		t.Fatal(err)
+	}
+	// The head store keeps its item in the same table, with an entry-like body
+	head := map[string]types.AttributeValue{"entry": &types.AttributeValueMemberS{Value: `{"userId":"U9","eventType":"allowed"}`}}
+	for k, v := range headKey {
+		head[k] = v
+	}
+	client.items = append(client.items, head)
+
+	entries, err := sink.Query(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requestIDs(entries); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("Scan = %v, want only req-1", got)
+	}
+}
+
+func requestIDs(entries []Entry) []string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.RequestID)
+	}
+	return ids
+}
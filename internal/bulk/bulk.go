@@ -0,0 +1,206 @@
+// Package bulk runs one operation over many items with bounded concurrency,
+// reporting progress as items finish.
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+)
+
+// Result is the outcome of one item
+type Result struct {
+	Item   string
+	Output string // empty on error
+	Err    error
+}
+
+// Progress is told how many items have finished and how many of those
+// failed. Calls are serialized.
+type Progress func(done, failed int)
+
+// Run calls fn for every item, at most concurrency at a time, and returns
+// the results in item order. Once ctx is cancelled no more items start;
+// they fail with ctx's error.
+func Run(ctx context.Context, items []string, concurrency int, fn func(ctx context.Context, item string) (string, error), progress Progress) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]Result, len(items))
+
+	var (
+		mu           sync.Mutex
+		done, failed int
+		wg           sync.WaitGroup
+	)
+	cancel := func(i int) {
+		results[i].Err = ctx.Err()
+		mu.Lock()
+		done++
+		failed++
+		mu.Unlock()
+	}
+	slots := make(chan struct{}, concurrency)
+	for i, item := range items {
+		results[i].Item = item
+		// select picks at random when a slot is free too, so check first
+		if ctx.Err() != nil {
+			cancel(i)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			cancel(i)
+			continue
+		case slots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, item string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			output, err := fn(ctx, item)
+			results[i].Output, results[i].Err = output, err
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil {
+				failed++
+			}
+			if progress != nil {
+				progress(done, failed)
+			}
+		}(i, item)
+	}
+	wg.Wait()
+	return results
+}
+
+// References returns the PSP references in text, in order and without duplicates
+func References(text string) []string {
+	return unique(strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}))
+}
+
+// CSVReferences returns the PSP references in any cell of a CSV, in order
+// and without duplicates
+func CSVReferences(data []byte) ([]string, error) {
+	records, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []string
+	for _, record := range records {
+		for _, cell := range record {
+			cells = append(cells, strings.TrimSpace(cell))
+		}
+	}
+	return unique(cells), nil
+}
+
+// ColumnReferences returns the PSP references in a CSV's PSP reference
+// column: one headed like "PSP reference", or else one whose every value
+// below the first row is a PSP reference. It returns false when the CSV has
+// no such column, so unrelated files aren't mistaken for a list of payments.
+func ColumnReferences(data []byte) ([]string, bool, error) {
+	records, err := readCSV(data)
+	if err != nil || len(records) == 0 {
+		return nil, false, err
+	}
+
+	column := -1
+	for i, cell := range records[0] {
+		if isPSPHeader(cell) {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		column = referenceColumn(records)
+	}
+	if column < 0 {
+		return nil, false, nil
+	}
+
+	var cells []string
+	for _, record := range records {
+		if column < len(record) {
+			cells = append(cells, strings.TrimSpace(record[column]))
+		}
+	}
+	refs := unique(cells)
+	return refs, len(refs) > 0, nil
+}
+
+// isPSPHeader returns true for headers like "PSP reference", "psp_reference" or "pspReference"
+func isPSPHeader(cell string) bool {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(cell))
+	return name == "psp" || name == "pspreference" || name == "pspref" || name == "pspreferences"
+}
+
+// referenceColumn finds a column whose every non-empty cell, allowing for a
+// header row, is a PSP reference
+func referenceColumn(records [][]string) int {
+	width := 0
+	for _, record := range records {
+		width = max(width, len(record))
+	}
+	for column := 0; column < width; column++ {
+		found, ok := 0, true
+		for row, record := range records {
+			if column >= len(record) {
+				continue
+			}
+			cell := strings.ToUpper(strings.TrimSpace(record[column]))
+			switch {
+			case cell == "":
+			case detect.IsPSPReference(cell):
+				found++
+			case row > 0:
+				ok = false
+			}
+		}
+		if ok && found > 0 {
+			return column
+		}
+	}
+	return -1
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	return records, nil
+}
+
+func unique(candidates []string) []string {
+	seen := map[string]bool{}
+	var refs []string
+	for _, c := range candidates {
+		c = strings.ToUpper(c)
+		if !detect.IsPSPReference(c) || seen[c] {
+			continue
+		}
+		seen[c] = true
+		refs = append(refs, c)
+	}
+	return refs
+}
@@ -0,0 +1,216 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func items(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("88151234567890%02d", i)
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       int
+		concurrency int
+		wantMax     int32
+	}{
+		{"sequential", 5, 1, 1},
+		{"bounded", 20, 3, 3},
+		{"below one", 5, 0, 1},
+		{"more slots than items", 2, 10, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := items(tt.items)
+			var active, peak int32
+			fn := func(ctx context.Context, item string) (string, error) {
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				// Items ending in 0, 3, 6 or 9 fail
+				if (item[len(item)-1]-'0')%3 == 0 {
+					return "", errors.New("refused")
+				}
+				return "ok " + item, nil
+			}
+
+			var progress [][2]int
+			results := Run(context.Background(), in, tt.concurrency, fn, func(done, failed int) {
+				progress = append(progress, [2]int{done, failed})
+			})
+
+			if peak > tt.wantMax {
+				t.Errorf("%d items ran at once, want at most %d", peak, tt.wantMax)
+			}
+
+			// Results follow the items, whatever order they finished in
+			wantFailed := 0
+			for i, r := range results {
+				if r.Item != in[i] {
+					t.Errorf("result %d is for %s, want %s", i, r.Item, in[i])
+				}
+				if r.Err != nil {
+					wantFailed++
+					if r.Output != "" {
+						t.Errorf("result %d has output %q and error %v", i, r.Output, r.Err)
+					}
+				} else if r.Output != "ok "+in[i] {
+					t.Errorf("result %d output = %q", i, r.Output)
+				}
+			}
+
+			if len(progress) != tt.items {
+				t.Fatalf("progress called %d times, want %d", len(progress), tt.items)
+			}
+			for i, p := range progress {
+				if p[0] != i+1 {
+					t.Errorf("progress call %d reported %d done", i, p[0])
+				}
+			}
+			if last := progress[len(progress)-1]; last[1] != wantFailed {
+				t.Errorf("progress reported %d failed, want %d", last[1], wantFailed)
+			}
+		})
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := items(5)
+	var ran []string
+	var mu sync.Mutex
+	results := Run(ctx, in, 1, func(ctx context.Context, item string) (string, error) {
+		mu.Lock()
+		ran = append(ran, item)
+		mu.Unlock()
+		if item == in[1] {
+			cancel()
+		}
+		return "ok", nil
+	}, nil)
+
+	// Nothing starts after the cancel, even though a slot is free
+	if !reflect.DeepEqual(ran, in[:2]) {
+		t.Errorf("ran %v, want %v", ran, in[:2])
+	}
+	for i, r := range results {
+		switch {
+		case i < 2 && r.Err != nil:
+			t.Errorf("result %d failed: %v", i, r.Err)
+		case i >= 2 && !errors.Is(r.Err, context.Canceled):
+			t.Errorf("result %d = %v, want context.Canceled", i, r.Err)
+		}
+		if r.Item != in[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.Item, in[i])
+		}
+	}
+}
+
+func TestRunCancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	results := Run(ctx, items(3), 2, func(ctx context.Context, item string) (string, error) {
+		called = true
+		return "", nil
+	}, nil)
+	if called {
+		t.Error("an item ran after the context was cancelled")
+	}
+	for i, r := range results {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("result %d = %v, want context.Canceled", i, r.Err)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	got := References("refund 8815123456789012, nc6ht9crt65zgn82\n8815123456789012 and ABCDEFGHIJKLMNOP")
+	want := []string{"8815123456789012", "NC6HT9CRT65ZGN82"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("References = %v, want %v", got, want)
+	}
+}
+
+func TestColumnReferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		want   []string
+		wantOK bool
+	}{
+		{
+			name:   "PSP header",
+			csv:    "Merchant Reference,PSP Reference,Amount\nORDER-1,8815123456789012,10.00\nORDER-2,8815123456789013,5.00\n",
+			want:   []string{"8815123456789012", "8815123456789013"},
+			wantOK: true,
+		},
+		{
+			name:   "snake case header",
+			csv:    "psp_reference\n8815123456789012\n",
+			want:   []string{"8815123456789012"},
+			wantOK: true,
+		},
+		{
+			name:   "unnamed column",
+			csv:    "id,note\n8815123456789012,late\n,missing\n8815123456789013,ok\n",
+			want:   []string{"8815123456789012", "8815123456789013"},
+			wantOK: true,
+		},
+		{
+			// A reference in free text doesn't make the CSV a list of payments
+			name: "references in other cells",
+			csv:  "note,amount\nsee 8815123456789012,10\nnothing here,5\n",
+		},
+		{
+			name: "mixed column",
+			csv:  "ref\n8815123456789012\nORDER-1\n",
+		},
+		{
+			name: "empty",
+			csv:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := ColumnReferences([]byte(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ColumnReferences = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCSVReferences(t *testing.T) {
+	got, err := CSVReferences([]byte("a,b\n8815123456789012,x\ny,8815123456789013\n8815123456789012\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"8815123456789012", "8815123456789013"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CSVReferences = %v, want %v", got, want)
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -11,12 +13,20 @@ type Config struct {
 	Adyen       AdyenConfig       `json:"adyen"`
 	LLM         LLMConfig         `json:"llm"`
 	Permissions PermissionsConfig `json:"permissions"`
+	Redaction   RedactionConfig   `json:"redaction"`
+	Audit       AuditConfig       `json:"audit"`
 	AWS         AWSConfig         `json:"aws"`
+	Bulk        BulkConfig        `json:"bulk"`
+	References  ReferencesConfig  `json:"references"`
 }
 
 type SlackConfig struct {
-	BotToken      string `json:"botToken"`
-	SigningSecret string `json:"signingSecret"`
+	BotToken         string   `json:"botToken"`
+	SigningSecret    string   `json:"signingSecret"`
+	EphemeralReplies []string `json:"ephemeralReplies"` // Reply kinds shown only to the requester
+	AppToken         string   `json:"appToken"`         // App-level token (xapp-) for Socket Mode
+	SocketMode       bool     `json:"socketMode"`       // Receive events over WebSocket instead of HTTP
+	Ack              string   `json:"ack"`              // How the webhook acknowledges a question: none, reaction or message
 }
 
 type AdyenConfig struct {
@@ -26,19 +36,79 @@ type AdyenConfig struct {
 }
 
 type LLMConfig struct {
-	APIKey string `json:"apiKey"`
-	Model  string `json:"model"`
+	APIKey           string     `json:"apiKey"`
+	Model            string     `json:"model"`
+	PromptCaching    bool       `json:"promptCaching"` // Anthropic cache_control breakpoints
+	MaxTokens        int        `json:"maxTokens"`
+	MaxContinuations int        `json:"maxContinuations"` // Follow-up requests when a reply is cut off
+	StopSequences    []string   `json:"stopSequences"`
+	Pricing          LLMPricing `json:"pricing"`
+}
+
+// LLMPricing is the USD price per million tokens, used for cost reporting
+type LLMPricing struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cacheWrite"`
+	CacheRead  float64 `json:"cacheRead"`
 }
 
 type PermissionsConfig struct {
 	Channels     []string `json:"channels"`
 	Admins       []string `json:"admins"` // User IDs who can read+write
 	AuditChannel string   `json:"auditChannel"`
+	Approvals    bool     `json:"approvals"` // Non-admins can request write actions for an admin to approve
+}
+
+type RedactionConfig struct {
+	Fields map[string]string `json:"fields"` // JSON field name -> mask, remove or keep
+}
+
+// AuditConfig selects durable audit sinks, in addition to the Slack audit channel
+type AuditConfig struct {
+	File          string `json:"file"` // JSON-lines file path
+	S3Bucket      string `json:"s3Bucket"`
+	S3Prefix      string `json:"s3Prefix"`
+	DynamoDBTable string `json:"dynamoDBTable"`
+	// HMACKey signs hash chain checkpoints every CheckpointInterval entries
+	HMACKey            string `json:"hmacKey"`
+	CheckpointInterval int    `json:"checkpointInterval"`
+	// Delivery: entries are buffered and retried in the background; if every
+	// sink fails they go to the spool file and/or dead-letter queue
+	Async      bool   `json:"async"`
+	BufferSize int    `json:"bufferSize"`
+	Retries    int    `json:"retries"`
+	SpoolFile  string `json:"spoolFile"`
+	DLQURL     string `json:"dlqURL"`
+	FailClosed bool   `json:"failClosed"` // Block write actions when audit can't be persisted
 }
 
 type AWSConfig struct {
 	Region      string `json:"region"`
 	SQSQueueURL string `json:"sqsQueueURL"`
+	SQSDLQURL   string `json:"sqsDLQURL"` // Dead-letter queue of the processing queue
+	// MaxReceiveCount matches the queue's redrive policy: the delivery after
+	// which a failing message moves to the dead-letter queue
+	MaxReceiveCount  int    `json:"maxReceiveCount"`
+	IdempotencyTable string `json:"idempotencyTable"` // DynamoDB table for at-most-once work
+}
+
+// BulkConfig bounds bulk jobs over lists of PSP references
+type BulkConfig struct {
+	Concurrency int `json:"concurrency"` // Tool calls in flight at once
+	MaxItems    int `json:"maxItems"`    // PSP references per job
+}
+
+// ReferencesConfig sets how references pasted in messages are recognized
+// and looked up before the question reaches the model
+type ReferencesConfig struct {
+	// MerchantPatterns are regular expressions for your merchant references,
+	// e.g. "ORD-[0-9]{8}"
+	MerchantPatterns []string `json:"merchantPatterns"`
+	// MerchantTool looks up a merchant reference, passed as merchantReference;
+	// without one, merchant references are only pointed out to the model
+	MerchantTool string `json:"merchantTool"`
+	MaxLookups   int    `json:"maxLookups"` // References looked up per message
 }
 
 var (
@@ -50,8 +120,12 @@ func Load() *Config {
 	once.Do(func() {
 		cfg = &Config{
 			Slack: SlackConfig{
-				BotToken:      getEnv("SLACK_BOT_TOKEN", ""),
-				SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+				BotToken:         getEnv("SLACK_BOT_TOKEN", ""),
+				SigningSecret:    getEnv("SLACK_SIGNING_SECRET", ""),
+				EphemeralReplies: getEnvList("SLACK_EPHEMERAL_REPLIES", []string{"denial", "reveal", "approval"}),
+				AppToken:         getEnv("SLACK_APP_TOKEN", ""),
+				SocketMode:       getEnvBool("SLACK_SOCKET_MODE", false),
+				Ack:              getEnv("SLACK_ACK", "none"),
 			},
 			Adyen: AdyenConfig{
 				APIKey:      getEnv("ADYEN_API_KEY", ""),
@@ -59,14 +133,47 @@ func Load() *Config {
 				LivePrefix:  getEnv("ADYEN_LIVE_PREFIX", ""),
 			},
 			LLM: LLMConfig{
-				APIKey: getEnv("ANTHROPIC_API_KEY", ""),
-				Model:  getEnv("ANTHROPIC_MODEL", "claude-sonnet-4-20250514"),
+				APIKey:           getEnv("ANTHROPIC_API_KEY", ""),
+				Model:            getEnv("ANTHROPIC_MODEL", "claude-sonnet-4-20250514"),
+				PromptCaching:    getEnvBool("ANTHROPIC_PROMPT_CACHING", true),
+				MaxTokens:        getEnvInt("ANTHROPIC_MAX_TOKENS", 1024),
+				MaxContinuations: getEnvInt("ANTHROPIC_MAX_CONTINUATIONS", 2),
+				StopSequences:    getEnvList("ANTHROPIC_STOP_SEQUENCES", nil),
+				Pricing: LLMPricing{
+					Input:      getEnvFloat("ANTHROPIC_PRICE_INPUT", 3),
+					Output:     getEnvFloat("ANTHROPIC_PRICE_OUTPUT", 15),
+					CacheWrite: getEnvFloat("ANTHROPIC_PRICE_CACHE_WRITE", 3.75),
+					CacheRead:  getEnvFloat("ANTHROPIC_PRICE_CACHE_READ", 0.30),
+				},
 			},
 			Permissions: loadPermissions(),
+			Redaction:   loadRedaction(),
+			Audit: AuditConfig{
+				File:               getEnv("AUDIT_FILE", ""),
+				S3Bucket:           getEnv("AUDIT_S3_BUCKET", ""),
+				S3Prefix:           getEnv("AUDIT_S3_PREFIX", "audit/"),
+				DynamoDBTable:      getEnv("AUDIT_DYNAMODB_TABLE", ""),
+				HMACKey:            getEnv("AUDIT_HMAC_KEY", ""),
+				CheckpointInterval: getEnvInt("AUDIT_CHECKPOINT_INTERVAL", 100),
+				Async:              getEnvBool("AUDIT_ASYNC", true),
+				BufferSize:         getEnvInt("AUDIT_BUFFER_SIZE", 100),
+				Retries:            getEnvInt("AUDIT_RETRIES", 3),
+				SpoolFile:          getEnv("AUDIT_SPOOL_FILE", ""),
+				DLQURL:             getEnv("AUDIT_DLQ_URL", ""),
+				FailClosed:         getEnvBool("AUDIT_FAIL_CLOSED", false),
+			},
 			AWS: AWSConfig{
-				Region:      getEnv("AWS_REGION", "eu-west-1"),
-				SQSQueueURL: getEnv("SQS_QUEUE_URL", ""),
+				Region:           getEnv("AWS_REGION", "eu-west-1"),
+				SQSQueueURL:      getEnv("SQS_QUEUE_URL", ""),
+				SQSDLQURL:        getEnv("SQS_DLQ_URL", ""),
+				MaxReceiveCount:  getEnvInt("SQS_MAX_RECEIVE_COUNT", 3),
+				IdempotencyTable: getEnv("IDEMPOTENCY_DYNAMODB_TABLE", ""),
+			},
+			Bulk: BulkConfig{
+				Concurrency: getEnvInt("BULK_CONCURRENCY", 4),
+				MaxItems:    getEnvInt("BULK_MAX_ITEMS", 200),
 			},
+			References: loadReferences(),
 		}
 	})
 	return cfg
@@ -91,9 +198,92 @@ func loadPermissions() PermissionsConfig {
 	return defaultPerms
 }
 
+func loadRedaction() RedactionConfig {
+	// Default rules cover the shopper and card fields returned by Adyen - override with REDACTION_JSON
+	defaultRedaction := RedactionConfig{
+		Fields: map[string]string{
+			"shopperEmail":      "mask",
+			"shopperName":       "mask",
+			"firstName":         "mask",
+			"lastName":          "mask",
+			"shopperIP":         "mask",
+			"telephoneNumber":   "mask",
+			"billingAddress":    "remove",
+			"deliveryAddress":   "remove",
+			"cardBin":           "mask",
+			"cardSummary":       "mask",
+			"cardHolderName":    "mask",
+			"iban":              "mask",
+			"ownerName":         "mask",
+			"pspReference":      "keep",
+			"originalReference": "keep",
+			"merchantReference": "keep",
+		},
+	}
+
+	if redactionJSON := os.Getenv("REDACTION_JSON"); redactionJSON != "" {
+		var redaction RedactionConfig
+		if err := json.Unmarshal([]byte(redactionJSON), &redaction); err == nil {
+			return redaction
+		}
+	}
+
+	return defaultRedaction
+}
+
+func loadReferences() ReferencesConfig {
+	// PSP references and payment link IDs are always recognized - add merchant references with REFERENCES_JSON
+	references := ReferencesConfig{MaxLookups: 3}
+	if referencesJSON := os.Getenv("REFERENCES_JSON"); referencesJSON != "" {
+		json.Unmarshal([]byte(referencesJSON), &references)
+	}
+	return references
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated variable, dropping empty items
+func getEnvList(key string, fallback []string) []string {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,142 @@
+// Package detect recognizes payment references pasted in messages, so they
+// can be looked up without waiting for the model to work out what they are.
+package detect
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+// Kind is the type of a recognized reference
+type Kind string
+
+const (
+	PSPReference      Kind = "PSP reference"
+	PaymentLink       Kind = "payment link"
+	MerchantReference Kind = "merchant reference"
+)
+
+var (
+	// PSP references are 16 letters and digits; requiring a digit keeps
+	// long words from matching
+	pspPattern = regexp.MustCompile(`\b[A-Z0-9]{16}\b`)
+	// Payment link IDs start with PL, alone or at the end of the link's URL
+	linkPattern = regexp.MustCompile(`\bPL[A-Z0-9]{14,18}\b`)
+)
+
+// Match is a reference found in a message
+type Match struct {
+	Kind  Kind
+	Value string
+}
+
+// Detector finds references in text
+type Detector struct {
+	merchant []*regexp.Regexp
+}
+
+// New creates a detector for PSP references, payment link IDs and the
+// configured merchant reference patterns. Invalid patterns are logged and
+// skipped.
+func New(cfg *config.Config) *Detector {
+	d := &Detector{}
+	for _, pattern := range cfg.References.MerchantPatterns {
+		re, err := regexp.Compile(`\b(?:` + pattern + `)\b`)
+		if err != nil {
+			fmt.Printf("Ignoring invalid merchant reference pattern %q: %v\n", pattern, err)
+			continue
+		}
+		d.merchant = append(d.merchant, re)
+	}
+	return d
+}
+
+// IsPSPReference returns true if s is exactly a PSP reference
+func IsPSPReference(s string) bool {
+	return len(s) == 16 && pspPattern.MatchString(s) && strings.ContainsAny(s, "0123456789")
+}
+
+// Find returns the references in text, in order of appearance and without
+// duplicates. A value matching more than one kind counts as the first of
+// payment link, PSP reference and merchant reference: a 16-character link
+// ID also looks like a PSP reference, but its PL prefix settles it.
+func (d *Detector) Find(text string) []Match {
+	type found struct {
+		Match
+		at int
+	}
+	var all []found
+	seen := map[string]bool{}
+	add := func(kind Kind, re *regexp.Regexp, accept func(string) bool) {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			value := text[loc[0]:loc[1]]
+			if seen[value] || !accept(value) {
+				continue
+			}
+			seen[value] = true
+			all = append(all, found{Match{kind, value}, loc[0]})
+		}
+	}
+	anything := func(string) bool { return true }
+
+	add(PaymentLink, linkPattern, anything)
+	add(PSPReference, pspPattern, IsPSPReference)
+	for _, re := range d.merchant {
+		add(MerchantReference, re, anything)
+	}
+
+	// Order of appearance, so replies follow the message
+	for i := 1; i < len(all); i++ {
+		for j := i; j > 0 && all[j].at < all[j-1].at; j-- {
+			all[j], all[j-1] = all[j-1], all[j]
+		}
+	}
+	matches := make([]Match, len(all))
+	for i, f := range all {
+		matches[i] = f.Match
+	}
+	return matches
+}
+
+// Link returns the reference an Adyen URL points at: a payment in the
+// Customer Area (ca-test.adyen.com, ca-live.adyen.com) or a payment link
+// (pay.adyen.com, adyen.link and Checkout's pay-by-link page). Other hosts
+// never match, whatever their path says.
+func Link(rawURL string) (Match, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Match{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case strings.HasPrefix(host, "ca-") && strings.HasSuffix(host, ".adyen.com"):
+		if psp := u.Query().Get("pspReference"); IsPSPReference(psp) {
+			return Match{PSPReference, psp}, true
+		}
+		// Newer Customer Area pages carry the reference in the path
+		for _, psp := range pspPattern.FindAllString(u.Path, -1) {
+			if IsPSPReference(psp) {
+				return Match{PSPReference, psp}, true
+			}
+		}
+	case host == "pay.adyen.com", host == "adyen.link", strings.HasSuffix(host, ".adyen.link"),
+		strings.HasPrefix(host, "checkoutshopper-") && strings.HasSuffix(host, ".adyen.com"):
+		if id := linkPattern.FindString(u.Path + " " + u.RawQuery); id != "" {
+			return Match{PaymentLink, id}, true
+		}
+	}
+	return Match{}, false
+}
+
+// Strip removes the matches from text, leaving whatever was asked about them
+func Strip(text string, matches []Match) string {
+	for _, m := range matches {
+		text = strings.ReplaceAll(text, m.Value, "")
+	}
+	return strings.TrimSpace(text)
+}
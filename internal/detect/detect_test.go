@@ -0,0 +1,129 @@
+package detect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+func TestIsPSPReference(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"8815123456789012", true},
+		{"NC6HT9CRT65ZGN82", true},
+		{"ABCDEFGHIJKLMNOP", false}, // no digit
+		{"881512345678901", false},  // 15 characters
+		{"88151234567890123", false},
+		{"8815-12345678901", false},
+		{"nc6ht9crt65zgn82", false},
+	}
+	for _, tt := range tests {
+		if got := IsPSPReference(tt.in); got != tt.want {
+			t.Errorf("IsPSPReference(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	d := New(&config.Config{References: config.ReferencesConfig{
+		MerchantPatterns: []string{`ORD-\d{6}`, `(`}, // the invalid one is skipped
+	}})
+
+	tests := []struct {
+		name string
+		in   string
+		want []Match
+	}{
+		{
+			name: "PSP reference",
+			in:   "what happened to 8815123456789012?",
+			want: []Match{{PSPReference, "8815123456789012"}},
+		},
+		{
+			name: "payment link",
+			in:   "is PL61C53A8B97E6915A paid",
+			want: []Match{{PaymentLink, "PL61C53A8B97E6915A"}},
+		},
+		{
+			// 16 characters, so it looks like a PSP reference too
+			name: "payment link of PSP length",
+			in:   "is PL61C53A8B97E691 paid",
+			want: []Match{{PaymentLink, "PL61C53A8B97E691"}},
+		},
+		{
+			name: "merchant reference",
+			in:   "order ORD-123456 please",
+			want: []Match{{MerchantReference, "ORD-123456"}},
+		},
+		{
+			name: "order of appearance",
+			in:   "ORD-123456, PL61C53A8B97E6915A and 8815123456789012",
+			want: []Match{
+				{MerchantReference, "ORD-123456"},
+				{PaymentLink, "PL61C53A8B97E6915A"},
+				{PSPReference, "8815123456789012"},
+			},
+		},
+		{
+			name: "duplicates",
+			in:   "8815123456789012 and again 8815123456789012",
+			want: []Match{{PSPReference, "8815123456789012"}},
+		},
+		{
+			name: "words and short numbers",
+			in:   "ABCDEFGHIJKLMNOP 12345 ORD-12345",
+			want: []Match{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Find(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		url    string
+		want   Match
+		wantOK bool
+	}{
+		{"https://ca-test.adyen.com/ca/ca/accounts/showTx.shtml?pspReference=8815123456789012&txType=Payment", Match{PSPReference, "8815123456789012"}, true},
+		{"https://ca-live.adyen.com/ca/ca/payments/8815123456789012", Match{PSPReference, "8815123456789012"}, true},
+		{"https://pay.adyen.com/PL61C53A8B97E6915A", Match{PaymentLink, "PL61C53A8B97E6915A"}, true},
+		{"https://eu.adyen.link/PL61C53A8B97E6915A", Match{PaymentLink, "PL61C53A8B97E6915A"}, true},
+		{"https://checkoutshopper-test.adyen.com/checkoutshopper/payByLink.shtml?d=PL61C53A8B97E6915A", Match{PaymentLink, "PL61C53A8B97E6915A"}, true},
+		{"https://ca-test.adyen.com/ca/ca/overview/default.shtml", Match{}, false},
+		{"https://example.com/?pspReference=8815123456789012", Match{}, false},
+		{"https://pay.adyen.com.example.com/PL61C53A8B97E6915A", Match{}, false},
+		{"://not a url", Match{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Link(tt.url)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Link(%q) = %v, %v; want %v, %v", tt.url, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	matches := []Match{{PSPReference, "8815123456789012"}, {PaymentLink, "PL61C53A8B97E6915A"}}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"8815123456789012", ""},
+		{" PL61C53A8B97E6915A 8815123456789012 ", ""},
+		{"why was 8815123456789012 refused?", "why was  refused?"},
+	}
+	for _, tt := range tests {
+		if got := Strip(tt.in, matches); got != tt.want {
+			t.Errorf("Strip(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
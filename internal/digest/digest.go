@@ -0,0 +1,300 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/permissions"
+	"github.com/slack-go/slack"
+)
+
+// topN is how many users and tools are listed in each ranking
+const topN = 5
+
+// Period is the window a digest covers
+type Period string
+
+const (
+	Daily  Period = "daily"
+	Weekly Period = "weekly"
+)
+
+// Window returns the last complete day or week (Monday to Monday) before now, in UTC
+func (p Period) Window(now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case Daily:
+		return today.AddDate(0, 0, -1), today, nil
+	case Weekly:
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, -7), monday, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q, use daily or weekly", p)
+}
+
+// Count is a ranked key, e.g. a user or tool with its number of actions
+type Count struct {
+	Key   string
+	Count int
+}
+
+// Report aggregates bot activity over a window
+type Report struct {
+	Period Period
+	Since  time.Time
+	Until  time.Time
+
+	Requests int
+	Reads    int
+	Writes   int
+	Denials  int
+	Errors   int
+
+	// Refunded sums refunds per currency, in minor units
+	Refunded map[string]int64
+
+	TopUsers   []Count
+	TopDenied  []Count
+	TopErrored []Count
+
+	Tokens  int
+	CostUSD float64
+	LLMP95  time.Duration
+	ToolP95 time.Duration
+}
+
+// Build reads the window from the audit store and aggregates it
+func Build(ctx context.Context, logger *audit.Logger, period Period, now time.Time) (*Report, error) {
+	since, until, err := period.Window(now)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := logger.Query(ctx, audit.Query{Since: since, Until: until, Limit: -1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit entries: %w", err)
+	}
+	usage, err := logger.Query(ctx, audit.Query{EventType: audit.EventUsage, Since: since, Until: until, Limit: -1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage entries: %w", err)
+	}
+
+	report := Summarize(append(actions, usage...))
+	report.Period, report.Since, report.Until = period, since, until
+	return report, nil
+}
+
+// Summarize aggregates entries that have already been filtered to a window.
+// A request is counted once however many entries it logged, including ones
+// that never reached the LLM, such as forms, approvals and detected references.
+func Summarize(entries []audit.Entry) *Report {
+	r := &Report{Refunded: map[string]int64{}}
+	requests := map[string]bool{}
+	users := map[string]int{}
+	denied := map[string]int{}
+	errored := map[string]int{}
+	var llmDurations, toolDurations []time.Duration
+
+	for _, e := range entries {
+		switch {
+		case e.EventType == audit.EventCheckpoint:
+		case e.RequestID != "":
+			requests[e.RequestID] = true
+		case e.EventType == audit.EventUsage:
+			// Entries without an ID can't be grouped; count their LLM calls
+			r.Requests++
+		}
+
+		switch e.EventType {
+		case audit.EventUsage:
+			if e.Usage != nil {
+				r.Tokens += e.Usage.InputTokens + e.Usage.OutputTokens + e.Usage.CacheWriteTokens + e.Usage.CacheReadTokens
+				r.CostUSD += e.Usage.CostUSD
+			}
+			llmDurations = append(llmDurations, e.Duration)
+		case audit.EventAllowed:
+			if permissions.IsWriteAction(e.Action) {
+				r.Writes++
+			} else {
+				r.Reads++
+			}
+			if strings.Contains(e.Action, "refund") && e.Amount != nil {
+				r.Refunded[strings.ToUpper(e.Amount.Currency)] += e.Amount.Value
+			}
+			users[e.UserID]++
+			if e.Duration > 0 {
+				toolDurations = append(toolDurations, e.Duration)
+			}
+		case audit.EventDenied:
+			r.Denials++
+			denied[e.Action]++
+		case audit.EventError:
+			r.Errors++
+			errored[e.Action]++
+			if e.Duration > 0 {
+				toolDurations = append(toolDurations, e.Duration)
+			}
+		}
+	}
+
+	r.Requests += len(requests)
+	r.TopUsers = rank(users)
+	r.TopDenied = rank(denied)
+	r.TopErrored = rank(errored)
+	r.LLMP95 = percentile(llmDurations, 0.95)
+	r.ToolP95 = percentile(toolDurations, 0.95)
+	return r
+}
+
+// rank returns the topN keys by count, ties broken alphabetically
+func rank(counts map[string]int) []Count {
+	ranked := make([]Count, 0, len(counts))
+	for key, n := range counts {
+		ranked = append(ranked, Count{Key: key, Count: n})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Key < ranked[j].Key
+	})
+	if len(ranked) > topN {
+		ranked = ranked[:topN]
+	}
+	return ranked
+}
+
+// percentile uses the nearest-rank method
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(float64(len(sorted))*p)) - 1
+	return sorted[max(idx, 0)]
+}
+
+// Title is the digest headline, also used as the notification text
+func (r *Report) Title() string {
+	if r.Period == Weekly {
+		return fmt.Sprintf("Weekly digest: %s – %s", r.Since.Format("Jan 2"), r.Until.AddDate(0, 0, -1).Format("Jan 2, 2006"))
+	}
+	return fmt.Sprintf("Daily digest: %s", r.Since.Format("Mon Jan 2, 2006"))
+}
+
+// Blocks renders the report for Slack
+func (r *Report) Blocks() []slack.Block {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, r.Title(), false, false)),
+	}
+
+	field := func(label, value string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", label, value), false, false)
+	}
+	blocks = append(blocks, slack.NewSectionBlock(nil, []*slack.TextBlockObject{
+		field("Requests", fmt.Sprintf("%d", r.Requests)),
+		field("Reads / writes", fmt.Sprintf("%d / %d", r.Reads, r.Writes)),
+		field("Denials", fmt.Sprintf("%d", r.Denials)),
+		field("Errors", fmt.Sprintf("%d", r.Errors)),
+		field("Refunded", r.refundedText()),
+		field("LLM cost", fmt.Sprintf("$%.2f (%s tokens)", r.CostUSD, formatCount(r.Tokens))),
+		field("p95 latency", fmt.Sprintf("LLM %s · tools %s", formatDuration(r.LLMP95), formatDuration(r.ToolP95))),
+	}, nil))
+
+	var rankings []string
+	if len(r.TopUsers) > 0 {
+		rankings = append(rankings, "*Top users:* "+joinCounts(r.TopUsers, func(k string) string { return fmt.Sprintf("<@%s>", k) }))
+	}
+	if len(r.TopDenied) > 0 {
+		rankings = append(rankings, "*Most denied:* "+joinCounts(r.TopDenied, codeKey))
+	}
+	if len(r.TopErrored) > 0 {
+		rankings = append(rankings, "*Most errors:* "+joinCounts(r.TopErrored, codeKey))
+	}
+	if len(rankings) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, strings.Join(rankings, "\n"), false, false),
+			nil, nil,
+		))
+	}
+
+	blocks = append(blocks, slack.NewContextBlock("",
+		slack.NewTextBlockObject(slack.MarkdownType,
+			fmt.Sprintf("%s to %s UTC", r.Since.Format("2006-01-02 15:04"), r.Until.Format("2006-01-02 15:04")), false, false),
+	))
+	return blocks
+}
+
+// Text renders the report as plain text, for the CLI
+func (r *Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", r.Title())
+	fmt.Fprintf(&b, "Requests: %d\nReads: %d\nWrites: %d\nDenials: %d\nErrors: %d\n", r.Requests, r.Reads, r.Writes, r.Denials, r.Errors)
+	fmt.Fprintf(&b, "Refunded: %s\n", r.refundedText())
+	fmt.Fprintf(&b, "LLM cost: $%.2f (%s tokens)\n", r.CostUSD, formatCount(r.Tokens))
+	fmt.Fprintf(&b, "p95 latency: LLM %s, tools %s\n", formatDuration(r.LLMP95), formatDuration(r.ToolP95))
+	for _, c := range r.TopUsers {
+		fmt.Fprintf(&b, "  user %s: %d\n", c.Key, c.Count)
+	}
+	for _, c := range r.TopDenied {
+		fmt.Fprintf(&b, "  denied %s: %d\n", c.Key, c.Count)
+	}
+	for _, c := range r.TopErrored {
+		fmt.Fprintf(&b, "  error %s: %d\n", c.Key, c.Count)
+	}
+	return b.String()
+}
+
+func (r *Report) refundedText() string {
+	if len(r.Refunded) == 0 {
+		return "nothing"
+	}
+	currencies := make([]string, 0, len(r.Refunded))
+	for currency := range r.Refunded {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	parts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		parts[i] = adyen.Amount{Value: r.Refunded[currency], Currency: currency}.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func joinCounts(counts []Count, label func(string) string) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s (%d)", label(c.Key), c.Count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func codeKey(k string) string { return "`" + k + "`" }
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "n/a"
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func formatCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}
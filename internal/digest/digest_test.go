@@ -0,0 +1,82 @@
+package digest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+)
+
+func TestSummarize(t *testing.T) {
+	eur := func(v int64) *adyen.Amount { return &adyen.Amount{Value: v, Currency: "EUR"} }
+	usage := &audit.Usage{InputTokens: 1000, OutputTokens: 200, CacheReadTokens: 300, CostUSD: 0.01}
+	entries := []audit.Entry{
+		// A question answered through the LLM with two tool calls
+		{RequestID: "r1", EventType: audit.EventAllowed, UserID: "U1", Action: "get_payment", Duration: 100 * time.Millisecond},
+		{RequestID: "r1", EventType: audit.EventAllowed, UserID: "U1", Action: "list_payments", Duration: 300 * time.Millisecond},
+		{RequestID: "r1", EventType: audit.EventUsage, UserID: "U1", Usage: usage, Duration: 2 * time.Second},
+		// A refund from a form, which never reaches the LLM
+		{RequestID: "r2", EventType: audit.EventAttempted, UserID: "U2", Action: "refund_payment"},
+		{RequestID: "r2", EventType: audit.EventAllowed, UserID: "U2", Action: "refund_payment", Amount: eur(1250), Duration: 500 * time.Millisecond},
+		// A denied write, and a detected reference that failed
+		{RequestID: "r3", EventType: audit.EventDenied, UserID: "U3", Action: "cancel_payment"},
+		{RequestID: "r4", EventType: audit.EventError, UserID: "U1", Action: "get_payment", Duration: time.Second},
+		// An approved refund in another currency
+		{RequestID: "r5", EventType: audit.EventApproved, UserID: "UADMIN", Action: "refund_payment"},
+		{RequestID: "r5", EventType: audit.EventAllowed, UserID: "U2", Action: "refund_payment", Amount: &adyen.Amount{Value: 990, Currency: "usd"}},
+		// An LLM call logged before entries carried request IDs
+		{EventType: audit.EventUsage, UserID: "U1", Usage: usage, Duration: time.Second},
+		// Bookkeeping isn't a request
+		{EventType: audit.EventCheckpoint, Action: "checkpoint"},
+	}
+
+	r := Summarize(entries)
+
+	if r.Requests != 6 {
+		t.Errorf("Requests = %d, want 6", r.Requests)
+	}
+	if r.Reads != 2 || r.Writes != 2 || r.Denials != 1 || r.Errors != 1 {
+		t.Errorf("reads/writes/denials/errors = %d/%d/%d/%d, want 2/2/1/1", r.Reads, r.Writes, r.Denials, r.Errors)
+	}
+	if want := map[string]int64{"EUR": 1250, "USD": 990}; !reflect.DeepEqual(r.Refunded, want) {
+		t.Errorf("Refunded = %v, want %v", r.Refunded, want)
+	}
+	if want := []Count{{"U1", 2}, {"U2", 2}}; !reflect.DeepEqual(r.TopUsers, want) {
+		t.Errorf("TopUsers = %v, want %v", r.TopUsers, want)
+	}
+	if want := []Count{{"cancel_payment", 1}}; !reflect.DeepEqual(r.TopDenied, want) {
+		t.Errorf("TopDenied = %v, want %v", r.TopDenied, want)
+	}
+	if r.Tokens != 3000 || r.CostUSD != 0.02 {
+		t.Errorf("Tokens, CostUSD = %d, %v; want 3000, 0.02", r.Tokens, r.CostUSD)
+	}
+	if r.LLMP95 != 2*time.Second || r.ToolP95 != time.Second {
+		t.Errorf("LLMP95, ToolP95 = %v, %v; want 2s, 1s", r.LLMP95, r.ToolP95)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2026, 3, 4, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		period      Period
+		since, till time.Time
+	}{
+		{Daily, time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{Weekly, time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		since, until, err := tt.period.Window(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !since.Equal(tt.since) || !until.Equal(tt.till) {
+			t.Errorf("%s window = %v – %v, want %v – %v", tt.period, since, until, tt.since, tt.till)
+		}
+	}
+	if _, _, err := Period("monthly").Window(now); err == nil {
+		t.Error("Window accepted an unknown period")
+	}
+}
@@ -0,0 +1,382 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	"github.com/slack-go/slack"
+)
+
+// CallbackID identifies tool form modals in interaction payloads
+const CallbackID = "tool_form"
+
+// OpenAction is the action ID of buttons that open a tool form; the button value is the tool name
+const OpenAction = "open_form"
+
+// valueAction is the action ID of every input element in a form
+const valueAction = "value"
+
+// channelBlock is the block ID of the "post result in" conversation picker
+const channelBlock = "channel|"
+
+// maxTitle is Slack's limit on modal titles
+const maxTitle = 24
+
+// maxOptions is Slack's limit on static select options; longer enums use a text input
+const maxOptions = 100
+
+// Input kinds, encoded in block IDs as "kind|property" so a submission can be
+// parsed without the tool's schema (the webhook validates before queueing)
+const (
+	kindText     = "text"
+	kindInteger  = "integer"
+	kindNumber   = "number"
+	kindEnum     = "enum"
+	kindBool     = "bool"
+	kindDateTime = "datetime"
+	kindJSON     = "json"
+	kindAmount   = "amount"   // value in major units
+	kindCurrency = "currency" // currency of the amount with the same property name
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Za-z]{3}$`)
+
+// Loading is the placeholder modal opened straight from a click, while the
+// processor fetches the tool's schema and builds the real form
+func Loading(toolName string) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      CallbackID,
+		PrivateMetadata: toolName,
+		Title:           plain(Title(toolName)),
+		Close:           plain("Cancel"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, ":hourglass_flowing_sand: Loading form…", false, false), nil, nil),
+		}},
+	}
+}
+
+// Message is a modal showing only text, e.g. when a form can't be offered
+func Message(toolName, text string) slack.ModalViewRequest {
+	view := Loading(toolName)
+	view.Blocks = slack.Blocks{BlockSet: []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}}
+	return view
+}
+
+// Build creates a form modal from the tool's input schema. Enums become
+// selects, amounts are entered in major units with a currency, and required
+// properties are required inputs.
+func Build(tool llm.Tool) slack.ModalViewRequest {
+	view := Loading(tool.Name)
+	view.Submit = plain("Submit")
+
+	blocks := []slack.Block{}
+	if tool.Description != "" {
+		blocks = append(blocks, slack.NewContextBlock("",
+			slack.NewTextBlockObject(slack.MarkdownType, truncate(tool.Description, 300), false, false)))
+	}
+	for _, field := range Fields(tool) {
+		blocks = append(blocks, field.inputs()...)
+	}
+
+	// Results are posted in a channel, which is also where permissions are checked
+	picker := slack.NewOptionsSelectBlockElement(slack.OptTypeConversations, plain("Choose a channel"), valueAction)
+	picker.DefaultToCurrentConversation = true
+	blocks = append(blocks, slack.NewInputBlock(channelBlock, plain("Post the result in"), nil, picker))
+
+	view.Blocks = slack.Blocks{BlockSet: blocks}
+	return view
+}
+
+// Field is a top-level property of a tool's input schema
+type Field struct {
+	Name        string
+	Type        string
+	Format      string
+	Description string
+	Enum        []string
+	Required    bool
+	// Amount is set for Adyen amount objects ({value, currency})
+	Amount bool
+}
+
+// Fields lists the tool's input properties, required ones first
+func Fields(tool llm.Tool) []Field {
+	properties, _ := tool.InputSchema["properties"].(map[string]interface{})
+	required := map[string]bool{}
+	if list, ok := tool.InputSchema["required"].([]interface{}); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	fields := make([]Field, 0, len(properties))
+	for name, raw := range properties {
+		prop, _ := raw.(map[string]interface{})
+		field := Field{Name: name, Required: required[name]}
+		field.Type, _ = prop["type"].(string)
+		field.Format, _ = prop["format"].(string)
+		field.Description, _ = prop["description"].(string)
+		if values, ok := prop["enum"].([]interface{}); ok {
+			for _, v := range values {
+				field.Enum = append(field.Enum, fmt.Sprint(v))
+			}
+		}
+		if nested, ok := prop["properties"].(map[string]interface{}); ok && field.Type == "object" {
+			_, hasValue := nested["value"]
+			_, hasCurrency := nested["currency"]
+			field.Amount = hasValue && hasCurrency
+		}
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Required != fields[j].Required {
+			return fields[i].Required
+		}
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// kind picks the input used for the field
+func (f Field) kind() string {
+	switch {
+	case f.Amount:
+		return kindAmount
+	case len(f.Enum) > 0 && len(f.Enum) <= maxOptions:
+		return kindEnum
+	case f.Type == "boolean":
+		return kindBool
+	case f.Type == "integer":
+		return kindInteger
+	case f.Type == "number":
+		return kindNumber
+	case f.Type == "string" && f.Format == "date-time":
+		return kindDateTime
+	case f.Type == "object" || f.Type == "array":
+		return kindJSON
+	}
+	return kindText
+}
+
+func (f Field) inputs() []slack.Block {
+	label := Label(f.Name)
+	hint := truncate(f.Description, 150)
+
+	var element slack.BlockElement
+	switch f.kind() {
+	case kindAmount:
+		value := slack.NewNumberInputBlockElement(plain("e.g. 10.50"), valueAction, true)
+		value.MinValue = "0"
+		currency := slack.NewPlainTextInputBlockElement(plain("e.g. EUR"), valueAction)
+		currency.MaxLength = 3
+		return []slack.Block{
+			f.block(kindAmount, label, "Amount in major units, e.g. 10.50 for €10.50", value),
+			f.block(kindCurrency, label+" currency", "ISO 4217 code, e.g. EUR", currency),
+		}
+	case kindEnum:
+		options := make([]*slack.OptionBlockObject, len(f.Enum))
+		for i, v := range f.Enum {
+			options[i] = slack.NewOptionBlockObject(v, plain(truncate(v, 75)), nil)
+		}
+		element = slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plain("Choose"), valueAction, options...)
+	case kindBool:
+		element = slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plain("Choose"), valueAction,
+			slack.NewOptionBlockObject("true", plain("Yes"), nil),
+			slack.NewOptionBlockObject("false", plain("No"), nil),
+		)
+	case kindInteger:
+		element = slack.NewNumberInputBlockElement(nil, valueAction, false)
+	case kindNumber:
+		element = slack.NewNumberInputBlockElement(nil, valueAction, true)
+	case kindDateTime:
+		element = slack.NewDateTimePickerBlockElement(valueAction)
+	case kindJSON:
+		input := slack.NewPlainTextInputBlockElement(plain("JSON"), valueAction)
+		input.Multiline = true
+		element = input
+	default:
+		element = slack.NewPlainTextInputBlockElement(nil, valueAction)
+	}
+	return []slack.Block{f.block(f.kind(), label, hint, element)}
+}
+
+func (f Field) block(kind, label, hint string, element slack.BlockElement) *slack.InputBlock {
+	block := slack.NewInputBlock(kind+"|"+f.Name, plain(truncate(label, 2000)), nil, element)
+	if hint != "" {
+		block.Hint = plain(hint)
+	}
+	block.Optional = !f.Required
+	return block
+}
+
+// Submission is a parsed form
+type Submission struct {
+	Tool    string                 `json:"tool"`
+	Channel string                 `json:"channel"`
+	Args    map[string]interface{} `json:"args"`
+}
+
+// Parse reads a submitted form into tool arguments. Errors are keyed by
+// block ID, ready for a view_submission "errors" response.
+func Parse(view slack.View) (Submission, map[string]string) {
+	sub := Submission{Tool: view.PrivateMetadata, Args: map[string]interface{}{}}
+	errs := map[string]string{}
+	if view.State == nil {
+		return sub, errs
+	}
+
+	amounts := map[string]string{}
+	currencies := map[string]string{}
+	for blockID, actions := range view.State.Values {
+		action, ok := actions[valueAction]
+		if !ok {
+			continue
+		}
+		if blockID == channelBlock {
+			sub.Channel = action.SelectedConversation
+			continue
+		}
+		kind, name, ok := strings.Cut(blockID, "|")
+		if !ok {
+			continue
+		}
+
+		value := strings.TrimSpace(action.Value)
+		switch kind {
+		case kindAmount:
+			amounts[name] = value
+		case kindCurrency:
+			currencies[name] = strings.ToUpper(value)
+		case kindEnum:
+			if action.SelectedOption.Value != "" {
+				sub.Args[name] = action.SelectedOption.Value
+			}
+		case kindBool:
+			if v := action.SelectedOption.Value; v != "" {
+				sub.Args[name] = v == "true"
+			}
+		case kindDateTime:
+			if action.SelectedDateTime > 0 {
+				sub.Args[name] = time.Unix(action.SelectedDateTime, 0).UTC().Format(time.RFC3339)
+			}
+		case kindInteger:
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs[blockID] = "Enter a whole number."
+				continue
+			}
+			sub.Args[name] = n
+		case kindNumber:
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs[blockID] = "Enter a number."
+				continue
+			}
+			sub.Args[name] = n
+		case kindJSON:
+			if value == "" {
+				continue
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(value), &v); err != nil {
+				errs[blockID] = "Enter valid JSON."
+				continue
+			}
+			sub.Args[name] = v
+		default:
+			if value != "" {
+				sub.Args[name] = value
+			}
+		}
+	}
+
+	for name, value := range amounts {
+		currency := currencies[name]
+		valueBlock, currencyBlock := kindAmount+"|"+name, kindCurrency+"|"+name
+		if value == "" && currency == "" {
+			continue
+		}
+		if value == "" {
+			errs[valueBlock] = "Enter an amount for this currency."
+			continue
+		}
+		if !currencyPattern.MatchString(currency) {
+			errs[currencyBlock] = "Enter a three-letter currency code, e.g. EUR."
+			continue
+		}
+		major, err := strconv.ParseFloat(value, 64)
+		if err != nil || major <= 0 {
+			errs[valueBlock] = "Enter an amount greater than zero."
+			continue
+		}
+		minor := adyen.ToMinorUnits(major, currency)
+		if exp := adyen.CurrencyExponent(currency); math.Abs(major*math.Pow10(exp)-float64(minor)) > 1e-6 {
+			errs[valueBlock] = fmt.Sprintf("%s amounts have at most %d decimals.", currency, exp)
+			continue
+		}
+		sub.Args[name] = map[string]interface{}{"value": minor, "currency": currency}
+	}
+
+	if sub.Channel == "" {
+		errs[channelBlock] = "Choose where to post the result."
+	}
+	return sub, errs
+}
+
+// Title derives a modal title from a tool name, e.g. create_payment_link -> Create payment link
+func Title(toolName string) string {
+	words := strings.ReplaceAll(toolName, "_", " ")
+	if words == "" {
+		return "Form"
+	}
+	return truncate(strings.ToUpper(words[:1])+words[1:], maxTitle)
+}
+
+// Label turns a property name into an input label, e.g. shopperLocale -> Shopper locale
+func Label(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case i == 0:
+			b.WriteString(strings.ToUpper(string(r)))
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte(' ')
+			b.WriteRune(r + ('a' - 'A'))
+		case r == '_':
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func plain(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return fmt.Sprintf("%s…", string(runes[:n-1]))
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+// Package idempotency records work that must happen at most once, such as a
+// write sent to Adyen or an approval decision, so retries and duplicate
+// deliveries can't repeat it. It also keeps the small pieces of state those
+// deliveries share, such as a request waiting for approval.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+// Store claims keys for a while
+type Store interface {
+	// Claim records key until ttl passes. It returns false if the key is
+	// already claimed.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release forgets a claim, e.g. when the work failed before it started
+	Release(ctx context.Context, key string) error
+	// Put stores value under key until ttl passes, replacing any earlier value
+	Put(ctx context.Context, key, value string, ttl time.Duration) error
+	// Get returns the value stored under key, or false if there is none
+	Get(ctx context.Context, key string) (string, bool, error)
+}
+
+// New creates the store configured for this deployment: DynamoDB when a
+// table is set, otherwise in memory (only safe within a single process)
+func New(cfg *config.Config) (Store, error) {
+	if cfg.AWS.IdempotencyTable == "" {
+		return NewMemory(), nil
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(cfg.AWS.Region),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return NewDynamoDB(dynamodb.NewFromConfig(awsCfg), cfg.AWS.IdempotencyTable), nil
+}
+
+// Memory is a Store for a single process
+type Memory struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	values  map[string]string
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{expires: map[string]time.Time{}, values: map[string]string{}}
+}
+
+func (m *Memory) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if expires, ok := m.expires[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+	m.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (m *Memory) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.expires, key)
+	delete(m.values, key)
+	return nil
+}
+
+func (m *Memory) Put(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expires[key] = time.Now().Add(ttl)
+	m.values[key] = value
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.values[key]
+	if !ok || !time.Now().Before(m.expires[key]) {
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client the store needs
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDB is a Store shared by every Lambda instance. Items are keyed by
+// pk and expire through the table's TTL on expiresAt; expired items that
+// TTL hasn't removed yet can be claimed again.
+type DynamoDB struct {
+	client DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDB creates a store in table
+func NewDynamoDB(client DynamoDBAPI, table string) *DynamoDB {
+	return &DynamoDB{client: client, table: table}
+}
+
+func (d *DynamoDB) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	condition := "attribute_not_exists(pk) OR expiresAt < :now"
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &d.table,
+		Item: map[string]types.AttributeValue{
+			"pk":        &types.AttributeValueMemberS{Value: key},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).Unix(), 10)},
+		},
+		ConditionExpression: &condition,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (d *DynamoDB) Release(ctx context.Context, key string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &d.table,
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release %s: %w", key, err)
+	}
+	return nil
+}
+
+func (d *DynamoDB) Put(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &d.table,
+		Item: map[string]types.AttributeValue{
+			"pk":        &types.AttributeValueMemberS{Value: key},
+			"value":     &types.AttributeValueMemberS{Value: value},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (d *DynamoDB) Get(ctx context.Context, key string) (string, bool, error) {
+	consistent := true
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &d.table,
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: &consistent,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	value, ok := out.Item["value"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", false, nil
+	}
+	// Expired items linger until TTL removes them
+	if expires, ok := out.Item["expiresAt"].(*types.AttributeValueMemberN); ok {
+		if at, err := strconv.ParseInt(expires.Value, 10, 64); err == nil && at < time.Now().Unix() {
+			return "", false, nil
+		}
+	}
+	return value.Value, true, nil
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoDB keeps items by pk and honours the claim condition
+type fakeDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["pk"].(*types.AttributeValueMemberS).Value
+	if existing, ok := f.items[key]; ok && params.ConditionExpression != nil {
+		expires, _ := strconv.ParseInt(existing["expiresAt"].(*types.AttributeValueMemberN).Value, 10, 64)
+		now, _ := strconv.ParseInt(params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value, 10, 64)
+		if expires >= now {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	f.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, params.Key["pk"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[params.Key["pk"].(*types.AttributeValueMemberS).Value]}, nil
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]Store{
+		"memory":   NewMemory(),
+		"dynamodb": NewDynamoDB(&fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}, "idempotency"),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if ok, err := store.Claim(ctx, "write/1", time.Hour); !ok || err != nil {
+				t.Fatalf("first Claim = %v, %v", ok, err)
+			}
+			if ok, _ := store.Claim(ctx, "write/1", time.Hour); ok {
+				t.Error("second Claim succeeded")
+			}
+			store.Release(ctx, "write/1")
+			if ok, _ := store.Claim(ctx, "write/1", time.Hour); !ok {
+				t.Error("Claim after Release failed")
+			}
+
+			if _, found, err := store.Get(ctx, "value/1"); found || err != nil {
+				t.Errorf("Get of a missing key = %v, %v", found, err)
+			}
+			store.Put(ctx, "value/1", "first", time.Hour)
+			store.Put(ctx, "value/1", "second", time.Hour)
+			if value, found, err := store.Get(ctx, "value/1"); value != "second" || !found || err != nil {
+				t.Errorf("Get = %q, %v, %v; want second", value, found, err)
+			}
+
+			// Expired values are gone, even before the table's TTL removes them
+			store.Put(ctx, "value/2", "old", -time.Minute)
+			if _, found, _ := store.Get(ctx, "value/2"); found {
+				t.Error("Get returned an expired value")
+			}
+		})
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
 )
 
 const anthropicAPIURL = "https://api.anthropic.com/v1/messages"
@@ -17,6 +20,11 @@ const anthropicAPIURL = "https://api.anthropic.com/v1/messages"
 type Client struct {
 	cfg        *config.Config
 	httpClient *http.Client
+	redactor   *redact.Redactor
+	url        string // Messages API endpoint
+
+	mu    sync.Mutex
+	stats Stats
 }
 
 // New creates a new LLM client
@@ -24,14 +32,35 @@ func New(cfg *config.Config) *Client {
 	return &Client{
 		cfg:        cfg,
 		httpClient: &http.Client{},
+		redactor:   redact.New(cfg),
+		url:        anthropicAPIURL,
 	}
 }
 
+// CacheControl marks a prompt caching breakpoint
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// ephemeralCache is the only cache type Anthropic currently supports
+var ephemeralCache = &CacheControl{Type: "ephemeral"}
+
+// maxCacheBreakpoints is the most cache_control markers a request may carry
+const maxCacheBreakpoints = 4
+
 // Tool represents an available tool/function
 type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	InputSchema map[string]interface{} `json:"input_schema"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"input_schema"`
+	CacheControl *CacheControl          `json:"cache_control,omitempty"`
+}
+
+// SystemBlock is a text block of the system prompt
+type SystemBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ToolCall represents a tool call from the LLM
@@ -47,6 +76,17 @@ type Message struct {
 	Content []ContentBlock `json:"content"`
 }
 
+// Stop reasons returned by the Anthropic API
+const (
+	StopEndTurn       = "end_turn"
+	StopMaxTokens     = "max_tokens"
+	StopSequence      = "stop_sequence"
+	StopToolUse       = "tool_use"
+	StopPauseTurn     = "pause_turn"
+	StopRefusal       = "refusal"
+	StopContextWindow = "model_context_window_exceeded"
+)
+
 // ContentBlock represents a content block in a message
 type ContentBlock struct {
 	Type      string                 `json:"type"`
@@ -56,15 +96,70 @@ type ContentBlock struct {
 	Input     map[string]interface{} `json:"input,omitempty"`
 	ToolUseID string                 `json:"tool_use_id,omitempty"`
 	Content   string                 `json:"content,omitempty"`
+	Thinking  string                 `json:"thinking,omitempty"`
+	Signature string                 `json:"signature,omitempty"`
+	Data      string                 `json:"data,omitempty"` // redacted_thinking payload
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // AnthropicRequest represents a request to Anthropic API
 type AnthropicRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	System    string    `json:"system,omitempty"`
-	Messages  []Message `json:"messages"`
-	Tools     []Tool    `json:"tools,omitempty"`
+	Model         string        `json:"model"`
+	MaxTokens     int           `json:"max_tokens"`
+	System        []SystemBlock `json:"system,omitempty"`
+	Messages      []Message     `json:"messages"`
+	Tools         []Tool        `json:"tools,omitempty"`
+	StopSequences []string      `json:"stop_sequences,omitempty"`
+}
+
+// Usage reports token consumption for a request
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// CacheHit returns true if any part of the prompt was served from cache
+func (u Usage) CacheHit() bool {
+	return u.CacheReadInputTokens > 0
+}
+
+// Cost returns the USD cost of the usage at the given prices per million tokens
+func (u Usage) Cost(p config.LLMPricing) float64 {
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite +
+		float64(u.CacheReadInputTokens)*p.CacheRead) / 1e6
+}
+
+// Stats accumulates usage across requests made by a Client
+type Stats struct {
+	Requests    int
+	CacheHits   int
+	CacheMisses int
+	Usage       Usage
+}
+
+func (u *Usage) add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheCreationInputTokens += o.CacheCreationInputTokens
+	u.CacheReadInputTokens += o.CacheReadInputTokens
+}
+
+func (s *Stats) add(u Usage, caching bool) {
+	s.Requests++
+	s.Usage.add(u)
+	if !caching {
+		return
+	}
+	if u.CacheHit() {
+		s.CacheHits++
+	} else {
+		s.CacheMisses++
+	}
 }
 
 // AnthropicResponse represents a response from Anthropic API
@@ -75,12 +170,29 @@ type AnthropicResponse struct {
 	Content      []ContentBlock `json:"content"`
 	StopReason   string         `json:"stop_reason"`
 	StopSequence string         `json:"stop_sequence,omitempty"`
+	Usage        Usage          `json:"usage"`
 }
 
 // Response from ProcessMessage
 type Response struct {
-	Text      string
-	ToolCalls []ToolCall
+	Text         string
+	ToolCalls    []ToolCall
+	Usage        Usage
+	StopReason   string
+	StopSequence string // Set when StopReason is StopSequence
+	Truncated    bool   // Output was cut off and could not be continued
+}
+
+// Refused returns true if the model declined to answer
+func (r *Response) Refused() bool {
+	return r.StopReason == StopRefusal
+}
+
+// Stats returns the usage accumulated by this client so far
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
 }
 
 // ProcessMessage sends a message to the LLM and returns the response
@@ -92,6 +204,7 @@ func (c *Client) ProcessMessage(ctx context.Context, userMessage string, tools [
 			{Type: "text", Text: userMessage},
 		},
 	})
+	messages = c.redactMessages(messages)
 
 	systemPrompt := `You are a helpful assistant that helps with Adyen payment operations.
 You have access to Adyen tools for:
@@ -107,19 +220,86 @@ Be concise and helpful. Always confirm actions before executing them.
 For destructive actions (refunds, cancellations), clearly state what will happen.`
 
 	reqBody := AnthropicRequest{
-		Model:     c.cfg.LLM.Model,
-		MaxTokens: 1024,
-		System:    systemPrompt,
-		Messages:  messages,
-		Tools:     tools,
+		Model:         c.cfg.LLM.Model,
+		MaxTokens:     c.maxTokens(),
+		System:        []SystemBlock{{Type: "text", Text: systemPrompt}},
+		Messages:      messages,
+		Tools:         tools,
+		StopSequences: c.cfg.LLM.StopSequences,
+	}
+	if c.cfg.LLM.PromptCaching {
+		applyCacheControl(&reqBody)
 	}
 
+	// Content accumulated across continuations of the same assistant turn
+	var content []ContentBlock
+	response := &Response{}
+
+	for attempt := 0; ; attempt++ {
+		anthropicResp, err := c.send(ctx, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		response.Usage.add(anthropicResp.Usage)
+		response.StopReason = anthropicResp.StopReason
+		response.StopSequence = anthropicResp.StopSequence
+		content = mergeContent(content, anthropicResp.Content)
+
+		if !c.shouldContinue(anthropicResp, content, attempt) {
+			break
+		}
+
+		// Resend the partial turn as an assistant prefill so the model picks up where it stopped
+		content = trimTrailingSpace(content)
+		reqBody.Messages = append(messages[:len(messages):len(messages)], Message{
+			Role:    "assistant",
+			Content: content,
+		})
+	}
+
+	response.Truncated = response.StopReason == StopMaxTokens || response.StopReason == StopContextWindow
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			response.Text += block.Text
+		case "tool_use":
+			response.ToolCalls = append(response.ToolCalls, ToolCall{
+				ID:    block.ID,
+				Name:  block.Name,
+				Input: block.Input,
+			})
+		case "thinking", "redacted_thinking":
+			// Internal reasoning is never shown to users, nor are other
+			// block types
+		}
+	}
+
+	return response, nil
+}
+
+// APIError is a non-200 response from the Messages API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// Retryable is true for rate limits and server errors, including 529 overloaded
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// send performs a single Messages API call
+func (c *Client) send(ctx context.Context, reqBody AnthropicRequest) (*AnthropicResponse, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", anthropicAPIURL, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -136,7 +316,7 @@ For destructive actions (refunds, cancellations), clearly state what will happen
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var anthropicResp AnthropicResponse
@@ -144,22 +324,129 @@ For destructive actions (refunds, cancellations), clearly state what will happen
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Parse response
-	response := &Response{}
-	for _, block := range anthropicResp.Content {
-		switch block.Type {
-		case "text":
-			response.Text += block.Text
-		case "tool_use":
-			response.ToolCalls = append(response.ToolCalls, ToolCall{
-				ID:    block.ID,
-				Name:  block.Name,
-				Input: block.Input,
-			})
+	c.mu.Lock()
+	c.stats.add(anthropicResp.Usage, c.cfg.LLM.PromptCaching)
+	c.mu.Unlock()
+
+	return &anthropicResp, nil
+}
+
+// redactMessages scrubs PII and card data from user text and tool results
+// so that nothing sensitive is sent to the model
+func (c *Client) redactMessages(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, msg := range messages {
+		out[i] = Message{Role: msg.Role, Content: make([]ContentBlock, len(msg.Content))}
+		for j, block := range msg.Content {
+			if msg.Role == "user" {
+				switch block.Type {
+				case "text":
+					block.Text = c.redactor.Text(block.Text)
+				case "tool_result":
+					block.Content = c.redactor.Result(block.Content)
+				}
+			}
+			out[i].Content[j] = block
 		}
 	}
+	return out
+}
 
-	return response, nil
+func (c *Client) maxTokens() int {
+	if c.cfg.LLM.MaxTokens > 0 {
+		return c.cfg.LLM.MaxTokens
+	}
+	return 1024
+}
+
+// shouldContinue decides whether another request is needed to finish the turn
+func (c *Client) shouldContinue(resp *AnthropicResponse, content []ContentBlock, attempt int) bool {
+	switch resp.StopReason {
+	case StopPauseTurn:
+		// Server-side tool loop paused; resending the turn lets it resume
+		return attempt < c.cfg.LLM.MaxContinuations
+	case StopMaxTokens:
+		// A tool_use block cut off mid-input cannot be resumed
+		if len(content) == 0 || content[len(content)-1].Type != "text" {
+			return false
+		}
+		return attempt < c.cfg.LLM.MaxContinuations
+	default:
+		return false
+	}
+}
+
+// mergeContent appends new blocks, joining a continued text block onto the previous one
+func mergeContent(content, next []ContentBlock) []ContentBlock {
+	if len(content) > 0 && len(next) > 0 && content[len(content)-1].Type == "text" && next[0].Type == "text" {
+		content[len(content)-1].Text += next[0].Text
+		next = next[1:]
+	}
+	return append(content, next...)
+}
+
+// trimTrailingSpace removes trailing whitespace, which the API rejects in prefills
+func trimTrailingSpace(content []ContentBlock) []ContentBlock {
+	if last := len(content) - 1; last >= 0 && content[last].Type == "text" {
+		content[last].Text = strings.TrimRight(content[last].Text, " \t\n")
+	}
+	return content
+}
+
+// applyCacheControl sets breakpoints on the last tool, the system prompt and
+// the last user turn. Tools are rendered before the system prompt, so the
+// tool breakpoint caches the whole catalog, the system breakpoint extends it
+// to the prompt and the last one to the conversation so far. Breakpoints the
+// caller already set count towards the API's limit; once it is reached, the
+// remaining ones are skipped in that order.
+func applyCacheControl(req *AnthropicRequest) {
+	budget := maxCacheBreakpoints - countBreakpoints(req)
+
+	if n := len(req.Tools); n > 0 && budget > 0 && req.Tools[n-1].CacheControl == nil {
+		// Copy so the shared tool slice from the MCP client is not mutated
+		tools := make([]Tool, n)
+		copy(tools, req.Tools)
+		tools[n-1].CacheControl = ephemeralCache
+		req.Tools = tools
+		budget--
+	}
+	if n := len(req.System); n > 0 && budget > 0 && req.System[n-1].CacheControl == nil {
+		req.System[n-1].CacheControl = ephemeralCache
+		budget--
+	}
+	for i := len(req.Messages) - 1; i >= 0 && budget > 0; i-- {
+		msg := req.Messages[i]
+		if msg.Role != "user" || len(msg.Content) == 0 {
+			continue
+		}
+		if last := &msg.Content[len(msg.Content)-1]; last.CacheControl == nil {
+			last.CacheControl = ephemeralCache
+		}
+		break
+	}
+}
+
+// countBreakpoints counts the cache_control markers already in a request
+func countBreakpoints(req *AnthropicRequest) int {
+	n := 0
+	for _, tool := range req.Tools {
+		if tool.CacheControl != nil {
+			n++
+		}
+	}
+	for _, block := range req.System {
+		if block.CacheControl != nil {
+			n++
+		}
+	}
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			if block.CacheControl != nil {
+				n++
+			}
+		}
+	}
+	return n
 }
 
 // ConvertToolsFromMCP converts MCP tools to Anthropic format
@@ -0,0 +1,400 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+// fakeAPI serves canned Messages API responses in order and records the requests
+type fakeAPI struct {
+	responses []AnthropicResponse
+	requests  []AnthropicRequest
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req AnthropicRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	f.requests = append(f.requests, req)
+	if len(f.requests) > len(f.responses) {
+		http.Error(w, `{"error":"unexpected request"}`, http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(f.responses[len(f.requests)-1])
+}
+
+func newTestClient(t *testing.T, cfg *config.Config, responses ...AnthropicResponse) (*Client, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{responses: responses}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	c := New(cfg)
+	c.url = server.URL
+	return c, api
+}
+
+func text(s string) ContentBlock { return ContentBlock{Type: "text", Text: s} }
+
+func toolUse(name string, input map[string]interface{}) ContentBlock {
+	return ContentBlock{Type: "tool_use", ID: "toolu_1", Name: name, Input: input}
+}
+
+func TestProcessMessageStopReasons(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxContinuations int
+		responses        []AnthropicResponse
+		wantRequests     int
+		wantText         string
+		wantTools        int
+		wantStop         string
+		wantTruncated    bool
+		wantRefused      bool
+	}{
+		{
+			name:         "end_turn",
+			responses:    []AnthropicResponse{{StopReason: StopEndTurn, Content: []ContentBlock{text("The payment is authorised.")}}},
+			wantRequests: 1,
+			wantText:     "The payment is authorised.",
+			wantStop:     StopEndTurn,
+		},
+		{
+			name:             "max_tokens continued",
+			maxContinuations: 2,
+			responses: []AnthropicResponse{
+				{StopReason: StopMaxTokens, Content: []ContentBlock{text("The payment was ")}},
+				{StopReason: StopEndTurn, Content: []ContentBlock{text(" refunded yesterday.")}},
+			},
+			wantRequests: 2,
+			wantText:     "The payment was refunded yesterday.",
+			wantStop:     StopEndTurn,
+		},
+		{
+			name: "max_tokens without continuations",
+			responses: []AnthropicResponse{
+				{StopReason: StopMaxTokens, Content: []ContentBlock{text("The payment was")}},
+			},
+			wantRequests:  1,
+			wantText:      "The payment was",
+			wantStop:      StopMaxTokens,
+			wantTruncated: true,
+		},
+		{
+			name:             "max_tokens inside a tool call",
+			maxContinuations: 2,
+			responses: []AnthropicResponse{
+				{StopReason: StopMaxTokens, Content: []ContentBlock{text("Refunding."), toolUse("refund_payment", nil)}},
+			},
+			// A cut-off tool call can't be resumed, and is reported as truncated
+			wantRequests:  1,
+			wantText:      "Refunding.",
+			wantTools:     1,
+			wantStop:      StopMaxTokens,
+			wantTruncated: true,
+		},
+		{
+			name: "tool_use",
+			responses: []AnthropicResponse{
+				{StopReason: StopToolUse, Content: []ContentBlock{toolUse("get_payment", map[string]interface{}{"pspReference": "8815123456789012"})}},
+			},
+			wantRequests: 1,
+			wantTools:    1,
+			wantStop:     StopToolUse,
+		},
+		{
+			name: "refusal",
+			responses: []AnthropicResponse{
+				{StopReason: StopRefusal, Content: []ContentBlock{text("I can't help with that.")}},
+			},
+			wantRequests: 1,
+			wantText:     "I can't help with that.",
+			wantStop:     StopRefusal,
+			wantRefused:  true,
+		},
+		{
+			name: "stop_sequence",
+			responses: []AnthropicResponse{
+				{StopReason: StopSequence, StopSequence: "###", Content: []ContentBlock{text("Done.")}},
+			},
+			wantRequests: 1,
+			wantText:     "Done.",
+			wantStop:     StopSequence,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{LLM: config.LLMConfig{MaxContinuations: tt.maxContinuations}}
+			c, api := newTestClient(t, cfg, tt.responses...)
+
+			resp, err := c.ProcessMessage(context.Background(), "status?", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(api.requests) != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", len(api.requests), tt.wantRequests)
+			}
+			if resp.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", resp.Text, tt.wantText)
+			}
+			if len(resp.ToolCalls) != tt.wantTools {
+				t.Errorf("got %d tool calls, want %d", len(resp.ToolCalls), tt.wantTools)
+			}
+			if resp.StopReason != tt.wantStop {
+				t.Errorf("StopReason = %q, want %q", resp.StopReason, tt.wantStop)
+			}
+			if resp.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %v, want %v", resp.Truncated, tt.wantTruncated)
+			}
+			if resp.Refused() != tt.wantRefused {
+				t.Errorf("Refused() = %v, want %v", resp.Refused(), tt.wantRefused)
+			}
+		})
+	}
+}
+
+func TestProcessMessageContinuationPrefill(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{MaxContinuations: 1}}
+	c, api := newTestClient(t, cfg,
+		AnthropicResponse{StopReason: StopMaxTokens, Content: []ContentBlock{text("Partial answer \n")}},
+		AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text(" and the rest.")}},
+	)
+
+	if _, err := c.ProcessMessage(context.Background(), "status?", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The continuation resends the partial turn, without trailing whitespace
+	msgs := api.requests[1].Messages
+	last := msgs[len(msgs)-1]
+	if last.Role != "assistant" || len(last.Content) != 1 || last.Content[0].Text != "Partial answer" {
+		t.Errorf("continuation prefill = %+v", last)
+	}
+}
+
+func TestProcessMessageStopSequencesSent(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{StopSequences: []string{"###"}}}
+	c, api := newTestClient(t, cfg, AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text("ok")}})
+
+	if _, err := c.ProcessMessage(context.Background(), "status?", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.requests[0].StopSequences; len(got) != 1 || got[0] != "###" {
+		t.Errorf("StopSequences = %v, want [###]", got)
+	}
+}
+
+func TestProcessMessageAPIError(t *testing.T) {
+	c, _ := newTestClient(t, &config.Config{})
+
+	_, err := c.ProcessMessage(context.Background(), "status?", nil, nil)
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("err = %v, want an *APIError", err)
+	}
+	if !apiErr.Retryable() {
+		t.Errorf("a 500 should be retryable")
+	}
+}
+
+func TestApplyCacheControl(t *testing.T) {
+	tools := func(n int) []Tool {
+		out := make([]Tool, n)
+		for i := range out {
+			out[i] = Tool{Name: fmt.Sprintf("tool_%d", i)}
+		}
+		return out
+	}
+	user := func(texts ...string) Message {
+		msg := Message{Role: "user"}
+		for _, t := range texts {
+			msg.Content = append(msg.Content, text(t))
+		}
+		return msg
+	}
+	marked := &CacheControl{Type: "ephemeral"}
+
+	tests := []struct {
+		name string
+		req  AnthropicRequest
+		// breakpoints expected, as "tool 2", "system 0" or "message 1.0"
+		want []string
+	}{
+		{
+			name: "tools, system and last user turn",
+			req: AnthropicRequest{
+				Tools:    tools(3),
+				System:   []SystemBlock{{Type: "text", Text: "a"}, {Type: "text", Text: "b"}},
+				Messages: []Message{user("first"), {Role: "assistant", Content: []ContentBlock{text("reply")}}, user("second", "third")},
+			},
+			want: []string{"tool 2", "system 1", "message 2.1"},
+		},
+		{
+			name: "no tools",
+			req: AnthropicRequest{
+				System:   []SystemBlock{{Type: "text", Text: "a"}},
+				Messages: []Message{user("question")},
+			},
+			want: []string{"system 0", "message 0.0"},
+		},
+		{
+			// Continuations end with the assistant's prefill
+			name: "assistant prefill",
+			req: AnthropicRequest{
+				Messages: []Message{user("question"), {Role: "assistant", Content: []ContentBlock{text("partial")}}},
+			},
+			want: []string{"message 0.0"},
+		},
+		{
+			// Two breakpoints already set leave room for two of the three
+			name: "limit",
+			req: AnthropicRequest{
+				Tools:  tools(2),
+				System: []SystemBlock{{Type: "text", Text: "a"}},
+				Messages: []Message{
+					{Role: "user", Content: []ContentBlock{{Type: "text", Text: "old", CacheControl: marked}}},
+					{Role: "assistant", Content: []ContentBlock{{Type: "text", Text: "old reply", CacheControl: marked}}},
+					user("question"),
+				},
+			},
+			want: []string{"tool 1", "system 0", "message 0.0", "message 1.0"},
+		},
+		{
+			name: "limit already reached",
+			req: AnthropicRequest{
+				Tools:    []Tool{{Name: "a", CacheControl: marked}, {Name: "b", CacheControl: marked}, {Name: "c", CacheControl: marked}, {Name: "d", CacheControl: marked}, {Name: "e"}},
+				System:   []SystemBlock{{Type: "text", Text: "a"}},
+				Messages: []Message{user("question")},
+			},
+			want: []string{"tool 0", "tool 1", "tool 2", "tool 3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := tt.req.Tools
+			applyCacheControl(&tt.req)
+
+			var got []string
+			for i, tool := range tt.req.Tools {
+				if tool.CacheControl != nil {
+					got = append(got, fmt.Sprintf("tool %d", i))
+				}
+			}
+			for i, block := range tt.req.System {
+				if block.CacheControl != nil {
+					got = append(got, fmt.Sprintf("system %d", i))
+				}
+			}
+			for i, msg := range tt.req.Messages {
+				for j, block := range msg.Content {
+					if block.CacheControl != nil {
+						got = append(got, fmt.Sprintf("message %d.%d", i, j))
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("breakpoints %v, want %v", got, tt.want)
+			}
+			if len(got) > maxCacheBreakpoints {
+				t.Errorf("%d breakpoints, the API accepts %d", len(got), maxCacheBreakpoints)
+			}
+			// The MCP client's tool slice is shared between requests
+			for i, tool := range shared {
+				if tool.CacheControl != nil && tool.CacheControl != marked {
+					t.Errorf("shared tool %d was marked", i)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessMessagePromptCaching(t *testing.T) {
+	tools := []Tool{{Name: "get_payment"}, {Name: "refund_payment"}}
+
+	for _, caching := range []bool{true, false} {
+		t.Run(fmt.Sprintf("caching %v", caching), func(t *testing.T) {
+			cfg := &config.Config{LLM: config.LLMConfig{PromptCaching: caching}}
+			c, api := newTestClient(t, cfg, AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text("ok")}})
+			if _, err := c.ProcessMessage(context.Background(), "status?", tools, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			req := api.requests[0]
+			marks := []bool{
+				req.Tools[len(req.Tools)-1].CacheControl != nil,
+				req.System[len(req.System)-1].CacheControl != nil,
+				req.Messages[len(req.Messages)-1].Content[0].CacheControl != nil,
+			}
+			for i, m := range marks {
+				if m != caching {
+					t.Errorf("breakpoint %d set = %v, want %v", i, m, caching)
+				}
+			}
+			if tools[1].CacheControl != nil {
+				t.Error("the caller's tools were marked")
+			}
+		})
+	}
+}
+
+func TestUsageAccounting(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{PromptCaching: true, MaxContinuations: 1}}
+	c, _ := newTestClient(t, cfg,
+		// The first request writes the cache, and is continued
+		AnthropicResponse{StopReason: StopMaxTokens, Content: []ContentBlock{text("The payment ")}, Usage: Usage{InputTokens: 100, OutputTokens: 10, CacheCreationInputTokens: 2000}},
+		AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text("was refunded.")}, Usage: Usage{InputTokens: 20, OutputTokens: 5, CacheReadInputTokens: 2000}},
+		// A later message reads it
+		AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text("Authorised.")}, Usage: Usage{InputTokens: 30, OutputTokens: 3, CacheReadInputTokens: 2000}},
+	)
+
+	first, err := c.ProcessMessage(context.Background(), "refund status?", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A response sums the usage of its continuations
+	want := Usage{InputTokens: 120, OutputTokens: 15, CacheCreationInputTokens: 2000, CacheReadInputTokens: 2000}
+	if first.Usage != want {
+		t.Errorf("response usage = %+v, want %+v", first.Usage, want)
+	}
+	if _, err := c.ProcessMessage(context.Background(), "status?", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.Stats()
+	wantStats := Stats{
+		Requests:    3,
+		CacheHits:   2,
+		CacheMisses: 1,
+		Usage:       Usage{InputTokens: 150, OutputTokens: 18, CacheCreationInputTokens: 2000, CacheReadInputTokens: 4000},
+	}
+	if stats != wantStats {
+		t.Errorf("Stats = %+v, want %+v", stats, wantStats)
+	}
+
+	// Cache reads and writes are priced on their own
+	pricing := config.LLMPricing{Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30}
+	if got, want := first.Usage.Cost(pricing), (120*3+15*15+2000*3.75+2000*0.30)/1e6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", got, want)
+	}
+}
+
+func TestUsageAccountingWithoutCaching(t *testing.T) {
+	c, _ := newTestClient(t, &config.Config{},
+		AnthropicResponse{StopReason: StopEndTurn, Content: []ContentBlock{text("ok")}, Usage: Usage{InputTokens: 10, OutputTokens: 2}},
+	)
+	if _, err := c.ProcessMessage(context.Background(), "status?", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Hits and misses only mean something when caching is on
+	if stats := c.Stats(); stats.Requests != 1 || stats.CacheHits != 0 || stats.CacheMisses != 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
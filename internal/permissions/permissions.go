@@ -4,20 +4,23 @@ import (
 	"github.com/getalternative/adyen-slack-assistant/internal/config"
 )
 
-// IsWriteAction returns true if the action modifies data
+// writeActions lists the tools that modify data
 var writeActions = map[string]bool{
 	"refund_payment":           true,
 	"cancel_payment":           true,
+	"capture_payment":          true,
 	"create_payment_link":      true,
 	"create_payment_session":   true,
 	"expire_payment_link":      true,
+	"update_payment_link":      true,
 	"update_terminal_settings": true,
 }
 
 // Result represents the outcome of a permission check
 type Result struct {
-	Allowed bool
-	Reason  string
+	Allowed       bool
+	NeedsApproval bool // Not allowed alone, but an admin may approve it
+	Reason        string
 }
 
 // Checker handles permission validation
@@ -32,7 +35,7 @@ func New(cfg *config.Config) *Checker {
 
 // Check validates if a user can perform an action
 // Admins: read + write
-// Others: read only
+// Others: read only, or write with an admin's approval when approvals are enabled
 func (c *Checker) Check(userID, channelID, action string) Result {
 	perms := c.cfg.Permissions
 
@@ -44,6 +47,9 @@ func (c *Checker) Check(userID, channelID, action string) Result {
 	// Check if it's a write action
 	if writeActions[action] {
 		if !c.IsAdmin(userID) {
+			if perms.Approvals {
+				return Result{Allowed: false, NeedsApproval: true, Reason: "This action needs an admin's approval."}
+			}
 			return Result{Allowed: false, Reason: "Only admins can perform this action."}
 		}
 	}
@@ -51,6 +57,17 @@ func (c *Checker) Check(userID, channelID, action string) Result {
 	return Result{Allowed: true}
 }
 
+// CanUse reports whether the user's role allows the action, regardless of
+// channel. It decides what to offer in the App Home; Check still guards execution.
+func (c *Checker) CanUse(userID, action string) bool {
+	return !writeActions[action] || c.IsAdmin(userID) || c.cfg.Permissions.Approvals
+}
+
+// IsWriteAction returns true if the action modifies data
+func IsWriteAction(action string) bool {
+	return writeActions[action]
+}
+
 // IsAdmin checks if a user is an admin
 func (c *Checker) IsAdmin(userID string) bool {
 	return contains(c.cfg.Permissions.Admins, userID)
@@ -0,0 +1,184 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/approval"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// ApprovalEvent is queued by the webhook when someone clicks Approve or Reject
+type ApprovalEvent struct {
+	Action    string `json:"action"`
+	User      string `json:"user"`
+	Value     string `json:"value"`
+	Channel   string `json:"channel"`
+	MessageTs string `json:"messageTs"`
+}
+
+// requestApproval posts a prompt for admins in the thread and lets the
+// requester know. An admin's own bulk write is put to them to confirm.
+func requestApproval(ctx context.Context, req toolRequest) error {
+	msg := req.Msg
+	r := approval.Request{
+		ID:       approval.NewID(),
+		Tool:     req.Tool,
+		Args:     req.Args,
+		User:     msg.User,
+		Channel:  msg.Channel,
+		ThreadTs: msg.GetThreadTs(),
+		Ts:       msg.Ts,
+		Items:    req.Items,
+		Total:    bulkTotal(req.Args, len(req.Items)),
+		Confirm:  permChecker.IsAdmin(msg.User),
+	}
+	admins := permChecker.GetAdmins()
+	if r.Confirm {
+		admins = nil
+	}
+
+	// The prompt carries only the request's ID; what runs is kept here
+	data, err := r.Encode()
+	if err != nil {
+		return err
+	}
+	if err := idempotent.Put(ctx, approvalRequestKey(r.ID), data, decisionTTL); err != nil {
+		return queue.Retryable(fmt.Errorf("failed to store approval request: %w", err))
+	}
+
+	blocks := approval.Blocks(r, redactor.Map(req.Args), admins, approvalSigningKey())
+
+	text := fmt.Sprintf("<@%s> wants to run %s and needs an admin's approval", msg.User, req.Tool)
+	if r.Confirm {
+		text = fmt.Sprintf("Confirm running %s on %d payments", req.Tool, len(req.Items))
+	}
+	if _, err := slack.PostBlocksToChannel(msg.Channel, msg.GetThreadTs(), text, blocks...); err != nil {
+		return fmt.Errorf("failed to post approval prompt: %w", err)
+	}
+	auditLogger.LogRequested(ctx, msg.User, req.Tool, msg.Channel, req.auditArgs())
+	req.Status.set(statusAwaiting)
+	if r.Confirm {
+		return reply(msg, replyApproval, fmt.Sprintf("Please confirm running `%s` on %d payments with the buttons above.", req.Tool, len(req.Items)))
+	}
+	if len(req.Items) > 0 {
+		return reply(msg, replyApproval, fmt.Sprintf("Running `%s` on %d payments needs an admin's approval. I've asked the admins in this thread.", req.Tool, len(req.Items)))
+	}
+	return reply(msg, replyApproval, fmt.Sprintf("`%s` needs an admin's approval. I've asked the admins in this thread.", req.Tool))
+}
+
+// decisionTTL keeps a decided prompt from being decided again while its buttons are still visible
+const decisionTTL = 15 * 24 * time.Hour
+
+// handleApproval runs or rejects a request after an admin's decision
+func handleApproval(ctx context.Context, queueMsg *queue.Message) (err error) {
+	var event ApprovalEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse approval event: %w", err)
+	}
+	id, err := approval.Verify(approvalSigningKey(), event.Value)
+	if err != nil {
+		return err
+	}
+	r, found, err := loadApproval(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return reply(&slackClient.Message{Channel: event.Channel, User: event.User, Ts: event.MessageTs}, replyDenial,
+			"This request has expired. Please ask for it again.")
+	}
+
+	requester := &slackClient.Message{Channel: r.Channel, User: r.User, Ts: r.Ts, ThreadTs: r.ThreadTs}
+	args := bulkArgs(r.Args, r.Items)
+	if !permChecker.IsAdmin(event.User) {
+		reason := "Only admins can approve or reject requests."
+		auditLogger.LogDenied(ctx, event.User, r.Tool, r.Channel, args, reason)
+		return reply(&slackClient.Message{Channel: r.Channel, User: event.User, ThreadTs: r.ThreadTs}, replyDenial, reason)
+	}
+
+	// Only the first decision on a prompt counts, e.g. after a double click
+	key := approvalKey(event.Channel, event.MessageTs)
+	claimed, err := idempotent.Claim(ctx, key, decisionTTL)
+	if err != nil {
+		return queue.Retryable(fmt.Errorf("failed to claim approval: %w", err))
+	}
+	if !claimed {
+		return reply(&slackClient.Message{Channel: r.Channel, User: event.User, ThreadTs: r.ThreadTs}, replyDenial, "This request has already been decided.")
+	}
+	defer func() {
+		// Let the decision be retried if it failed before anything ran
+		if queue.IsRetryable(err) {
+			idempotent.Release(ctx, key)
+		}
+	}()
+
+	status := resumeStatus(requester)
+	if event.Action == approval.RejectAction && event.User == r.User {
+		auditLogger.LogRejected(ctx, r.User, r.Tool, r.Channel, event.User, args)
+		resolveApproval(event, r, fmt.Sprintf(":x: Cancelled by <@%s>", event.User))
+		status.set(statusDenied)
+		return nil
+	}
+	if event.Action == approval.RejectAction {
+		auditLogger.LogRejected(ctx, r.User, r.Tool, r.Channel, event.User, args)
+		resolveApproval(event, r, fmt.Sprintf(":x: Rejected by <@%s>", event.User))
+		status.set(statusDenied)
+		return reply(requester, replyApproval, fmt.Sprintf("<@%s> rejected your request to run `%s`.", event.User, r.Tool))
+	}
+
+	auditLogger.LogApproved(ctx, r.User, r.Tool, r.Channel, event.User, args, "Approved in Slack")
+	resolveApproval(event, r, fmt.Sprintf(":white_check_mark: Approved by <@%s>", event.User))
+	err = executeTool(ctx, toolRequest{
+		Msg:        requester,
+		Tool:       r.Tool,
+		Args:       r.Args,
+		Items:      r.Items,
+		Status:     status,
+		ApprovedBy: event.User,
+	})
+	status.finish(err)
+	return err
+}
+
+// approvalRequestKey stores a request waiting for a decision
+func approvalRequestKey(id string) string {
+	return "approval-request/" + id
+}
+
+// loadApproval reads a stored request; it is gone once decisionTTL has passed
+func loadApproval(ctx context.Context, id string) (approval.Request, bool, error) {
+	data, found, err := idempotent.Get(ctx, approvalRequestKey(id))
+	if err != nil {
+		return approval.Request{}, false, queue.Retryable(fmt.Errorf("failed to read approval request: %w", err))
+	}
+	if !found {
+		return approval.Request{}, false, nil
+	}
+	r, err := approval.Decode(data)
+	return r, err == nil, err
+}
+
+// approvalSigningKey signs approval buttons: the audit HMAC key, or the Slack
+// signing secret when there is none
+func approvalSigningKey() []byte {
+	if cfg.Audit.HMACKey != "" {
+		return []byte(cfg.Audit.HMACKey)
+	}
+	return []byte(cfg.Slack.SigningSecret)
+}
+
+// approvalKey claims the decision on a prompt
+func approvalKey(channel, promptTs string) string {
+	return fmt.Sprintf("approval/%s/%s", channel, promptTs)
+}
+
+// resolveApproval replaces the prompt's buttons with the outcome
+func resolveApproval(event ApprovalEvent, r approval.Request, outcome string) {
+	if err := slack.UpdateMessage(event.Channel, event.MessageTs, outcome, approval.Resolved(r, outcome)...); err != nil {
+		fmt.Printf("Failed to update approval prompt: %v\n", err)
+	}
+}
@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/approval"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+func approvalConfig() *config.Config {
+	return &config.Config{
+		Slack:       config.SlackConfig{SigningSecret: "signing-secret"},
+		Permissions: config.PermissionsConfig{Admins: []string{"UADMIN"}, Approvals: true},
+	}
+}
+
+// prompt is an approval prompt posted to fakeSlack
+type prompt struct {
+	Ts     string
+	Blocks string // the blocks as posted
+	Text   string // the opening section's text
+	Value  string // the Approve button's value
+}
+
+// postedPrompt returns the approval prompt posted so far
+func postedPrompt(t *testing.T, env *testEnv) prompt {
+	t.Helper()
+	env.slack.mu.Lock()
+	defer env.slack.mu.Unlock()
+	for _, call := range env.slack.calls {
+		blocks := call.Args.Get("blocks")
+		if call.Method != "chat.postMessage" || !strings.Contains(blocks, approval.ApproveAction) {
+			continue
+		}
+		var parsed []struct {
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+			Elements []struct {
+				ActionID string `json:"action_id"`
+				Value    string `json:"value"`
+			} `json:"elements"`
+		}
+		if err := json.Unmarshal([]byte(blocks), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range parsed {
+			for _, element := range block.Elements {
+				if element.ActionID == approval.ApproveAction {
+					return prompt{Ts: call.Ts, Blocks: blocks, Text: parsed[0].Text.Text, Value: element.Value}
+				}
+			}
+		}
+	}
+	t.Fatal("no approval prompt was posted")
+	return prompt{}
+}
+
+func decide(ctx context.Context, t *testing.T, action, user, value, promptTs string) error {
+	t.Helper()
+	event, _ := json.Marshal(ApprovalEvent{Action: action, User: user, Value: value, Channel: "C1", MessageTs: promptTs})
+	return handleApproval(ctx, &queue.Message{Type: "approval", Event: event})
+}
+
+func TestApproval(t *testing.T) {
+	env := setup(t, approvalConfig())
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+	args := map[string]interface{}{"pspReference": "8815123456789012", "amount": 1000.0, "currency": "EUR", "reason": strings.Repeat("a long reason ", 200)}
+
+	msg := &slackClient.Message{Channel: "C1", User: "U1", Ts: "1.1"}
+	if err := executeTool(ctx, toolRequest{Msg: msg, Tool: "refund_payment", Args: args}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.tools.called(); len(calls) != 0 {
+		t.Fatalf("ran %v before approval", calls)
+	}
+
+	// The button carries only a signed ID, however large the request
+	p := postedPrompt(t, env)
+	if len(p.Value) > 2000 || strings.Contains(p.Value, "refund_payment") {
+		t.Errorf("button value %q carries the request", p.Value)
+	}
+
+	// Non-admins can't decide
+	if err := decide(ctx, t, approval.ApproveAction, "U2", p.Value, p.Ts); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.tools.called(); len(calls) != 0 {
+		t.Fatalf("a non-admin's approval ran %v", calls)
+	}
+
+	ctx = audit.WithRequestID(context.Background(), "req-2")
+	if err := decide(ctx, t, approval.ApproveAction, "UADMIN", p.Value, p.Ts); err != nil {
+		t.Fatal(err)
+	}
+	env.tools.mu.Lock()
+	calls := env.tools.calls
+	env.tools.mu.Unlock()
+	if len(calls) != 1 || calls[0].Name != "refund_payment" || !reflect.DeepEqual(calls[0].Args, args) {
+		t.Fatalf("approval ran %+v, want refund_payment with the stored arguments", calls)
+	}
+
+	// A second click is refused
+	ctx = audit.WithRequestID(context.Background(), "req-3")
+	if err := decide(ctx, t, approval.ApproveAction, "UADMIN", p.Value, p.Ts); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.tools.called(); len(calls) != 1 {
+		t.Errorf("a second click ran %v", calls)
+	}
+}
+
+func TestApprovalForgedValue(t *testing.T) {
+	env := setup(t, approvalConfig())
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+	msg := &slackClient.Message{Channel: "C1", User: "U1", Ts: "1.1"}
+	if err := executeTool(ctx, toolRequest{Msg: msg, Tool: "refund_payment", Args: map[string]interface{}{"pspReference": "8815123456789012"}}); err != nil {
+		t.Fatal(err)
+	}
+	p := postedPrompt(t, env)
+	id, _, _ := strings.Cut(p.Value, ".")
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"signed with another key", approval.Sign([]byte("guessed"), id)},
+		{"request in the value", `{"id":"` + id + `","t":"refund_payment","u":"U1","c":"C1"}`},
+	}
+	for _, tt := range tests {
+		if err := decide(ctx, t, approval.ApproveAction, "UADMIN", tt.value, p.Ts); err == nil {
+			t.Errorf("%s: decision accepted", tt.name)
+		}
+	}
+
+	// A correctly signed ID nobody stored has expired
+	env.slack.reset()
+	if err := decide(ctx, t, approval.ApproveAction, "UADMIN", approval.Sign(approvalSigningKey(), approval.NewID()), p.Ts); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.tools.called(); len(calls) != 0 {
+		t.Errorf("forged decisions ran %v", calls)
+	}
+	posts := env.slack.called("chat.postMessage")
+	if len(posts) != 1 || !strings.Contains(posts[0].Get("text"), "expired") {
+		t.Errorf("replied %v, want an expiry notice", posts)
+	}
+}
+
+func TestDeleteCancelsApproval(t *testing.T) {
+	env := setup(t, approvalConfig())
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+	msg := &slackClient.Message{Channel: "C1", User: "U1", Ts: "1700000000.000001"}
+	if err := executeTool(ctx, toolRequest{Msg: msg, Tool: "cancel_payment", Args: map[string]interface{}{"pspReference": "8815123456789012"}}); err != nil {
+		t.Fatal(err)
+	}
+	p := postedPrompt(t, env)
+	env.slack.respond("conversations.replies", `{"ok":true,"messages":[
+		{"type":"message","user":"U1","ts":"1700000000.000001"},
+		{"type":"message","user":"UBOT","ts":"`+p.Ts+`","blocks":`+p.Blocks+`}
+	]}`)
+
+	env.slack.reset()
+	event := `{"channel":"C1","deleted_ts":"1700000000.000001","previous_message":{"user":"U1","ts":"1700000000.000001"}}`
+	if err := handleDelete(ctx, &queue.Message{Type: "message_deleted", Event: []byte(event)}); err != nil {
+		t.Fatal(err)
+	}
+	updates := env.slack.called("chat.update")
+	if len(updates) != 1 || updates[0].Get("ts") != p.Ts || !strings.Contains(updates[0].Get("text"), "Cancelled") {
+		t.Fatalf("updates %v, want the prompt cancelled", updates)
+	}
+
+	// The cancelled prompt can't be approved afterwards
+	if err := decide(ctx, t, approval.ApproveAction, "UADMIN", p.Value, p.Ts); err != nil {
+		t.Fatal(err)
+	}
+	if calls := env.tools.called(); len(calls) != 0 {
+		t.Errorf("a cancelled request ran %v", calls)
+	}
+}
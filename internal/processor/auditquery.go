@@ -0,0 +1,273 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// auditQueryTool is an internal tool offered to the LLM for admins only
+const auditQueryTool = "query_audit_log"
+
+// auditCommand is the deterministic prefix for audit queries, e.g.
+// "audit user:@jane type:denied since:7d csv"
+const auditCommand = "audit"
+
+// maxTableRows is the most rows shown inline before switching to a CSV upload
+const maxTableRows = 20
+
+var (
+	userMentionPattern    = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+	channelMentionPattern = regexp.MustCompile(`^<#([A-Z0-9]+)(?:\|[^>]*)?>$`)
+	relativeTimePattern   = regexp.MustCompile(`^(\d+)([hdw])$`)
+)
+
+// auditQueryToolDef describes the audit query tool to the LLM
+func auditQueryToolDef() llm.Tool {
+	return llm.Tool{
+		Name: auditQueryTool,
+		Description: "Search the bot's audit log of Adyen actions. Use for questions like " +
+			"\"who refunded anything this week?\" or \"show denied actions for @jane\".",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"user":       map[string]interface{}{"type": "string", "description": "Slack user ID or <@mention>"},
+				"tool":       map[string]interface{}{"type": "string", "description": "Tool name or part of it, e.g. refund"},
+				"event_type": map[string]interface{}{"type": "string", "enum": []string{"allowed", "denied", "approved", "rejected", "error", "revealed"}},
+				"channel":    map[string]interface{}{"type": "string", "description": "Slack channel ID or <#mention>"},
+				"since":      map[string]interface{}{"type": "string", "description": "Start time: 24h, 7d, 2w, today, week or YYYY-MM-DD"},
+				"until":      map[string]interface{}{"type": "string", "description": "End time, same formats as since"},
+				"min_amount": map[string]interface{}{"type": "number", "description": "Only actions of at least this amount, in major units (e.g. 1000 for €1,000)"},
+				"currency":   map[string]interface{}{"type": "string", "description": "ISO currency code for min_amount, e.g. EUR"},
+				"limit":      map[string]interface{}{"type": "integer", "description": "Maximum rows, default 50"},
+				"format":     map[string]interface{}{"type": "string", "enum": []string{"table", "csv"}},
+			},
+		},
+	}
+}
+
+// isAuditCommand returns true if text starts with the audit command word
+func isAuditCommand(text string) bool {
+	fields := strings.Fields(text)
+	return len(fields) > 0 && strings.EqualFold(fields[0], auditCommand)
+}
+
+// parseAuditCommand parses "audit key:value ... [csv]"
+func parseAuditCommand(text string, now time.Time) (audit.Query, bool, error) {
+	input := map[string]interface{}{}
+	for _, field := range strings.Fields(text)[1:] {
+		if strings.EqualFold(field, "csv") {
+			input["format"] = "csv"
+			continue
+		}
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return audit.Query{}, false, fmt.Errorf("expected key:value, got %q", field)
+		}
+		key = strings.ToLower(key)
+		switch key {
+		case "type":
+			key = "event_type"
+		case "action":
+			key = "tool"
+		case "min":
+			key = "min_amount"
+		}
+		input[key] = value
+	}
+	return queryFromInput(input, now)
+}
+
+// queryFromInput builds a query from command fields or LLM tool input
+func queryFromInput(input map[string]interface{}, now time.Time) (audit.Query, bool, error) {
+	var q audit.Query
+	asCSV := false
+
+	for key, raw := range input {
+		value := strings.TrimSpace(fmt.Sprint(raw))
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "user":
+			q.UserID = unwrapMention(value, userMentionPattern)
+		case "tool":
+			q.Action = value
+		case "event_type":
+			q.EventType = audit.EventType(strings.ToLower(value))
+		case "channel":
+			q.Channel = unwrapMention(value, channelMentionPattern)
+		case "since", "until":
+			t, err := parseAuditTime(value, now)
+			if err != nil {
+				return q, false, err
+			}
+			if key == "since" {
+				q.Since = t
+			} else {
+				q.Until = t
+			}
+		case "min_amount":
+			n, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+			if err != nil || n < 0 {
+				return q, false, fmt.Errorf("invalid amount %q", value)
+			}
+			q.MinAmount = n
+		case "currency":
+			q.Currency = strings.ToUpper(value)
+		case "limit":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || n < 1 {
+				return q, false, fmt.Errorf("invalid limit %q", value)
+			}
+			q.Limit = int(n)
+		case "format":
+			asCSV = strings.EqualFold(value, "csv")
+		default:
+			return q, false, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	return q, asCSV, nil
+}
+
+func unwrapMention(value string, pattern *regexp.Regexp) string {
+	if m := pattern.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return strings.TrimLeft(value, "@#")
+}
+
+// parseAuditTime accepts relative durations (24h, 7d, 2w), today, week and dates
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(value) {
+	case "today":
+		return today, nil
+	case "week":
+		// Weeks start on Monday
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset), nil
+	}
+
+	if m := relativeTimePattern.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use e.g. 24h, 7d, today, week or YYYY-MM-DD", value)
+}
+
+// runAuditQuery executes an audit query for an admin and replies with a table
+// or CSV. Results hold other users' activity, so they are only ever shown to
+// the admin, whatever SLACK_EPHEMERAL_REPLIES says.
+func runAuditQuery(ctx context.Context, msg *slackClient.Message, status *statusTracker, q audit.Query, asCSV bool) error {
+	args := map[string]interface{}{
+		"user": q.UserID, "tool": q.Action, "event_type": string(q.EventType), "channel": q.Channel,
+		"min_amount": q.MinAmount, "currency": q.Currency,
+	}
+
+	if !permChecker.IsAdmin(msg.User) {
+		reason := "Only admins can query the audit log."
+		auditLogger.LogDenied(ctx, msg.User, auditQueryTool, msg.Channel, args, reason)
+		status.set(statusDenied)
+		return reply(msg, replyDenial, reason)
+	}
+
+	status.set(statusWorking)
+	entries, err := auditLogger.Query(ctx, q)
+	if errors.Is(err, audit.ErrNotQueryable) {
+		return slack.ReplyPrivately(msg, "The audit log can't be queried: no durable audit store is configured.", nil, nil)
+	}
+	if err != nil {
+		auditLogger.LogError(ctx, msg.User, auditQueryTool, msg.Channel, args, err.Error(), 0)
+		status.set(statusFailed)
+		return reply(msg, replyError, fmt.Sprintf("Error: %s", err.Error()))
+	}
+
+	auditLogger.LogAllowed(ctx, msg.User, auditQueryTool, msg.Channel, args, fmt.Sprintf("%d entries", len(entries)), 0)
+
+	if len(entries) == 0 {
+		return slack.ReplyPrivately(msg, "No audit entries match.", nil, nil)
+	}
+	if asCSV || len(entries) > maxTableRows {
+		title := fmt.Sprintf("Audit log (%d entries)", len(entries))
+		return slack.ReplyPrivately(msg, title, nil, &slackClient.File{Filename: "audit.csv", Title: title, Content: auditCSV(entries)})
+	}
+	return slack.ReplyPrivately(msg, auditTable(entries), nil, nil)
+}
+
+func auditTable(entries []audit.Entry) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME (UTC)\tUSER\tEVENT\tTOOL\tPSP REFERENCE\tAMOUNT\tDETAILS")
+	for _, e := range entries {
+		details := e.Details
+		if runes := []rune(details); len(runes) > 40 {
+			details = string(runes[:40]) + "…"
+		}
+		amount := ""
+		if e.Amount != nil {
+			amount = e.Amount.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Timestamp.UTC().Format("2006-01-02 15:04"), e.UserID, e.EventType, e.Action, e.PSPReference, amount, details)
+	}
+	w.Flush()
+	return fmt.Sprintf("*%d audit entries*\n```\n%s```", len(entries), buf.String())
+}
+
+func auditCSV(entries []audit.Entry) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"timestamp", "sequence", "request_id", "environment", "user", "event", "tool", "channel", "approved_by",
+		"psp_reference", "amount_minor", "currency", "merchant_account", "duration_ms", "details", "result_summary"})
+	for _, e := range entries {
+		var value, currency string
+		if e.Amount != nil {
+			value, currency = strconv.FormatInt(e.Amount.Value, 10), e.Amount.Currency
+		}
+		w.Write([]string{
+			e.Timestamp.UTC().Format(time.RFC3339),
+			strconv.FormatUint(e.Sequence, 10),
+			e.RequestID,
+			e.Environment,
+			e.UserID,
+			string(e.EventType),
+			e.Action,
+			e.Channel,
+			e.ApprovedBy,
+			e.PSPReference,
+			value,
+			currency,
+			e.MerchantAccount,
+			strconv.FormatInt(e.Duration.Milliseconds(), 10),
+			e.Details,
+			e.ResultSummary,
+		})
+	}
+	w.Flush()
+	return buf.String()
+}
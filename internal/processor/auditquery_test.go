@@ -0,0 +1,200 @@
+package processor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+)
+
+// now is a Wednesday afternoon
+var now = time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)
+
+func TestParseAuditTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "today", want: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{value: "TODAY", want: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{value: "week", want: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "7d", want: time.Date(2026, 2, 25, 15, 30, 0, 0, time.UTC)},
+		{value: "2w", want: time.Date(2026, 2, 18, 15, 30, 0, 0, time.UTC)},
+		{value: "2026-01-31", want: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{value: "2026-01-31T10:00:00+01:00", want: time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)},
+		{value: "yesterday", wantErr: true},
+		{value: "7m", wantErr: true},
+		{value: "31/01/2026", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAuditTime(tt.value, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseAuditTime = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseAuditTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// On a Sunday the week began the Monday before
+	sunday := time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC)
+	if got, _ := parseAuditTime("week", sunday); !got.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("week on a Sunday = %v", got)
+	}
+}
+
+func TestParseAuditCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    audit.Query
+		wantCSV bool
+		wantErr string
+	}{
+		{
+			name: "no filters",
+			text: "audit",
+		},
+		{
+			name: "aliases",
+			text: "audit user:<@U123|jane> type:Denied action:refund min:1,000 currency:eur since:today",
+			want: audit.Query{
+				UserID:    "U123",
+				EventType: audit.EventDenied,
+				Action:    "refund",
+				MinAmount: 1000,
+				Currency:  "EUR",
+				Since:     time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "csv",
+			text:    "Audit channel:<#C42|payments> limit:10 CSV",
+			want:    audit.Query{Channel: "C42", Limit: 10},
+			wantCSV: true,
+		},
+		{
+			name: "bare mentions",
+			text: "audit user:@U123 channel:#C42 until:2026-03-01",
+			want: audit.Query{UserID: "U123", Channel: "C42", Until: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "not key:value",
+			text:    "audit refunds",
+			wantErr: `expected key:value, got "refunds"`,
+		},
+		{
+			name:    "unknown filter",
+			text:    "audit merchant:Acme",
+			wantErr: `unknown filter "merchant"`,
+		},
+		{
+			name:    "invalid limit",
+			text:    "audit limit:0",
+			wantErr: `invalid limit "0"`,
+		},
+		{
+			name:    "invalid amount",
+			text:    "audit min:-5",
+			wantErr: `invalid amount "-5"`,
+		},
+		{
+			name:    "invalid time",
+			text:    "audit since:soon",
+			wantErr: `invalid time "soon"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, asCSV, err := parseAuditCommand(tt.text, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAuditCommand = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || asCSV != tt.wantCSV {
+				t.Errorf("parseAuditCommand = %+v, %v; want %+v, %v", got, asCSV, tt.want, tt.wantCSV)
+			}
+		})
+	}
+}
+
+func TestQueryFromInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]interface{}
+		want    audit.Query
+		wantCSV bool
+		wantErr bool
+	}{
+		{
+			// The LLM sends JSON numbers and empty strings for unused fields
+			name: "tool input",
+			input: map[string]interface{}{
+				"user": "<@U123>", "tool": "", "event_type": "approved", "min_amount": 250.5,
+				"limit": 5.0, "format": "csv", "since": "7d",
+			},
+			want: audit.Query{
+				UserID:    "U123",
+				EventType: audit.EventApproved,
+				MinAmount: 250.5,
+				Limit:     5,
+				Since:     time.Date(2026, 2, 25, 15, 30, 0, 0, time.UTC),
+			},
+			wantCSV: true,
+		},
+		{
+			name:  "table format",
+			input: map[string]interface{}{"format": "table", "channel": "<#C42>"},
+			want:  audit.Query{Channel: "C42"},
+		},
+		{
+			name:    "fractional limit below one",
+			input:   map[string]interface{}{"limit": 0.5},
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric amount",
+			input:   map[string]interface{}{"min_amount": "lots"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			input:   map[string]interface{}{"merchant": "Acme"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, asCSV, err := queryFromInput(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("queryFromInput = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || asCSV != tt.wantCSV {
+				t.Errorf("queryFromInput = %+v, %v; want %+v, %v", got, asCSV, tt.want, tt.wantCSV)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/bulk"
+	"github.com/getalternative/adyen-slack-assistant/internal/permissions"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// bulkPrefix starts a bulk command: bulk [tool] [name=value ...] [PSP references ...]
+const bulkPrefix = "bulk"
+
+// bulkUsage is shown when a bulk command can't be run
+const bulkUsage = "Usage: `bulk [status|refund|cancel|capture|<tool>] [name=value …] PSP references…`, or attach a CSV of PSP references."
+
+// bulkAliases are the short tool names a bulk command accepts
+var bulkAliases = map[string]string{
+	"status":  "get_payment",
+	"lookup":  "get_payment",
+	"refund":  "refund_payment",
+	"cancel":  "cancel_payment",
+	"capture": "capture_payment",
+}
+
+// progressInterval spaces out progress edits, within Slack's rate limit on updates
+var progressInterval = 2 * time.Second
+
+func isBulkCommand(text string) bool {
+	fields := strings.Fields(text)
+	return len(fields) > 0 && strings.EqualFold(fields[0], bulkPrefix)
+}
+
+// bulkRequest builds a bulk job from a bulk command and an attached CSV.
+// A CSV on its own is looked up with get_payment if it has a PSP reference
+// column; otherwise it returns errNotBulk.
+func bulkRequest(text string, file *slackapi.File) (toolRequest, error) {
+	req := toolRequest{Tool: lookupTool, Args: map[string]interface{}{}}
+	var refs []string
+	command := isBulkCommand(text)
+	if command {
+		var err error
+		req.Tool, req.Args, refs, err = parseBulkCommand(text)
+		if err != nil {
+			return req, err
+		}
+	}
+	if file != nil {
+		fromFile, err := fileReferences(*file, command)
+		if err != nil {
+			return req, err
+		}
+		refs = append(refs, fromFile...)
+	}
+
+	// Cells that look like card numbers are never sent to Adyen
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if !seen[ref] && redactor.Text(ref) == ref {
+			seen[ref] = true
+			req.Items = append(req.Items, ref)
+		}
+	}
+
+	switch {
+	case len(req.Items) == 0:
+		return req, errors.New("no PSP references found")
+	case len(req.Items) > cfg.Bulk.MaxItems:
+		return req, fmt.Errorf("%d PSP references, but at most %d can run at once", len(req.Items), cfg.Bulk.MaxItems)
+	case !hasTool(req.Tool):
+		return req, fmt.Errorf("unknown tool `%s`", req.Tool)
+	}
+	return req, nil
+}
+
+// parseBulkCommand reads the tool, the arguments shared by every item and
+// the inline PSP references of a bulk command. Argument values are JSON when
+// they parse as JSON, e.g. amount={"value":1000,"currency":"EUR"}, and
+// strings otherwise.
+func parseBulkCommand(text string) (string, map[string]interface{}, []string, error) {
+	tool := ""
+	args := map[string]interface{}{}
+	var refs []string
+	for _, field := range strings.Fields(text)[1:] {
+		if name, value, ok := strings.Cut(field, "="); ok && name != "" {
+			var v interface{}
+			if err := json.Unmarshal([]byte(value), &v); err != nil {
+				v = value
+			}
+			args[name] = v
+			continue
+		}
+		if found := bulk.References(field); len(found) > 0 {
+			refs = append(refs, found...)
+			continue
+		}
+		if tool != "" {
+			return "", nil, nil, fmt.Errorf("unexpected `%s`", field)
+		}
+		tool = strings.ToLower(field)
+		if alias, ok := bulkAliases[tool]; ok {
+			tool = alias
+		}
+	}
+	if tool == "" {
+		tool = lookupTool
+	}
+	return tool, args, refs, nil
+}
+
+func hasTool(name string) bool {
+	for _, tool := range adyenClient.GetTools() {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkTotal is the amount a bulk job moves in all, when every item shares
+// an amount argument; refunds of each payment's full amount have no total
+func bulkTotal(args map[string]interface{}, items int) string {
+	amount, ok := adyen.AmountFrom(args["amount"])
+	if !ok || items == 0 {
+		return ""
+	}
+	amount.Value *= int64(items)
+	return amount.String()
+}
+
+// bulkArgs are the arguments recorded for a bulk job as a whole
+func bulkArgs(args map[string]interface{}, items []string) map[string]interface{} {
+	if len(items) == 0 {
+		return args
+	}
+	all := make(map[string]interface{}, len(args)+1)
+	for k, v := range args {
+		all[k] = v
+	}
+	all["pspReferences"] = items
+	return all
+}
+
+// itemArgs are the arguments for one item of a bulk job
+func itemArgs(args map[string]interface{}, item string) map[string]interface{} {
+	all := make(map[string]interface{}, len(args)+1)
+	for k, v := range args {
+		all[k] = v
+	}
+	all["pspReference"] = item
+	return all
+}
+
+// runBulk runs a bulk job once permissions and approval are settled. One
+// message in the thread shows progress; the results are attached as a CSV.
+// Every item is audited on its own, and writes are claimed per item, so a
+// redelivered job skips the items an earlier attempt already ran.
+func runBulk(ctx context.Context, req toolRequest) error {
+	msg := req.Msg
+	user, channel := msg.User, msg.Channel
+	write := permissions.IsWriteAction(req.Tool)
+
+	req.Status.set(statusWorking)
+	progress := startProgress(msg, req.Tool, len(req.Items))
+	results := bulk.Run(ctx, req.Items, cfg.Bulk.Concurrency, func(ctx context.Context, item string) (string, error) {
+		args := itemArgs(req.Args, item)
+		if write {
+			claimed, err := claimWrite(ctx, req.Tool, item)
+			if err != nil {
+				return "", fmt.Errorf("not run: failed to claim write: %w", err)
+			}
+			if !claimed {
+				auditLogger.LogError(ctx, user, req.Tool, channel, args, "Not run again: an earlier attempt at this request may already have run it", 0)
+				return "", errors.New("not run again: an earlier attempt may already have run it")
+			}
+			if err := auditLogger.LogAttempted(ctx, user, req.Tool, channel, args); errors.Is(err, audit.ErrNotPersisted) && cfg.Audit.FailClosed {
+				return "", errors.New("not run: the audit log can't be written")
+			}
+		}
+
+		start := time.Now()
+		result, err := adyenClient.CallTool(ctx, req.Tool, args)
+		duration := time.Since(start)
+		if err != nil {
+			auditLogger.LogError(ctx, user, req.Tool, channel, args, err.Error(), duration)
+			return "", err
+		}
+		auditLogger.LogAllowed(ctx, user, req.Tool, channel, args, result, duration)
+		return result, nil
+	}, progress.update)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"psp_reference", "status", "amount_minor", "currency", "merchant_reference", "merchant_account", "error"})
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			w.Write([]string{r.Item, "", "", "", "", "", redactor.Text(r.Err.Error())})
+			continue
+		}
+		output := r.Output
+		if !req.Reveal {
+			output = redactor.Result(output)
+		}
+		w.Write(paymentRow(r.Item, output))
+	}
+	w.Flush()
+	summary := progress.finish(failed)
+
+	kind := replyAnswer
+	if req.Reveal {
+		auditLogger.LogRevealed(ctx, user, req.Tool, channel, req.auditArgs(), "Unredacted bulk results shown in thread")
+		kind = replyReveal
+	}
+	file := &slackClient.File{
+		Filename: req.Tool + ".csv",
+		Title:    fmt.Sprintf("%s on %d payments", req.Tool, len(req.Items)),
+		Content:  buf.String(),
+	}
+	var err error
+	if kind.private() {
+		err = slack.ReplyPrivately(msg, summary, nil, file)
+	} else {
+		err = slack.UploadFile(msg, file.Filename, file.Title, file.Content)
+	}
+
+	// Once writes have run, a failed reply must not send the job round again
+	if write {
+		return queue.Terminal(err)
+	}
+	return err
+}
+
+// bulkProgress keeps one message in the thread up to date with a bulk job.
+// Items only record their counts; the message is edited from its own
+// goroutine, so a slow Slack call never holds up the items.
+type bulkProgress struct {
+	msg   *slackClient.Message
+	tool  string
+	total int
+	ts    string
+
+	mu           sync.Mutex
+	done, failed int
+	stop         chan struct{}
+	stopped      chan struct{}
+}
+
+// startProgress posts the progress message, taking over the webhook's
+// placeholder when there is one
+func startProgress(msg *slackClient.Message, tool string, total int) *bulkProgress {
+	p := &bulkProgress{msg: msg, tool: tool, total: total, ts: msg.AckTs}
+	msg.AckTs = ""
+
+	text := p.text(0, 0)
+	if p.ts != "" {
+		if err := slack.UpdateMessage(msg.Channel, p.ts, text); err != nil {
+			fmt.Printf("Failed to update progress: %v\n", err)
+		}
+	} else {
+		ts, err := slack.PostToChannel(msg.Channel, msg.GetThreadTs(), text)
+		if err != nil {
+			fmt.Printf("Failed to post progress: %v\n", err)
+		}
+		p.ts = ts
+	}
+
+	if p.ts != "" {
+		p.stop, p.stopped = make(chan struct{}), make(chan struct{})
+		go p.run()
+	}
+	return p
+}
+
+func (p *bulkProgress) text(done, failed int) string {
+	return fmt.Sprintf(":hourglass_flowing_sand: Running `%s` on %d payments: %d done, %d failed", p.tool, p.total, done, failed)
+}
+
+// update records the counts for the next edit
+func (p *bulkProgress) update(done, failed int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done, p.failed = done, failed
+}
+
+// run edits the progress message every progressInterval while counts change
+func (p *bulkProgress) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	shown := 0
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		done, failed := p.done, p.failed
+		p.mu.Unlock()
+		if done == shown {
+			continue
+		}
+		shown = done
+		if err := slack.UpdateMessage(p.msg.Channel, p.ts, p.text(done, failed)); err != nil {
+			fmt.Printf("Failed to update progress: %v\n", err)
+		}
+	}
+}
+
+// finish replaces the progress with a summary, which it returns
+func (p *bulkProgress) finish(failed int) string {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.stopped
+	}
+
+	icon := ":white_check_mark:"
+	if failed > 0 {
+		icon = ":warning:"
+	}
+	text := fmt.Sprintf("%s Ran `%s` on %d payments: %d succeeded, %d failed.", icon, p.tool, p.total, p.total-failed, failed)
+
+	var err error
+	if p.ts != "" {
+		err = slack.UpdateMessage(p.msg.Channel, p.ts, text)
+	} else {
+		err = slack.Reply(p.msg, text)
+	}
+	if err != nil {
+		fmt.Printf("Failed to post bulk summary: %v\n", err)
+	}
+	return text
+}
+
+// paymentRow is one item's result as a CSV row
+func paymentRow(ref, result string) []string {
+	var payment struct {
+		Status            string        `json:"status"`
+		ResultCode        string        `json:"resultCode"`
+		Amount            *adyen.Amount `json:"amount"`
+		MerchantReference string        `json:"merchantReference"`
+		Reference         string        `json:"reference"`
+		MerchantAccount   string        `json:"merchantAccount"`
+	}
+	json.Unmarshal([]byte(result), &payment)
+
+	status := payment.Status
+	if status == "" {
+		status = payment.ResultCode
+	}
+	reference := payment.MerchantReference
+	if reference == "" {
+		reference = payment.Reference
+	}
+	var value, currency string
+	if payment.Amount != nil {
+		value, currency = strconv.FormatInt(payment.Amount.Value, 10), payment.Amount.Currency
+	}
+	return []string{ref, status, value, currency, reference, payment.MerchantAccount, ""}
+}
@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/approval"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+func bulkConfig(approvals bool) *config.Config {
+	c := approvalConfig()
+	c.Permissions.Approvals = approvals
+	c.Bulk = config.BulkConfig{Concurrency: 2, MaxItems: 200}
+	return c
+}
+
+// allowUploads lets CSV results be uploaded to fakeSlack
+func allowUploads(env *testEnv) {
+	env.slack.respond("files.getUploadURLExternal", fmt.Sprintf(`{"ok":true,"upload_url":"%s/upload","file_id":"F1"}`, env.url))
+	env.slack.respond("files.completeUploadExternal", `{"ok":true,"files":[{"id":"F1"}]}`)
+}
+
+func references(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("8815123456%06d", i)
+	}
+	return out
+}
+
+func TestBulkWritesWaitForAClick(t *testing.T) {
+	eur10 := map[string]interface{}{"amount": map[string]interface{}{"value": 1000.0, "currency": "EUR"}}
+	tests := []struct {
+		name       string
+		approvals  bool
+		user       string
+		tool       string
+		args       map[string]interface{}
+		wantCalls  int
+		wantPrompt string // in the prompt, empty for none
+		wantReply  string
+	}{
+		{
+			name:      "non-admin capture",
+			user:      "U1",
+			tool:      "capture_payment",
+			wantReply: "Only admins",
+		},
+		{
+			name:       "non-admin capture with approvals",
+			approvals:  true,
+			user:       "U1",
+			tool:       "capture_payment",
+			args:       eur10,
+			wantPrompt: "<@U1> wants to run `capture_payment` on 3 payments, €30.00 in total. <@UADMIN>, please review.",
+		},
+		{
+			name:       "admin refund",
+			user:       "UADMIN",
+			tool:       "refund_payment",
+			args:       eur10,
+			wantPrompt: "<@UADMIN>, please confirm running `refund_payment` on 3 payments, €30.00 in total.",
+		},
+		{
+			// Without an amount each payment is refunded in full
+			name:       "admin refund in full",
+			user:       "UADMIN",
+			tool:       "refund_payment",
+			wantPrompt: "<@UADMIN>, please confirm running `refund_payment` on 3 payments.",
+		},
+		{
+			name:       "admin payment link update",
+			user:       "UADMIN",
+			tool:       "update_payment_link",
+			wantPrompt: "please confirm running `update_payment_link` on 3 payments",
+		},
+		{
+			name:      "admin lookup",
+			user:      "UADMIN",
+			tool:      "get_payment",
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setup(t, bulkConfig(tt.approvals))
+			allowUploads(env)
+			ctx := audit.WithRequestID(context.Background(), "req-1")
+			msg := &slackClient.Message{Channel: "C1", User: tt.user, Ts: "1.1"}
+
+			err := executeTool(ctx, toolRequest{Msg: msg, Tool: tt.tool, Args: tt.args, Items: references(3)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls := env.tools.called(); len(calls) != tt.wantCalls {
+				t.Errorf("ran %v, want %d calls", calls, tt.wantCalls)
+			}
+			if tt.wantPrompt != "" {
+				if p := postedPrompt(t, env); !strings.Contains(p.Text, tt.wantPrompt) {
+					t.Errorf("prompt %q, want %q", p.Text, tt.wantPrompt)
+				}
+			}
+			if tt.wantReply != "" {
+				posts := env.slack.called("chat.postMessage")
+				if len(posts) != 1 || !strings.Contains(posts[0].Get("text"), tt.wantReply) {
+					t.Errorf("replied %v, want %q", posts, tt.wantReply)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkConfirm(t *testing.T) {
+	for _, action := range []string{approval.ApproveAction, approval.RejectAction} {
+		t.Run(action, func(t *testing.T) {
+			env := setup(t, bulkConfig(false))
+			allowUploads(env)
+			ctx := audit.WithRequestID(context.Background(), "req-1")
+			msg := &slackClient.Message{Channel: "C1", User: "UADMIN", Ts: "1.1"}
+			if err := executeTool(ctx, toolRequest{Msg: msg, Tool: "refund_payment", Items: references(200)}); err != nil {
+				t.Fatal(err)
+			}
+
+			// A batch at BULK_MAX_ITEMS still fits in the prompt
+			p := postedPrompt(t, env)
+			ctx = audit.WithRequestID(context.Background(), "req-2")
+			if err := decide(ctx, t, action, "UADMIN", p.Value, p.Ts); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := env.tools.called()
+			updates := env.slack.called("chat.update")
+			outcome := updates[0].Get("text")
+			if action == approval.ApproveAction {
+				if len(calls) != 200 || !strings.Contains(outcome, "Approved by <@UADMIN>") {
+					t.Errorf("confirming ran %d calls and resolved the prompt as %q", len(calls), outcome)
+				}
+				return
+			}
+			if len(calls) != 0 || !strings.Contains(outcome, "Cancelled by <@UADMIN>") {
+				t.Errorf("cancelling ran %d calls and resolved the prompt as %q", len(calls), outcome)
+			}
+		})
+	}
+}
+
+func TestBulkProgress(t *testing.T) {
+	interval := progressInterval
+	progressInterval = 5 * time.Millisecond
+	defer func() { progressInterval = interval }()
+
+	env := setup(t, bulkConfig(false))
+	allowUploads(env)
+	env.tools.delay = 2 * time.Millisecond
+	// Slack is slow to take progress edits; items carry on regardless
+	slow := make(chan struct{})
+	env.slack.hold("chat.update", slow)
+
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+	msg := &slackClient.Message{Channel: "C1", User: "UADMIN", Ts: "1.1"}
+	done := make(chan error)
+	go func() {
+		done <- runBulk(ctx, toolRequest{Msg: msg, Tool: "get_payment", Items: references(40)})
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for len(env.tools.called()) < 40 {
+		select {
+		case <-deadline:
+			t.Fatalf("only %d items ran while a progress edit was stuck", len(env.tools.called()))
+		case <-time.After(time.Millisecond):
+		}
+	}
+	close(slow)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	updates := env.slack.called("chat.update")
+	if len(updates) < 2 {
+		t.Fatalf("%d progress edits, want some progress and the summary", len(updates))
+	}
+	if !strings.Contains(updates[0].Get("text"), "done") {
+		t.Errorf("first edit = %q, want progress", updates[0].Get("text"))
+	}
+	if last := updates[len(updates)-1].Get("text"); !strings.Contains(last, "40 succeeded, 0 failed") {
+		t.Errorf("last edit = %q, want the summary", last)
+	}
+}
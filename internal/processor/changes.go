@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/approval"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// EditEvent is a message_changed event for a question
+type EditEvent struct {
+	Channel         string       `json:"channel"`
+	Message         MessageEvent `json:"message"`
+	PreviousMessage MessageEvent `json:"previous_message"`
+}
+
+// DeletedEvent is a message_deleted event, or the message_changed event that
+// leaves a tombstone when a thread's parent is deleted
+type DeletedEvent struct {
+	Channel         string       `json:"channel"`
+	DeletedTs       string       `json:"deleted_ts"`
+	PreviousMessage MessageEvent `json:"previous_message"`
+}
+
+// handleEdit answers an edited question again, replacing the previous answer
+func handleEdit(ctx context.Context, queueMsg *queue.Message) error {
+	var event EditEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse edit event: %w", err)
+	}
+
+	question := event.Message
+	question.Channel = event.Channel
+	question.Edited = true
+	question.AckTs = previousAnswer(ctx, question)
+	return answer(ctx, question, queueMsg.BotUserID)
+}
+
+// answerTTL is how long an edited question still replaces its answer; after
+// that it is answered anew
+const answerTTL = 30 * 24 * time.Hour
+
+// answerKey names the answer to the question at ts
+func answerKey(channel, ts string) string {
+	return fmt.Sprintf("answer/%s/%s", channel, ts)
+}
+
+// recordAnswer remembers the first reply to a question, if one was sent
+func recordAnswer(ctx context.Context, question *slackClient.Message) {
+	if question.Answered == "" {
+		return
+	}
+	if err := idempotent.Put(ctx, answerKey(question.Channel, question.Ts), question.Answered, answerTTL); err != nil {
+		fmt.Printf("Failed to record the answer to %s: %v\n", question.Ts, err)
+	}
+}
+
+// previousAnswer returns the reply recorded for a question, if any
+func previousAnswer(ctx context.Context, question MessageEvent) string {
+	ts, _, err := idempotent.Get(ctx, answerKey(question.Channel, question.Ts))
+	if err != nil {
+		fmt.Printf("Failed to find the previous answer to %s: %v\n", question.Ts, err)
+		return ""
+	}
+	return ts
+}
+
+// handleDelete cancels approval prompts still waiting on a request whose
+// message was deleted, so nobody approves a request its author withdrew
+func handleDelete(ctx context.Context, queueMsg *queue.Message) error {
+	var event DeletedEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse delete event: %w", err)
+	}
+
+	deleted := event.PreviousMessage
+	ts := event.DeletedTs
+	if ts == "" {
+		ts = deleted.Ts
+	}
+	threadTs := deleted.ThreadTs
+	if threadTs == "" {
+		threadTs = ts
+	}
+
+	// A message without replies has no prompts to cancel
+	replies, err := slack.GetThreadReplies(event.Channel, threadTs)
+	if err != nil {
+		if isSlackError(err, "thread_not_found") {
+			return nil
+		}
+		return fmt.Errorf("failed to read thread: %w", err)
+	}
+
+	for _, m := range replies {
+		id, pending := approval.Pending(m, approvalSigningKey())
+		if !pending {
+			continue
+		}
+		r, found, err := loadApproval(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !found || r.Ts != ts {
+			continue
+		}
+		if err := cancelApproval(ctx, event.Channel, m.Timestamp, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelApproval decides a prompt as cancelled, unless an admin got there first
+func cancelApproval(ctx context.Context, channel, promptTs string, r approval.Request) error {
+	claimed, err := idempotent.Claim(ctx, approvalKey(channel, promptTs), decisionTTL)
+	if err != nil {
+		return queue.Retryable(fmt.Errorf("failed to claim approval: %w", err))
+	}
+	if !claimed {
+		return nil
+	}
+
+	auditLogger.LogDenied(ctx, r.User, r.Tool, r.Channel, bulkArgs(r.Args, r.Items), "Approval cancelled: the request was deleted")
+	resolveApproval(ApprovalEvent{Channel: channel, MessageTs: promptTs}, r, ":wastebasket: Cancelled: the request was deleted")
+	return nil
+}
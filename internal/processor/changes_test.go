@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+)
+
+func TestEditReplacesAnswer(t *testing.T) {
+	env := setup(t, &config.Config{})
+	ctx := context.Background()
+
+	// A non-admin asking to reveal is answered without the LLM
+	question := MessageEvent{Channel: "C1", User: "U1", Text: "<@UBOT> reveal 8815123456789012", Ts: "1.1"}
+	if err := answer(ctx, question, "UBOT"); err != nil {
+		t.Fatal(err)
+	}
+	posts := env.slack.called("chat.postMessage")
+	if len(posts) != 1 {
+		t.Fatalf("answered with %d posts, want 1", len(posts))
+	}
+	var answerTs string
+	for _, call := range env.slack.calls {
+		if call.Method == "chat.postMessage" {
+			answerTs = call.Ts
+		}
+	}
+
+	// The edit replaces that answer without reading the thread
+	env.slack.reset()
+	edit := &queue.Message{
+		ID:        "Ev002",
+		Type:      "message_changed",
+		BotUserID: "UBOT",
+		Event:     []byte(`{"channel":"C1","message":{"user":"U1","text":"<@UBOT> reveal 8815123456789013","ts":"1.1"},"previous_message":{"user":"U1","text":"<@UBOT> reveal 8815123456789012","ts":"1.1"}}`),
+	}
+	if err := handleEdit(ctx, edit); err != nil {
+		t.Fatal(err)
+	}
+	if got := env.slack.called("conversations.replies"); len(got) != 0 {
+		t.Errorf("read the thread %d times", len(got))
+	}
+	if got := env.slack.called("chat.postMessage"); len(got) != 0 {
+		t.Errorf("posted %d new answers", len(got))
+	}
+	updates := env.slack.called("chat.update")
+	if len(updates) != 1 || updates[0].Get("ts") != answerTs {
+		t.Fatalf("updated %v, want the answer %s", updates, answerTs)
+	}
+
+	// A question never answered is answered anew
+	env.slack.reset()
+	edit.Event = []byte(`{"channel":"C1","message":{"user":"U1","text":"<@UBOT> reveal 8815123456789013","ts":"1.5"},"previous_message":{"user":"U1","text":"<@UBOT> hi","ts":"1.5"}}`)
+	if err := handleEdit(ctx, edit); err != nil {
+		t.Fatal(err)
+	}
+	if got := env.slack.called("chat.update"); len(got) != 0 {
+		t.Errorf("updated %v", got)
+	}
+	if got := env.slack.called("chat.postMessage"); len(got) != 1 || got[0].Get("thread_ts") != "1.5" {
+		t.Errorf("posted %v, want an answer in thread 1.5", got)
+	}
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+)
+
+// CommandEvent is a slash command queued by the webhook
+type CommandEvent struct {
+	Command string `json:"command"`
+	Text    string `json:"text"`
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+}
+
+// handleCommand answers a slash command. Commands have no message to reply
+// to, so the question is posted in the channel and answered in its thread.
+func handleCommand(ctx context.Context, queueMsg *queue.Message) error {
+	var event CommandEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse slash command: %w", err)
+	}
+
+	// A delivery after a failed answer reuses the question posted by the
+	// first one rather than asking again
+	postedKey := "command/" + queueMsg.ID
+	ts, posted, err := idempotent.Get(ctx, postedKey)
+	if err != nil {
+		return queue.Retryable(fmt.Errorf("failed to look up slash command: %w", err))
+	}
+	if !posted {
+		// The question is posted for the whole channel, so card numbers and
+		// other PII typed into the command are redacted like any other output
+		ts, err = slack.PostToChannel(event.Channel, "", fmt.Sprintf("<@%s> asked: %s", event.User, redactor.Text(event.Text)))
+		if err != nil {
+			slack.SendDM(event.User, fmt.Sprintf("I couldn't post in <#%s>, so I couldn't answer `%s`. Invite me to the channel and try again.", event.Channel, event.Command))
+			return fmt.Errorf("failed to post slash command: %w", err)
+		}
+		if err := idempotent.Put(ctx, postedKey, ts, writeTTL); err != nil {
+			fmt.Printf("Failed to record slash command %s: %v\n", queueMsg.ID, err)
+		}
+	}
+
+	return answer(ctx, MessageEvent{
+		Type:    "slash_command",
+		Channel: event.Channel,
+		User:    event.User,
+		Text:    event.Text,
+		Ts:      ts,
+	}, "")
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+)
+
+func TestCommandPostedOnce(t *testing.T) {
+	env := setup(t, &config.Config{})
+	// A non-admin asking to reveal is answered without the LLM
+	queueMsg := &queue.Message{
+		ID:    "Ev001",
+		Type:  "slash_command",
+		Event: []byte(`{"command":"/adyen","text":"reveal 8815123456789012","user":"U1","channel":"C1"}`),
+	}
+
+	// A second delivery, e.g. after the answer failed, answers in the
+	// thread of the question already posted
+	for i := 0; i < 2; i++ {
+		if err := handleCommand(context.Background(), queueMsg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var questionTs string
+	var asked, answers int
+	for _, call := range env.slack.calls {
+		if call.Method != "chat.postMessage" {
+			continue
+		}
+		switch {
+		case strings.Contains(call.Args.Get("text"), "<@U1> asked:"):
+			asked++
+			questionTs = call.Ts
+		case call.Args.Get("thread_ts") != questionTs:
+			t.Errorf("answered in thread %q, want %s", call.Args.Get("thread_ts"), questionTs)
+		default:
+			answers++
+		}
+	}
+	if asked != 1 || answers != 2 {
+		t.Errorf("posted the question %d times and answered %d times, want 1 and 2", asked, answers)
+	}
+	posts := env.slack.called("chat.postMessage")
+
+	// Another command asks again
+	queueMsg.ID = "Ev002"
+	if err := handleCommand(context.Background(), queueMsg); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(env.slack.called("chat.postMessage")); got != len(posts)+2 {
+		t.Errorf("a new command made %d posts, want 2", got-len(posts))
+	}
+}
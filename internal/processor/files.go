@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/bulk"
+	slackapi "github.com/slack-go/slack"
+)
+
+// lookupTool looks up one payment by PSP reference
+const lookupTool = "get_payment"
+
+// maxCSVBytes bounds the size of an attached CSV
+const maxCSVBytes = 1 << 20
+
+// csvFile returns the first CSV attached to a message
+func csvFile(files []slackapi.File) *slackapi.File {
+	for i, f := range files {
+		if f.Filetype == "csv" || f.Mimetype == "text/csv" || strings.HasSuffix(strings.ToLower(f.Name), ".csv") {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+// errNotBulk means a CSV sent without a bulk command isn't a list of payments
+var errNotBulk = errors.New("no PSP reference column")
+
+// fileReferences downloads an attached CSV and reads the PSP references in
+// it. With a bulk command every cell counts; a CSV on its own needs a PSP
+// reference column, or it returns errNotBulk.
+func fileReferences(file slackapi.File, command bool) ([]string, error) {
+	data, err := slack.DownloadFile(file, maxCSVBytes)
+	if err != nil {
+		if !command {
+			fmt.Printf("Failed to read attached CSV %s, answering without it: %v\n", file.Name, err)
+			return nil, errNotBulk
+		}
+		return nil, err
+	}
+	if command {
+		return bulk.CSVReferences(data)
+	}
+	refs, ok, err := bulk.ColumnReferences(data)
+	if err != nil || !ok {
+		return nil, errNotBulk
+	}
+	return refs, nil
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/forms"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// OpenFormEvent is queued by the webhook after it opens a placeholder form
+type OpenFormEvent struct {
+	User   string `json:"user"`
+	Tool   string `json:"tool"`
+	ViewID string `json:"viewId"`
+}
+
+// SubmissionEvent is queued by the webhook once a form passes validation
+type SubmissionEvent struct {
+	User string `json:"user"`
+	forms.Submission
+}
+
+// handleOpenForm fills the placeholder modal with the tool's form
+func handleOpenForm(ctx context.Context, queueMsg *queue.Message) error {
+	var event OpenFormEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse open_form event: %w", err)
+	}
+
+	view := forms.Message(event.Tool, "This action isn't available right now.")
+	if tool, ok := findTool(event.Tool); ok {
+		if permChecker.CanUse(event.User, tool.Name) {
+			view = forms.Build(tool)
+		} else {
+			view = forms.Message(tool.Name, "Only admins can perform this action.")
+		}
+	}
+	if err := slack.UpdateView(event.ViewID, view); err != nil {
+		return fmt.Errorf("failed to update form: %w", err)
+	}
+	return nil
+}
+
+// findTool looks a tool up in the MCP catalog
+func findTool(name string) (llm.Tool, bool) {
+	for _, tool := range adyenClient.GetTools() {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return llm.Tool{}, false
+}
+
+// handleSubmission runs a submitted form without involving the model. The
+// call is announced in the chosen channel and handled in that thread like
+// any other request.
+func handleSubmission(ctx context.Context, queueMsg *queue.Message) (err error) {
+	var event SubmissionEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse form submission: %w", err)
+	}
+
+	tool, ok := findTool(event.Tool)
+	if !ok {
+		_, err := slack.SendDM(event.User, fmt.Sprintf("`%s` isn't available right now, so your form wasn't submitted.", event.Tool))
+		return err
+	}
+
+	ts, err := slack.PostToChannel(event.Channel, "", fmt.Sprintf("<@%s> submitted the *%s* form.", event.User, forms.Title(tool.Name)))
+	if err != nil {
+		slack.SendDM(event.User, fmt.Sprintf("I couldn't post in <#%s>, so your *%s* form wasn't run. Invite me to the channel and try again.", event.Channel, forms.Title(tool.Name)))
+		return fmt.Errorf("failed to announce form submission: %w", err)
+	}
+
+	msg := &slackClient.Message{Channel: event.Channel, User: event.User, Ts: ts}
+	status := trackStatus(msg, "")
+	defer func() { status.finish(err) }()
+
+	return executeTool(ctx, toolRequest{
+		Msg:    msg,
+		Tool:   tool.Name,
+		Args:   event.Args,
+		Status: status,
+	})
+}
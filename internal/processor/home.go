@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/forms"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackapi "github.com/slack-go/slack"
+)
+
+// homeActivityLimit is how many of the user's audited actions the App Home lists
+const homeActivityLimit = 10
+
+// quickAction is an App Home button opening a form for the first of its tools the MCP server offers
+type quickAction struct {
+	Label string
+	Tools []string
+}
+
+var quickActions = []quickAction{
+	{Label: "Look up payment", Tools: []string{"get_payment", "get_payment_details", "get_transaction"}},
+	{Label: "Create payment link", Tools: []string{"create_payment_link"}},
+	{Label: "Refund payment", Tools: []string{"refund_payment"}},
+}
+
+// HomeEvent is the app_home_opened event
+type HomeEvent struct {
+	User string `json:"user"`
+	Tab  string `json:"tab"`
+}
+
+// handleHomeOpened publishes the user's App Home tab
+func handleHomeOpened(ctx context.Context, queueMsg *queue.Message) error {
+	var event HomeEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse app_home_opened event: %w", err)
+	}
+	if err := slack.PublishHome(event.User, homeBlocks(ctx, event.User)...); err != nil {
+		return fmt.Errorf("failed to publish home: %w", err)
+	}
+	return nil
+}
+
+func homeBlocks(ctx context.Context, userID string) []slackapi.Block {
+	blocks := []slackapi.Block{
+		slackapi.NewHeaderBlock(plainText("Adyen Assistant")),
+		markdownSection(roleText(userID)),
+		slackapi.NewDividerBlock(),
+		markdownSection("*Quick actions*"),
+	}
+
+	var buttons []slackapi.BlockElement
+	for _, qa := range quickActions {
+		for _, name := range qa.Tools {
+			if _, ok := findTool(name); ok && permChecker.CanUse(userID, name) {
+				buttons = append(buttons, slackapi.NewButtonBlockElement(forms.OpenAction, name, plainText(qa.Label)))
+				break
+			}
+		}
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, slackapi.NewActionBlock("quick_actions", buttons...))
+	} else {
+		blocks = append(blocks, contextText("No quick actions are available to you."))
+	}
+	blocks = append(blocks, contextText("You can also mention me in a channel or send me a DM, e.g. _\"status of payment ABC123\"_."))
+
+	blocks = append(blocks, slackapi.NewDividerBlock(), markdownSection("*Your recent activity*"))
+	return append(blocks, activityBlocks(ctx, userID)...)
+}
+
+// roleText describes the user's effective permissions
+func roleText(userID string) string {
+	perms := cfg.Permissions
+	var lines []string
+	if permChecker.IsAdmin(userID) {
+		lines = append(lines, "*Role:* Admin: lookups and write actions (refunds, cancels, payment links)")
+	} else if perms.Approvals {
+		lines = append(lines, "*Role:* Read-only: lookups, and write actions once an admin approves them")
+	} else {
+		lines = append(lines, "*Role:* Read-only: lookups only, write actions need an admin")
+	}
+
+	if len(perms.Channels) > 0 {
+		channels := make([]string, len(perms.Channels))
+		for i, id := range perms.Channels {
+			channels[i] = fmt.Sprintf("<#%s>", id)
+		}
+		lines = append(lines, "*Channels:* "+strings.Join(channels, ", "))
+	} else {
+		lines = append(lines, "*Channels:* any channel the bot is in")
+	}
+	lines = append(lines, "*Environment:* "+cfg.Adyen.Environment)
+	return strings.Join(lines, "\n")
+}
+
+// activityBlocks lists the user's latest audited actions
+func activityBlocks(ctx context.Context, userID string) []slackapi.Block {
+	entries, err := auditLogger.Query(ctx, audit.Query{UserID: userID, Limit: homeActivityLimit})
+	if errors.Is(err, audit.ErrNotQueryable) {
+		return []slackapi.Block{contextText("Activity history isn't available: no durable audit store is configured.")}
+	}
+	if err != nil {
+		fmt.Printf("Failed to load activity for %s: %v\n", userID, err)
+		return []slackapi.Block{contextText("Activity history couldn't be loaded.")}
+	}
+	if len(entries) == 0 {
+		return []slackapi.Block{contextText("Nothing yet.")}
+	}
+
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		line := fmt.Sprintf("%s `%s` %s", activityEmoji(e.EventType), e.Action, e.EventType)
+		if e.PSPReference != "" {
+			line += " · " + e.PSPReference
+		}
+		if e.Amount != nil {
+			line += " · " + e.Amount.String()
+		}
+		lines[i] = fmt.Sprintf("%s · <!date^%d^{date_short_pretty} {time}|%s>", line, e.Timestamp.Unix(), e.Timestamp.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+	return []slackapi.Block{markdownSection(strings.Join(lines, "\n"))}
+}
+
+func activityEmoji(eventType audit.EventType) string {
+	switch eventType {
+	case audit.EventAllowed, audit.EventApproved:
+		return ":white_check_mark:"
+	case audit.EventDenied, audit.EventRejected:
+		return ":lock:"
+	case audit.EventError:
+		return ":x:"
+	case audit.EventRevealed:
+		return ":eyes:"
+	}
+	return ":hourglass_flowing_sand:"
+}
+
+func plainText(text string) *slackapi.TextBlockObject {
+	return slackapi.NewTextBlockObject(slackapi.PlainTextType, text, false, false)
+}
+
+func markdownSection(text string) slackapi.Block {
+	return slackapi.NewSectionBlock(slackapi.NewTextBlockObject(slackapi.MarkdownType, text, false, false), nil, nil)
+}
+
+func contextText(text string) slackapi.Block {
+	return slackapi.NewContextBlock("", slackapi.NewTextBlockObject(slackapi.MarkdownType, text, false, false))
+}
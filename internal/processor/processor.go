@@ -0,0 +1,456 @@
+// Package processor handles queued Slack events: it runs the model and the
+// Adyen tools, enforces permissions and approvals, and replies in Slack.
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+	"github.com/getalternative/adyen-slack-assistant/internal/idempotency"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	"github.com/getalternative/adyen-slack-assistant/internal/permissions"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
+	"github.com/getalternative/adyen-slack-assistant/internal/render"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+var (
+	cfg         *config.Config
+	slack       *slackClient.Client
+	llmClient   *llm.Client
+	adyenClient toolServer
+	permChecker *permissions.Checker
+	auditLogger *audit.Logger
+	redactor    *redact.Redactor
+	renderers   *render.Registry
+	idempotent  idempotency.Store
+	detector    *detect.Detector
+)
+
+// toolServer runs the Adyen tools; *adyen.Client in production
+type toolServer interface {
+	Start(ctx context.Context) error
+	Stop() error
+	GetTools() []llm.Tool
+	CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error)
+}
+
+// revealPrefix asks for unredacted tool output (admins only)
+const revealPrefix = "reveal "
+
+// MessageEvent represents a Slack message event
+type MessageEvent struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts"`
+	// Files attached to the message; a CSV of PSP references runs as a bulk job
+	Files []slackapi.File `json:"files"`
+
+	AckTs  string `json:"-"` // the message the answer replaces, see slackClient.Message
+	Edited bool   `json:"-"` // the question was edited and is being answered again
+}
+
+// Init creates the clients the processor uses
+func Init(c *config.Config) error {
+	cfg = c
+	slack = slackClient.New(cfg)
+	llmClient = llm.New(cfg)
+	permChecker = permissions.New(cfg)
+	redactor = redact.New(cfg)
+	renderers = render.New(cfg)
+	detector = detect.New(cfg)
+
+	var err error
+	auditLogger, err = audit.New(cfg, slack)
+	if err != nil {
+		return fmt.Errorf("failed to create audit logger: %w", err)
+	}
+
+	adyenClient, err = adyen.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create Adyen client: %w", err)
+	}
+
+	idempotent, err = idempotency.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency store: %w", err)
+	}
+	return nil
+}
+
+// Start launches the Adyen MCP server and delivers any audit entries spooled
+// by an earlier run. ctx bounds the MCP server's lifetime.
+func Start(ctx context.Context) error {
+	if err := adyenClient.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start Adyen MCP: %w", err)
+	}
+	if err := auditLogger.ReplaySpool(ctx); err != nil {
+		fmt.Printf("Failed to replay audit spool: %v\n", err)
+	}
+	return nil
+}
+
+// Stop shuts the Adyen MCP server down
+func Stop() {
+	adyenClient.Stop()
+}
+
+// HandleSQS is the Lambda handler for the SQS event source. Every message
+// that fails is reported back: retryable ones are delivered again, and after
+// the last attempt SQS moves them to the dead-letter queue and the requester
+// is told. Unreadable messages and terminal failures are reported too, but
+// not handled again, so they reach the dead-letter queue for inspection.
+func HandleSQS(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	var resp events.SQSEventResponse
+
+	// Start Adyen MCP server for this invocation; without it nothing can run
+	if err := Start(ctx); err != nil {
+		fmt.Printf("Failed to start: %v\n", err)
+		for _, record := range sqsEvent.Records {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			if queueMsg, err := decodeRecord(record); err == nil && queueMsg.ReceiveCount >= cfg.AWS.MaxReceiveCount {
+				notifyFailure(ctx, queueMsg)
+			}
+		}
+		return resp, nil
+	}
+	defer Stop()
+
+	resp.BatchItemFailures = handleRecords(ctx, sqsEvent.Records, Handle)
+	return resp, nil
+}
+
+// handleRecords runs each record through handle and returns the ones that
+// failed. On a FIFO queue a failure stops its message group: the group's
+// later records are returned unhandled, so they're delivered again in order.
+func handleRecords(ctx context.Context, records []events.SQSMessage, handle func(context.Context, *queue.Message) error) []events.SQSBatchItemFailure {
+	var failures []events.SQSBatchItemFailure
+	failedGroups := map[string]bool{}
+	for _, record := range records {
+		group := record.Attributes["MessageGroupId"]
+		if group != "" && failedGroups[group] {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			continue
+		}
+		if !handleRecord(ctx, record, handle) {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			if group != "" {
+				failedGroups[group] = true
+			}
+		}
+	}
+	return failures
+}
+
+// handleRecord runs one record through handle and reports whether it's done
+func handleRecord(ctx context.Context, record events.SQSMessage, handle func(context.Context, *queue.Message) error) bool {
+	queueMsg, err := decodeRecord(record)
+	if err != nil {
+		// Poison message: no retry can fix it, but the dead-letter queue keeps it
+		fmt.Printf("Unreadable queue message %s, leaving it for the dead-letter queue: %v\n", record.MessageId, err)
+		return false
+	}
+
+	// A terminal failure is delivered again until SQS gives up on it; it
+	// must not run again meanwhile
+	failedKey := "failed/" + record.MessageId
+	if _, failed, err := idempotent.Get(ctx, failedKey); err == nil && failed {
+		fmt.Printf("%s %s (trace %s) already failed, leaving it for the dead-letter queue\n", queueMsg.Type, queueMsg.ID, queueMsg.TraceID)
+		return false
+	}
+
+	err = handle(ctx, queueMsg)
+	if err == nil {
+		return true
+	}
+	if !queue.IsRetryable(err) {
+		fmt.Printf("Failed to handle %s %s (trace %s), not retrying: %v\n", queueMsg.Type, queueMsg.ID, queueMsg.TraceID, err)
+		if err := idempotent.Put(ctx, failedKey, queueMsg.ID, failedTTL); err != nil {
+			fmt.Printf("Failed to record terminal failure of %s: %v\n", queueMsg.ID, err)
+		}
+		return false
+	}
+
+	fmt.Printf("Failed to handle %s %s (trace %s), attempt %d of %d: %v\n",
+		queueMsg.Type, queueMsg.ID, queueMsg.TraceID, queueMsg.ReceiveCount, cfg.AWS.MaxReceiveCount, err)
+	if queueMsg.ReceiveCount >= cfg.AWS.MaxReceiveCount {
+		notifyFailure(ctx, queueMsg)
+	}
+	return false
+}
+
+// decodeRecord reads the envelope of an SQS record
+func decodeRecord(record events.SQSMessage) (*queue.Message, error) {
+	queueMsg, err := queue.Decode(record.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Messages from before the envelope was versioned have no ID
+	if queueMsg.ID == "" {
+		queueMsg.ID = record.MessageId
+	}
+	queueMsg.ReceiveCount, _ = strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+	return queueMsg, nil
+}
+
+// Handle processes one queue message. Its ID correlates the audit entries,
+// which are written before Handle returns so nothing is lost when Lambda
+// freezes the process.
+func Handle(ctx context.Context, queueMsg *queue.Message) (err error) {
+	// A panic is a bug: retry it, and leave it in the dead-letter queue for
+	// replay once fixed
+	defer func() {
+		if r := recover(); r != nil {
+			err = queue.Retryable(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	defer func() {
+		if err := auditLogger.Flush(ctx); err != nil {
+			fmt.Printf("Failed to flush audit log: %v\n", err)
+		}
+	}()
+	ctx = audit.WithRequestID(ctx, queueMsg.ID)
+
+	switch queueMsg.Type {
+	case "app_mention", "message":
+		return handleMessage(ctx, queueMsg)
+	case "app_home_opened":
+		return handleHomeOpened(ctx, queueMsg)
+	case "open_form":
+		return handleOpenForm(ctx, queueMsg)
+	case "view_submission":
+		return handleSubmission(ctx, queueMsg)
+	case "approval":
+		return handleApproval(ctx, queueMsg)
+	case "slash_command":
+		return handleCommand(ctx, queueMsg)
+	case "message_changed":
+		return handleEdit(ctx, queueMsg)
+	case "message_deleted":
+		return handleDelete(ctx, queueMsg)
+	case "link_shared":
+		return handleLinkShared(ctx, queueMsg)
+	}
+	return nil
+}
+
+func handleMessage(ctx context.Context, queueMsg *queue.Message) error {
+	var event MessageEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse message event: %w", err)
+	}
+	event.AckTs = queueMsg.AckTs
+	return answer(ctx, event, queueMsg.BotUserID)
+}
+
+// answer replies to a question in the thread of the message that asked it
+func answer(ctx context.Context, event MessageEvent, botUserID string) (err error) {
+	// Remove bot mention from text
+	text := strings.TrimSpace(event.Text)
+	if botUserID != "" {
+		text = strings.ReplaceAll(text, fmt.Sprintf("<@%s>", botUserID), "")
+		text = strings.TrimSpace(text)
+	}
+
+	// Create message object for replies
+	msg := &slackClient.Message{
+		Channel:  event.Channel,
+		User:     event.User,
+		Text:     text,
+		Ts:       event.Ts,
+		ThreadTs: event.ThreadTs,
+		AckTs:    event.AckTs,
+	}
+
+	// Progress is shown as a reaction on the user's message
+	status := trackStatus(msg, botUserID)
+	defer func() { status.finish(err) }()
+
+	// The answer is remembered so an edit of the question can replace it
+	defer recordAnswer(ctx, msg)
+
+	// A placeholder nothing replaced is deleted once the request is over;
+	// a retry replaces it instead
+	defer func() {
+		if !queue.IsRetryable(err) {
+			slack.DropAck(msg)
+		}
+	}()
+
+	// Tool output is redacted unless an admin explicitly asks to reveal it
+	reveal := false
+	if len(text) >= len(revealPrefix) && strings.EqualFold(text[:len(revealPrefix)], revealPrefix) {
+		if !permChecker.IsAdmin(event.User) {
+			reason := "Only admins can reveal redacted data."
+			auditLogger.LogDenied(ctx, event.User, "reveal", event.Channel, nil, reason)
+			status.set(statusDenied)
+			return reply(msg, replyDenial, reason)
+		}
+		reveal = true
+		text = strings.TrimSpace(text[len(revealPrefix):])
+	}
+
+	// Deterministic audit queries skip the LLM
+	if isAuditCommand(text) {
+		q, asCSV, err := parseAuditCommand(text, time.Now())
+		if err != nil {
+			return slack.Reply(msg, fmt.Sprintf("%s\nUsage: `audit user:@jane tool:refund type:denied channel:#payments since:7d until:today limit:50 csv`", err.Error()))
+		}
+		return runAuditQuery(ctx, msg, status, q, asCSV)
+	}
+
+	// Bulk jobs run one tool over many PSP references without the LLM; an
+	// attached CSV with a PSP reference column is a bulk lookup, any other
+	// CSV is left to the model
+	if file := csvFile(event.Files); isBulkCommand(text) || file != nil {
+		req, err := bulkRequest(text, file)
+		switch {
+		case errors.Is(err, errNotBulk) && text == "":
+			return slack.Reply(msg, "I didn't find a PSP reference column in that CSV, so I haven't looked anything up. Send it with `bulk` to use every PSP reference in it.")
+		case errors.Is(err, errNotBulk):
+		case err != nil:
+			status.set(statusFailed)
+			return reply(msg, replyError, fmt.Sprintf("I can't run that bulk job: %s.\n%s", err.Error(), bulkUsage))
+		default:
+			req.Msg, req.Reveal, req.Status, req.Edited = msg, reveal, status, event.Edited
+			return executeTool(ctx, req)
+		}
+	}
+
+	// Pasted references are looked up straight away. A paste on its own is
+	// answered by the cards; a question about it goes on to the model with
+	// the results. References in Adyen links are shown by the links'
+	// unfurls instead, unless an admin asked to reveal them.
+	pasted := text
+	if !reveal {
+		pasted = stripUnfurled(text)
+	}
+	if matches := detector.Find(pasted); len(matches) > 0 {
+		looked := lookupReferences(ctx, msg, status, reveal, matches)
+		if looked.Ran > 0 && !isQuestion(detect.Strip(pasted, matches)) {
+			if looked.failed() {
+				status.set(statusFailed)
+			}
+			return nil
+		}
+		text += looked.context()
+	} else if pasted != text && !isQuestion(pasted) {
+		// Nothing but Adyen links: the unfurls answer
+		return nil
+	}
+
+	// Get available tools from Adyen MCP, plus the audit query tool for admins
+	tools := adyenClient.GetTools()
+	if permChecker.IsAdmin(event.User) {
+		tools = append(tools[:len(tools):len(tools)], auditQueryToolDef())
+	}
+
+	// Process with LLM
+	llmStart := time.Now()
+	response, err := llmClient.ProcessMessage(ctx, text, tools, nil)
+	if err != nil {
+		// Transient failures are retried quietly; the requester hears about
+		// them only if every attempt fails
+		if queue.IsRetryable(err) {
+			return err
+		}
+		reply(msg, replyError, fmt.Sprintf("Sorry, I encountered an error: %s", err.Error()))
+		return err
+	}
+	logUsage(ctx, event, response.Usage, time.Since(llmStart))
+
+	// The model declined; don't run any tool calls it may have started
+	if response.Refused() {
+		text := "Sorry, I can't help with that request."
+		if response.Text != "" {
+			text = response.Text
+		}
+		return slack.Reply(msg, text)
+	}
+
+	// Only a finished tool_use turn runs tools. A turn cut off at max_tokens
+	// may hold a tool call with partial input, and one ended by a stop
+	// sequence was stopped on purpose; either way reply with the text.
+	if len(response.ToolCalls) == 0 || response.Truncated || response.StopReason != llm.StopToolUse {
+		if len(response.ToolCalls) > 0 {
+			fmt.Printf("Not running %d tool call(s) from a turn that stopped with %s\n", len(response.ToolCalls), response.StopReason)
+		}
+		return slack.Reply(msg, replyText(response))
+	}
+
+	// Process tool calls
+	for _, toolCall := range response.ToolCalls {
+		args := toolCall.Input
+
+		if toolCall.Name == auditQueryTool {
+			q, asCSV, err := queryFromInput(args, time.Now())
+			if err != nil {
+				return reply(msg, replyError, fmt.Sprintf("Error: %s", err.Error()))
+			}
+			return runAuditQuery(ctx, msg, status, q, asCSV)
+		}
+
+		return executeTool(ctx, toolRequest{
+			Msg:    msg,
+			Tool:   toolCall.Name,
+			Args:   args,
+			Reveal: reveal,
+			Status: status,
+			Edited: event.Edited,
+		})
+	}
+
+	return nil
+}
+
+// replyText renders the model's text, flagging answers that were cut short
+func replyText(response *llm.Response) string {
+	text := strings.TrimSpace(response.Text)
+	switch {
+	case response.Truncated && text == "":
+		return "Sorry, my answer was too long to complete. Please try a narrower question."
+	case response.Truncated:
+		return text + "\n\n_(answer truncated, ask me to continue or narrow the question)_"
+	case text == "":
+		return "I don't have anything to add."
+	}
+	return text
+}
+
+// logUsage prints token usage and records its cost in the audit trail for the digest
+func logUsage(ctx context.Context, event MessageEvent, u llm.Usage, duration time.Duration) {
+	stats := llmClient.Stats()
+	fmt.Printf("LLM usage: input=%d output=%d cache_read=%d cache_write=%d (cache hits %d/%d)\n",
+		u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens,
+		stats.CacheHits, stats.CacheHits+stats.CacheMisses)
+
+	auditLogger.LogUsage(ctx, event.User, event.Channel, audit.Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CostUSD:          u.Cost(cfg.LLM.Pricing),
+	}, duration)
+}
+
+// replyResult renders a tool result as Block Kit, attaching the full result
+// when it is too large to show inline
+func replyResult(msg *slackClient.Message, kind replyKind, toolName, result string) error {
+	out := renderers.Render(toolName, result)
+	return replyBlocks(msg, kind, out.Text, out.Blocks, out.File)
+}
@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+	"github.com/getalternative/adyen-slack-assistant/internal/idempotency"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	"github.com/getalternative/adyen-slack-assistant/internal/permissions"
+	"github.com/getalternative/adyen-slack-assistant/internal/redact"
+	"github.com/getalternative/adyen-slack-assistant/internal/render"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// slackCall is one Web API request made to fakeSlack
+type slackCall struct {
+	Method string
+	Args   url.Values // form values, or the JSON body under "body"
+	Ts     string     // the message ts answered, if any
+}
+
+// fakeSlack stands in for the Slack Web API. Methods answer ok with a fresh
+// message ts unless a response is set for them.
+type fakeSlack struct {
+	mu        sync.Mutex
+	calls     []slackCall
+	responses map[string]string
+	holds     map[string]chan struct{}
+	ts        int
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	args := url.Values{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, _ := io.ReadAll(r.Body)
+		args.Set("body", string(body))
+	} else {
+		r.ParseForm()
+		args = r.Form
+	}
+
+	f.mu.Lock()
+	call := slackCall{Method: method, Args: args}
+	response, ok := f.responses[method]
+	if !ok {
+		f.ts++
+		call.Ts = fmt.Sprintf("1700000000.%06d", f.ts)
+		response = fmt.Sprintf(`{"ok":true,"channel":%q,"ts":%q,"message_ts":%q}`, args.Get("channel"), call.Ts, call.Ts)
+	}
+	f.calls = append(f.calls, call)
+	hold := f.holds[method]
+	f.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, response)
+}
+
+// respond sets the JSON response for a Web API method
+func (f *fakeSlack) respond(method, response string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[method] = response
+}
+
+// hold keeps calls to a Web API method waiting until release is closed
+func (f *fakeSlack) hold(method string, release chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holds == nil {
+		f.holds = map[string]chan struct{}{}
+	}
+	f.holds[method] = release
+}
+
+// called returns the arguments of every call to a Web API method
+func (f *fakeSlack) called(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []url.Values
+	for _, call := range f.calls {
+		if call.Method == method {
+			out = append(out, call.Args)
+		}
+	}
+	return out
+}
+
+// methods lists the Web API methods called, in order
+func (f *fakeSlack) methods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		out[i] = call.Method
+	}
+	return out
+}
+
+// reset forgets the calls made so far
+func (f *fakeSlack) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// toolCall is one call made to fakeTools
+type toolCall struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// fakeTools stands in for the Adyen MCP server, answering every call with
+// its result for the tool
+type fakeTools struct {
+	mu      sync.Mutex
+	tools   []llm.Tool
+	results map[string]string
+	errs    map[string]error
+	delay   time.Duration // how long each call takes
+	calls   []toolCall
+}
+
+func (f *fakeTools) Start(ctx context.Context) error { return nil }
+func (f *fakeTools) Stop() error                     { return nil }
+func (f *fakeTools) GetTools() []llm.Tool            { return f.tools }
+
+func (f *fakeTools) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, toolCall{name, arguments})
+	if err := f.errs[name]; err != nil {
+		return "", err
+	}
+	return f.results[name], nil
+}
+
+// called returns the names of the tools called so far
+func (f *fakeTools) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, call := range f.calls {
+		names = append(names, call.Name)
+	}
+	return names
+}
+
+// failingSink rejects every entry
+type failingSink struct{}
+
+func (failingSink) Name() string { return "failing" }
+func (failingSink) Write(ctx context.Context, entry audit.Entry) error {
+	return errors.New("unavailable")
+}
+
+// testEnv is the processor wired to stand-ins
+type testEnv struct {
+	url   string // fakeSlack's address
+	slack *fakeSlack
+	tools *fakeTools
+	audit *audit.MemorySink
+}
+
+// setup points the processor's clients at stand-ins for one test
+func setup(t *testing.T, c *config.Config) *testEnv {
+	t.Helper()
+	env := &testEnv{
+		slack: &fakeSlack{responses: map[string]string{}},
+		tools: &fakeTools{results: map[string]string{}, errs: map[string]error{}},
+		audit: audit.NewMemorySink(),
+	}
+	server := httptest.NewServer(env.slack)
+	t.Cleanup(server.Close)
+	env.url = server.URL
+
+	cfg = c
+	slack = slackClient.NewWithAPI(slackapi.New("xoxb-test", slackapi.OptionAPIURL(server.URL+"/")))
+	adyenClient = env.tools
+	permChecker = permissions.New(cfg)
+	redactor = redact.New(cfg)
+	renderers = render.New(cfg)
+	detector = detect.New(cfg)
+	auditLogger = audit.NewWithSinks(cfg, &audit.MemoryHeadStore{}, env.audit)
+	idempotent = idempotency.NewMemory()
+	return env
+}
@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// paymentLinkTool looks up one payment link by ID
+const paymentLinkTool = "get_payment_link"
+
+// maxLookupContext bounds each lookup result passed on to the model
+const maxLookupContext = 2000
+
+// lookup is one reference looked up before the model runs
+type lookup struct {
+	Match  detect.Match
+	Tool   string
+	Output string // redacted; empty when the lookup failed
+}
+
+// lookups are the references in a message and what was found for them
+type lookups struct {
+	Ran     int      // lookups that ran, successfully or not
+	Results []lookup // successful lookups
+	Skipped []detect.Match
+}
+
+// lookupReferences looks up the references in a message, at most
+// cfg.References.MaxLookups of them, replying with a card for each. They run
+// through executeTool like any other call, but only when the requester may
+// run the tool outright: a paste never raises an approval prompt. One failed
+// lookup doesn't fail the request, so the caller settles the status.
+func lookupReferences(ctx context.Context, msg *slackClient.Message, status *statusTracker, reveal bool, matches []detect.Match) lookups {
+	var out lookups
+	limited := false
+	for _, m := range matches {
+		// Values that look like card numbers are never sent to Adyen
+		if redactor.Text(m.Value) != m.Value {
+			continue
+		}
+		tool, args := referenceLookup(m)
+		if tool != "" && out.Ran >= cfg.References.MaxLookups {
+			limited = true
+		}
+		if tool == "" || out.Ran >= cfg.References.MaxLookups || !hasTool(tool) {
+			out.Skipped = append(out.Skipped, m)
+			continue
+		}
+		if perm := permChecker.Check(msg.User, msg.Channel, tool); !perm.Allowed || perm.NeedsApproval {
+			out.Skipped = append(out.Skipped, m)
+			continue
+		}
+
+		out.Ran++
+		status.set(statusWorking)
+		var output string
+		err := executeTool(ctx, toolRequest{
+			Msg:    msg,
+			Tool:   tool,
+			Args:   args,
+			Reveal: reveal,
+			Output: &output,
+		})
+		if err != nil {
+			fmt.Printf("Failed to reply with lookup of %s: %v\n", m.Value, err)
+		}
+		if output != "" {
+			out.Results = append(out.Results, lookup{Match: m, Tool: tool, Output: output})
+		}
+	}
+
+	if limited {
+		if err := slack.Reply(msg, fmt.Sprintf("I looked up the first %d references. Use `bulk status` to look up many payments at once.", out.Ran)); err != nil {
+			fmt.Printf("Failed to post lookup hint: %v\n", err)
+		}
+	}
+	return out
+}
+
+// referenceLookup is the tool and arguments that look up a reference
+func referenceLookup(m detect.Match) (string, map[string]interface{}) {
+	switch m.Kind {
+	case detect.PSPReference:
+		return lookupTool, map[string]interface{}{"pspReference": m.Value}
+	case detect.PaymentLink:
+		return paymentLinkTool, map[string]interface{}{"linkId": m.Value}
+	case detect.MerchantReference:
+		if cfg.References.MerchantTool != "" {
+			return cfg.References.MerchantTool, map[string]interface{}{"merchantReference": m.Value}
+		}
+	}
+	return "", nil
+}
+
+// failed returns true if lookups ran and none of them succeeded
+func (l lookups) failed() bool {
+	return l.Ran > 0 && len(l.Results) == 0
+}
+
+// context describes the lookups for the model, so it answers from them
+// instead of calling the same tools again
+func (l lookups) context() string {
+	if len(l.Results) == 0 && len(l.Skipped) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n[Recognized references]")
+	for _, r := range l.Results {
+		output := r.Output
+		if len(output) > maxLookupContext {
+			output = output[:maxLookupContext] + "…"
+		}
+		fmt.Fprintf(&b, "\n%s %s, already looked up with %s and shown to the user (redacted):\n%s", r.Match.Kind, r.Match.Value, r.Tool, output)
+	}
+	for _, m := range l.Skipped {
+		fmt.Fprintf(&b, "\n%s %s, not looked up", m.Kind, m.Value)
+	}
+	return b.String()
+}
+
+// linkPattern matches URLs, bare or in Slack's <url|label> markup
+var linkPattern = regexp.MustCompile(`<https?://[^>]*>|https?://\S+`)
+
+// stripUnfurled removes the Adyen links that Slack unfurls from text, so
+// the references in them aren't looked up a second time
+func stripUnfurled(text string) string {
+	return linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		url, _, _ := strings.Cut(strings.Trim(link, "<>"), "|")
+		if _, ok := detect.Link(url); ok {
+			return ""
+		}
+		return link
+	})
+}
+
+// isQuestion returns true if what is left of a message once its references
+// are removed asks something: any word, as in "refund 8815…" or "cancel
+// <psp>", goes to the model. Only a bare paste, with links, punctuation and
+// numbers around the references, is answered by the cards alone.
+func isQuestion(text string) bool {
+	text = linkPattern.ReplaceAllString(text, "")
+	return strings.Contains(text, "?") || strings.ContainsFunc(text, unicode.IsLetter)
+}
@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+)
+
+func TestIsQuestion(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"8815123456789012", false},
+		{"8815123456789012, 8815123456789013", false},
+		{"1. 8815123456789012\n2. 8815123456789013", false},
+		{"8815123456789012 - 8815123456789013", false},
+		{"<https://ca-test.adyen.com/ca/ca/accounts/showTx.shtml?pspReference=8815123456789012&txType=Payment>", false},
+		{"<https://pay.adyen.com/PL61C53A8B97E6915A|pay here> PL61C53A8B97E6915A", false},
+		{"8815123456789012?", true},
+		{"refund 8815123456789012", true},
+		{"cancel 8815123456789012", true},
+		{"8815123456789012 refund", true},
+		{"what happened to 8815123456789012", true},
+		{"why was <https://ca-test.adyen.com/ca/ca/payments/8815123456789012|this> declined", true},
+		{"status PL61C53A8B97E6915A", true},
+	}
+	d := detect.New(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := isQuestion(detect.Strip(tt.text, d.Find(tt.text))); got != tt.want {
+				t.Errorf("isQuestion(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"slices"
+
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// replyKind classifies a reply for the visibility policy in SLACK_EPHEMERAL_REPLIES
+type replyKind string
+
+const (
+	replyAnswer   replyKind = "answer"   // model answers and tool results
+	replyDenial   replyKind = "denial"   // permission denials
+	replyError    replyKind = "error"    // failures
+	replyReveal   replyKind = "reveal"   // unredacted output for admins
+	replyApproval replyKind = "approval" // approval prompts and outcomes for the requester
+)
+
+// private returns true if this kind of reply is shown to the requester only
+func (k replyKind) private() bool {
+	return slices.Contains(cfg.Slack.EphemeralReplies, string(k))
+}
+
+// reply sends text in the thread, or privately when the policy says so
+func reply(msg *slackClient.Message, kind replyKind, text string) error {
+	if kind.private() {
+		return slack.ReplyPrivately(msg, text, nil, nil)
+	}
+	return slack.Reply(msg, text)
+}
+
+// replyBlocks sends blocks, with an optional file, in the thread or privately
+func replyBlocks(msg *slackClient.Message, kind replyKind, text string, blocks []slackapi.Block, file *slackClient.File) error {
+	if kind.private() {
+		return slack.ReplyPrivately(msg, text, blocks, file)
+	}
+	return slack.ReplyWithFile(msg, text, blocks, file)
+}
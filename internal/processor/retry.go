@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// writeTTL keeps write claims past the dead-letter queue's 14-day retention,
+// so a replayed message can't repeat a write either
+const writeTTL = 15 * 24 * time.Hour
+
+// failedTTL keeps a terminal failure marked while SQS delivers the message
+// again on its way to the dead-letter queue
+const failedTTL = 24 * time.Hour
+
+// failureTarget is where the fields naming the requester live in queued events
+type failureTarget struct {
+	Channel  string `json:"channel"`
+	User     string `json:"user"`
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts"`
+}
+
+// notifyFailure tells the requester that their message failed on every
+// attempt and was moved to the dead-letter queue
+func notifyFailure(ctx context.Context, queueMsg *queue.Message) {
+	// Nobody is waiting on a Home tab refresh or a form that never loaded
+	if queueMsg.Type == "app_home_opened" || queueMsg.Type == "open_form" {
+		return
+	}
+
+	var target failureTarget
+	json.Unmarshal(queueMsg.Event, &target)
+	text := fmt.Sprintf("Sorry, this failed and I've stopped retrying. Please try again later, and mention reference `%s` if it keeps happening.", queueMsg.ID)
+
+	var err error
+	switch {
+	case target.Channel != "" && target.Ts != "":
+		msg := &slackClient.Message{Channel: target.Channel, User: target.User, Ts: target.Ts, ThreadTs: target.ThreadTs, AckTs: queueMsg.AckTs}
+		err = reply(msg, replyError, text)
+	case target.User != "":
+		_, err = slack.SendDM(target.User, text)
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Printf("Failed to send failure notice for %s: %v\n", queueMsg.ID, err)
+	}
+}
+
+// claimWrite records that this request is about to run a write tool, on
+// item for bulk jobs. It returns false if an earlier delivery of the same
+// request already got this far: the write may have gone through, so it must
+// not run again.
+func claimWrite(ctx context.Context, tool, item string) (bool, error) {
+	key := fmt.Sprintf("write/%s/%s", audit.RequestIDFrom(ctx), tool)
+	if item != "" {
+		key += "/" + item
+	}
+	return idempotent.Claim(ctx, key, writeTTL)
+}
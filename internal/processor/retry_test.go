@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+)
+
+func TestClaimWrite(t *testing.T) {
+	setup(t, &config.Config{})
+	ctx := audit.WithRequestID(context.Background(), "req-1")
+
+	claims := []struct {
+		ctx  context.Context
+		tool string
+		item string
+		want bool
+	}{
+		{ctx, "refund_payment", "", true},
+		// A later delivery of the same request
+		{ctx, "refund_payment", "", false},
+		{ctx, "cancel_payment", "", true},
+		// Each item of a bulk job is claimed on its own
+		{ctx, "refund_payment", "8815123456789012", true},
+		{ctx, "refund_payment", "8815123456789013", true},
+		{ctx, "refund_payment", "8815123456789012", false},
+		{audit.WithRequestID(context.Background(), "req-2"), "refund_payment", "", true},
+	}
+	for i, c := range claims {
+		got, err := claimWrite(c.ctx, c.tool, c.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("claim %d (%s %s) = %v, want %v", i, c.tool, c.item, got, c.want)
+		}
+	}
+}
+
+// record is an SQS record carrying a message with the given ID
+func record(id, group string, receiveCount int) events.SQSMessage {
+	attributes := map[string]string{"ApproximateReceiveCount": strconv.Itoa(receiveCount)}
+	if group != "" {
+		attributes["MessageGroupId"] = group
+	}
+	return events.SQSMessage{
+		MessageId:  "sqs-" + id,
+		Body:       `{"version":1,"id":"` + id + `","type":"app_mention","event":{"channel":"C1","user":"U1","ts":"1.1"}}`,
+		Attributes: attributes,
+	}
+}
+
+// failedIDs lists the records reported as failed
+func failedIDs(failures []events.SQSBatchItemFailure) []string {
+	var out []string
+	for _, f := range failures {
+		out = append(out, f.ItemIdentifier)
+	}
+	return out
+}
+
+func TestHandleRecords(t *testing.T) {
+	outcomes := map[string]error{
+		"retry":    queue.Retryable(errors.New("rate limited")),
+		"terminal": errors.New("invalid reference"),
+		"a1":       queue.Retryable(errors.New("timeout")),
+	}
+	tests := []struct {
+		name        string
+		records     []events.SQSMessage
+		wantHandled []string
+		wantFailed  []string
+	}{
+		{
+			name:        "standard queue",
+			records:     []events.SQSMessage{record("ok", "", 1), record("retry", "", 1), record("terminal", "", 1), {MessageId: "sqs-garbage", Body: "garbage"}, record("ok2", "", 1)},
+			wantHandled: []string{"ok", "retry", "terminal", "ok2"},
+			wantFailed:  []string{"sqs-retry", "sqs-terminal", "sqs-garbage"},
+		},
+		{
+			// A failure holds back the rest of its group, but not other groups
+			name:        "FIFO groups",
+			records:     []events.SQSMessage{record("a0", "A", 1), record("b0", "B", 1), record("a1", "A", 1), record("b1", "B", 1), record("a2", "A", 1), record("a3", "A", 1)},
+			wantHandled: []string{"a0", "b0", "a1", "b1"},
+			wantFailed:  []string{"sqs-a1", "sqs-a2", "sqs-a3"},
+		},
+		{
+			// An unreadable message stops its group too
+			name:        "FIFO unreadable",
+			records:     []events.SQSMessage{{MessageId: "sqs-garbage", Body: "garbage", Attributes: map[string]string{"MessageGroupId": "A"}}, record("a1", "A", 1)},
+			wantHandled: nil,
+			wantFailed:  []string{"sqs-garbage", "sqs-a1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, &config.Config{AWS: config.AWSConfig{MaxReceiveCount: 3}})
+			var handled []string
+			handle := func(ctx context.Context, queueMsg *queue.Message) error {
+				handled = append(handled, queueMsg.ID)
+				return outcomes[queueMsg.ID]
+			}
+			failures := handleRecords(context.Background(), tt.records, handle)
+			if !reflect.DeepEqual(handled, tt.wantHandled) {
+				t.Errorf("handled %v, want %v", handled, tt.wantHandled)
+			}
+			if got := failedIDs(failures); !reflect.DeepEqual(got, tt.wantFailed) {
+				t.Errorf("failed %v, want %v", got, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestHandleRecordsRedelivery(t *testing.T) {
+	env := setup(t, &config.Config{AWS: config.AWSConfig{MaxReceiveCount: 3}})
+	handled := 0
+	var outcome error
+	handle := func(ctx context.Context, queueMsg *queue.Message) error {
+		handled++
+		return outcome
+	}
+
+	// A terminal failure is reported, so it reaches the dead-letter queue,
+	// but its redeliveries don't run it again or tell the requester
+	outcome = errors.New("invalid reference")
+	for attempt := 1; attempt <= 3; attempt++ {
+		if got := failedIDs(handleRecords(context.Background(), []events.SQSMessage{record("terminal", "", attempt)}, handle)); len(got) != 1 {
+			t.Fatalf("attempt %d failed %v, want the message", attempt, got)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("terminal failure handled %d times, want 1", handled)
+	}
+	if got := env.slack.methods(); len(got) != 0 {
+		t.Errorf("terminal failure called %v", got)
+	}
+
+	// A retryable failure runs on every delivery, and the last one tells
+	// the requester
+	handled = 0
+	outcome = queue.Retryable(errors.New("rate limited"))
+	for attempt := 1; attempt <= 3; attempt++ {
+		handleRecords(context.Background(), []events.SQSMessage{record("retry", "", attempt)}, handle)
+		want := 0
+		if attempt == 3 {
+			want = 1
+		}
+		if notices := env.slack.called("chat.postMessage"); len(notices) != want {
+			t.Fatalf("attempt %d sent %d notices, want %d", attempt, len(notices), want)
+		}
+	}
+	if handled != 3 {
+		t.Errorf("retryable failure handled %d times, want 3", handled)
+	}
+	if text := env.slack.called("chat.postMessage")[0].Get("text"); !strings.Contains(text, "stopped retrying") || !strings.Contains(text, "`retry`") {
+		t.Errorf("notice = %q", text)
+	}
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// status is the progress of a request, shown as a reaction on the user's message
+type status int
+
+const (
+	statusNone     status = iota
+	statusReceived        // picked up from the queue
+	statusWorking         // tools are running
+	statusDone            // answered
+	statusFailed          // something went wrong
+	statusDenied          // blocked by a permission check
+	statusAwaiting        // waiting for an admin's approval
+)
+
+var statusReactions = map[status]string{
+	statusReceived: slackClient.AckReaction,
+	statusWorking:  "hourglass_flowing_sand",
+	statusDone:     "white_check_mark",
+	statusFailed:   "x",
+	statusDenied:   "lock",
+	statusAwaiting: "raised_hand",
+}
+
+// terminal statuses end the lifecycle; later transitions are ignored
+func (s status) terminal() bool {
+	return s == statusDone || s == statusFailed || s == statusDenied
+}
+
+// statusTracker keeps exactly one status reaction on a message. Failures to
+// react are logged and never fail the request.
+type statusTracker struct {
+	channel   string
+	ts        string
+	botUserID string
+	current   status
+}
+
+// trackStatus starts the lifecycle on msg, clearing reactions left by an
+// earlier attempt at the same message (e.g. an SQS retry). A received
+// reaction is kept, since the webhook may have added it as an acknowledgement.
+func trackStatus(msg *slackClient.Message, botUserID string) *statusTracker {
+	t := &statusTracker{channel: msg.Channel, ts: msg.Ts, botUserID: botUserID}
+	t.clearStale()
+	t.set(statusReceived)
+	return t
+}
+
+// resumeStatus picks up the lifecycle of a request that was waiting for approval
+func resumeStatus(msg *slackClient.Message) *statusTracker {
+	return &statusTracker{channel: msg.Channel, ts: msg.Ts, current: statusAwaiting}
+}
+
+// set moves to next, replacing the previous reaction
+func (t *statusTracker) set(next status) {
+	if t == nil || next == t.current || t.current.terminal() {
+		return
+	}
+
+	if reaction := statusReactions[next]; reaction != "" {
+		if err := slack.AddReaction(t.channel, t.ts, reaction); err != nil && !isSlackError(err, "already_reacted") {
+			fmt.Printf("Failed to add %s reaction: %v\n", reaction, err)
+		}
+	}
+	if reaction := statusReactions[t.current]; reaction != "" {
+		if err := slack.RemoveReaction(t.channel, t.ts, reaction); err != nil && !isSlackError(err, "no_reaction") {
+			fmt.Printf("Failed to remove %s reaction: %v\n", reaction, err)
+		}
+	}
+	t.current = next
+}
+
+// finish ends the lifecycle if nothing else did: failed on error, done
+// otherwise. A request awaiting approval is left for the approval to finish.
+func (t *statusTracker) finish(err error) {
+	if t == nil || t.current == statusAwaiting {
+		return
+	}
+	if err != nil {
+		t.set(statusFailed)
+		return
+	}
+	t.set(statusDone)
+}
+
+// clearStale removes any status reaction the bot left on the message before
+func (t *statusTracker) clearStale() {
+	if t.botUserID == "" {
+		return
+	}
+	reactions, err := slack.GetReactions(t.channel, t.ts)
+	if err != nil {
+		fmt.Printf("Failed to read reactions: %v\n", err)
+		return
+	}
+
+	ours := map[string]bool{}
+	for _, reaction := range statusReactions {
+		ours[reaction] = true
+	}
+	for _, reaction := range reactions {
+		if !ours[reaction.Name] || !slices.Contains(reaction.Users, t.botUserID) {
+			continue
+		}
+		if reaction.Name == statusReactions[statusReceived] {
+			t.current = statusReceived
+			continue
+		}
+		if err := slack.RemoveReaction(t.channel, t.ts, reaction.Name); err != nil && !isSlackError(err, "no_reaction") {
+			fmt.Printf("Failed to remove stale %s reaction: %v\n", reaction.Name, err)
+		}
+	}
+}
+
+// isSlackError matches Slack API error codes, which slack-go returns as plain errors
+func isSlackError(err error, code string) bool {
+	return strings.Contains(err.Error(), code)
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// reactionCalls lists the reactions added and removed, e.g. "+eyes" and "-eyes"
+func reactionCalls(f *fakeSlack) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, call := range f.calls {
+		switch call.Method {
+		case "reactions.add":
+			out = append(out, "+"+call.Args.Get("name"))
+		case "reactions.remove":
+			out = append(out, "-"+call.Args.Get("name"))
+		}
+	}
+	return out
+}
+
+func TestStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		start status
+		steps func(t *statusTracker)
+		want  []string
+	}{
+		{
+			name:  "answered",
+			start: statusReceived,
+			steps: func(t *statusTracker) {
+				t.set(statusWorking)
+				t.finish(nil)
+			},
+			want: []string{"+hourglass_flowing_sand", "-eyes", "+white_check_mark", "-hourglass_flowing_sand"},
+		},
+		{
+			name:  "failed",
+			start: statusWorking,
+			steps: func(t *statusTracker) { t.finish(errors.New("timeout")) },
+			want:  []string{"+x", "-hourglass_flowing_sand"},
+		},
+		{
+			name:  "same status twice",
+			start: statusReceived,
+			steps: func(t *statusTracker) {
+				t.set(statusWorking)
+				t.set(statusWorking)
+			},
+			want: []string{"+hourglass_flowing_sand", "-eyes"},
+		},
+		{
+			// Terminal statuses stick: a denial isn't turned into done by finish
+			name:  "terminal",
+			start: statusReceived,
+			steps: func(t *statusTracker) {
+				t.set(statusDenied)
+				t.set(statusWorking)
+				t.finish(nil)
+				t.finish(errors.New("late failure"))
+			},
+			want: []string{"+lock", "-eyes"},
+		},
+		{
+			// The approval finishes the request, not the message that asked
+			name:  "awaiting approval",
+			start: statusReceived,
+			steps: func(t *statusTracker) {
+				t.set(statusAwaiting)
+				t.finish(nil)
+				t.finish(errors.New("failed"))
+			},
+			want: []string{"+raised_hand", "-eyes"},
+		},
+		{
+			name:  "resumed after approval",
+			start: statusAwaiting,
+			steps: func(t *statusTracker) {
+				t.set(statusWorking)
+				t.finish(nil)
+			},
+			want: []string{"+hourglass_flowing_sand", "-raised_hand", "+white_check_mark", "-hourglass_flowing_sand"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setup(t, &config.Config{})
+			tracker := &statusTracker{channel: "C1", ts: "1.1", current: tt.start}
+			tt.steps(tracker)
+			if got := reactionCalls(env.slack); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reactions %v, want %v", got, tt.want)
+			}
+			for _, args := range append(env.slack.called("reactions.add"), env.slack.called("reactions.remove")...) {
+				if args.Get("channel") != "C1" || args.Get("timestamp") != "1.1" {
+					t.Errorf("reacted on %s %s, want C1 1.1", args.Get("channel"), args.Get("timestamp"))
+				}
+			}
+		})
+	}
+}
+
+func TestStatusNil(t *testing.T) {
+	env := setup(t, &config.Config{})
+	var tracker *statusTracker
+	tracker.set(statusWorking)
+	tracker.finish(errors.New("failed"))
+	if got := env.slack.methods(); len(got) != 0 {
+		t.Errorf("a nil tracker called %v", got)
+	}
+}
+
+func TestTrackStatus(t *testing.T) {
+	env := setup(t, &config.Config{})
+	// An earlier attempt left a failure; the webhook acknowledged the message
+	env.slack.respond("reactions.get", `{"ok":true,"type":"message","message":{"reactions":[
+		{"name":"eyes","count":1,"users":["UBOT"]},
+		{"name":"x","count":1,"users":["UBOT"]},
+		{"name":"hourglass_flowing_sand","count":1,"users":["U1"]},
+		{"name":"tada","count":1,"users":["UBOT"]}
+	]}}`)
+
+	tracker := trackStatus(&slackClient.Message{Channel: "C1", Ts: "1.1"}, "UBOT")
+	if tracker.current != statusReceived {
+		t.Errorf("status %d, want received", tracker.current)
+	}
+	// Only the bot's stale status goes; the acknowledgement is kept, and
+	// reactions from people or outside the lifecycle are left alone
+	if got, want := reactionCalls(env.slack), []string{"-x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reactions %v, want %v", got, want)
+	}
+
+	// Without the bot's user ID nothing is cleared
+	env.slack.reset()
+	trackStatus(&slackClient.Message{Channel: "C1", Ts: "1.2"}, "")
+	if got, want := env.slack.methods(), []string{"reactions.add"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("called %v, want %v", got, want)
+	}
+}
+
+func TestStatusSlackErrors(t *testing.T) {
+	env := setup(t, &config.Config{})
+	env.slack.respond("reactions.add", `{"ok":false,"error":"already_reacted"}`)
+	env.slack.respond("reactions.remove", `{"ok":false,"error":"no_reaction"}`)
+
+	// Failed reactions never fail the request, and the status still moves on
+	tracker := &statusTracker{channel: "C1", ts: "1.1", current: statusReceived}
+	tracker.set(statusWorking)
+	tracker.finish(nil)
+	if tracker.current != statusDone {
+		t.Errorf("status %d, want done", tracker.current)
+	}
+}
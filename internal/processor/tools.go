@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/permissions"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+// toolRequest is a tool call from the model, a form submission or an approval.
+// Every source runs through executeTool, so they share permission checks,
+// approvals and auditing.
+type toolRequest struct {
+	Msg    *slackClient.Message // where to reply; Msg.User is the requester
+	Tool   string
+	Args   map[string]interface{}
+	Reveal bool
+	Status *statusTracker
+
+	// ApprovedBy is the admin who approved the call on the requester's behalf
+	ApprovedBy string
+	// Items makes the call a bulk job: Tool runs once for each PSP reference
+	Items []string
+	// Edited marks a question answered again after an edit
+	Edited bool
+	// Output, when set, receives the redacted result of a successful call
+	Output *string
+}
+
+// executeTool checks permissions, asks for approval when needed, runs the
+// tool and replies with the result
+func executeTool(ctx context.Context, req toolRequest) error {
+	msg := req.Msg
+	user, channel := msg.User, msg.Channel
+
+	// An edit asks the same question again; it must not repeat a write
+	if req.Edited && permissions.IsWriteAction(req.Tool) {
+		auditLogger.LogDenied(ctx, user, req.Tool, channel, req.auditArgs(), "Write actions are not run for edited questions")
+		req.Status.set(statusDenied)
+		return reply(msg, replyDenial, fmt.Sprintf("I don't run write actions like `%s` when a question is edited. Please send it as a new message.", req.Tool))
+	}
+
+	// Approved calls run with the approver's permissions
+	permResult := permChecker.Check(user, channel, req.Tool)
+	if req.ApprovedBy != "" {
+		permResult = permChecker.Check(req.ApprovedBy, channel, req.Tool)
+	}
+	if permResult.NeedsApproval {
+		return requestApproval(ctx, req)
+	}
+	if !permResult.Allowed {
+		auditLogger.LogDenied(ctx, user, req.Tool, channel, req.auditArgs(), permResult.Reason)
+		req.Status.set(statusDenied)
+		return reply(msg, replyDenial, permResult.Reason)
+	}
+
+	if len(req.Items) > 0 {
+		// A bulk write always waits for one click on its count and total,
+		// an admin's included
+		if permissions.IsWriteAction(req.Tool) && req.ApprovedBy == "" {
+			return requestApproval(ctx, req)
+		}
+		return runBulk(ctx, req)
+	}
+
+	// Writes run at most once per request, however often it is delivered
+	write := permissions.IsWriteAction(req.Tool)
+	if write {
+		claimed, err := claimWrite(ctx, req.Tool, "")
+		if err != nil {
+			// Nothing has run yet, so trying again later is safe
+			return queue.Retryable(fmt.Errorf("failed to claim write: %w", err))
+		}
+		if !claimed {
+			reason := "Not run again: an earlier attempt at this request may already have run it"
+			auditLogger.LogError(ctx, user, req.Tool, channel, req.Args, reason, 0)
+			req.Status.set(statusFailed)
+			return reply(msg, replyError, fmt.Sprintf("An earlier attempt at this request may already have run `%s`, so I didn't run it again. Please check in the Customer Area before retrying.", req.Tool))
+		}
+	}
+
+	// Record write attempts before they run; when failing closed, no record means no write
+	if write {
+		if err := auditLogger.LogAttempted(ctx, user, req.Tool, channel, req.Args); errors.Is(err, audit.ErrNotPersisted) && cfg.Audit.FailClosed {
+			req.Status.set(statusFailed)
+			return reply(msg, replyError, "Write actions are paused because the audit log can't be written right now. Please try again later.")
+		}
+	}
+
+	// Execute the tool
+	req.Status.set(statusWorking)
+	start := time.Now()
+	result, err := adyenClient.CallTool(ctx, req.Tool, req.Args)
+	duration := time.Since(start)
+	if err != nil {
+		auditLogger.LogError(ctx, user, req.Tool, channel, req.Args, err.Error(), duration)
+		req.Status.set(statusFailed)
+		err = reply(msg, replyError, fmt.Sprintf("Error: %s", redactor.Text(err.Error())))
+		if write {
+			return queue.Terminal(err)
+		}
+		return err
+	}
+
+	// Log and reply. Once a write has run, a failed reply must not send the
+	// request round again.
+	auditLogger.LogAllowed(ctx, user, req.Tool, channel, req.Args, result, duration)
+	if req.Output != nil {
+		*req.Output = redactor.Result(result)
+	}
+	if req.Reveal {
+		auditLogger.LogRevealed(ctx, user, req.Tool, channel, req.Args, "Unredacted result shown in thread")
+		err = replyResult(msg, replyReveal, req.Tool, result)
+	} else {
+		err = replyResult(msg, replyAnswer, req.Tool, redactor.Result(result))
+	}
+	if write {
+		return queue.Terminal(err)
+	}
+	return err
+}
+
+// auditArgs are the arguments recorded for the request as a whole
+func (req toolRequest) auditArgs() map[string]interface{} {
+	return bulkArgs(req.Args, req.Items)
+}
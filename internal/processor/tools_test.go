@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+)
+
+func TestExecuteToolAuditFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		tool       string
+		wantCalls  []string
+		wantReply  string
+	}{
+		{
+			name:       "fail closed blocks writes",
+			failClosed: true,
+			tool:       "refund_payment",
+			wantReply:  "Write actions are paused",
+		},
+		{
+			name:       "fail closed lets reads through",
+			failClosed: true,
+			tool:       "get_payment",
+			wantCalls:  []string{"get_payment"},
+		},
+		{
+			name:      "fail open",
+			tool:      "refund_payment",
+			wantCalls: []string{"refund_payment"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setup(t, &config.Config{
+				Permissions: config.PermissionsConfig{Admins: []string{"UADMIN"}},
+				Audit:       config.AuditConfig{FailClosed: tt.failClosed},
+			})
+			auditLogger = audit.NewWithSinks(cfg, &audit.MemoryHeadStore{}, failingSink{})
+
+			ctx := audit.WithRequestID(context.Background(), "req-1")
+			msg := &slackClient.Message{Channel: "C1", User: "UADMIN", Ts: "1.1"}
+			err := executeTool(ctx, toolRequest{Msg: msg, Tool: tt.tool, Args: map[string]interface{}{"pspReference": "8815123456789012"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := env.tools.called(); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("called %v, want %v", got, tt.wantCalls)
+			}
+			posts := env.slack.called("chat.postMessage")
+			if tt.wantReply != "" && (len(posts) != 1 || !strings.Contains(posts[0].Get("text"), tt.wantReply)) {
+				t.Errorf("replied %v, want %q", posts, tt.wantReply)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/detect"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackapi "github.com/slack-go/slack"
+)
+
+// LinkSharedEvent is a link_shared event for Adyen links in a message
+type LinkSharedEvent struct {
+	Channel   string `json:"channel"`
+	User      string `json:"user"`
+	MessageTs string `json:"message_ts"`
+	Links     []struct {
+		Domain string `json:"domain"`
+		URL    string `json:"url"`
+	} `json:"links"`
+}
+
+// handleLinkShared unfurls Customer Area payment and payment link URLs with
+// their live details. Each lookup is checked against the poster's read
+// permissions and audited; links the poster may not look up, or that fail,
+// are left as they are. Previews are always redacted.
+func handleLinkShared(ctx context.Context, queueMsg *queue.Message) error {
+	var event LinkSharedEvent
+	if err := json.Unmarshal(queueMsg.Event, &event); err != nil {
+		return fmt.Errorf("failed to parse link_shared event: %w", err)
+	}
+
+	previews := map[string][]slackapi.Block{}
+	for _, link := range event.Links {
+		if _, done := previews[link.URL]; done {
+			continue
+		}
+		m, ok := detect.Link(link.URL)
+		if !ok {
+			continue
+		}
+		if blocks := unfurlLink(ctx, event, m); blocks != nil {
+			previews[link.URL] = blocks
+		}
+	}
+	if len(previews) == 0 {
+		return nil
+	}
+
+	if err := slack.Unfurl(event.Channel, event.MessageTs, previews); err != nil {
+		return fmt.Errorf("failed to unfurl links: %w", err)
+	}
+	return nil
+}
+
+// unfurlLink looks up the reference behind a link and renders its preview,
+// or returns nil when there is nothing to show
+func unfurlLink(ctx context.Context, event LinkSharedEvent, m detect.Match) []slackapi.Block {
+	tool, args := referenceLookup(m)
+	if tool == "" || !hasTool(tool) {
+		return nil
+	}
+
+	// Unfurls are shown to the whole channel without being asked for, so
+	// they never raise an approval prompt or a denial
+	if perm := permChecker.Check(event.User, event.Channel, tool); !perm.Allowed || perm.NeedsApproval {
+		fmt.Printf("Not unfurling %s %s for %s: %s\n", m.Kind, m.Value, event.User, perm.Reason)
+		return nil
+	}
+
+	start := time.Now()
+	result, err := adyenClient.CallTool(ctx, tool, args)
+	duration := time.Since(start)
+	if err != nil {
+		auditLogger.LogError(ctx, event.User, tool, event.Channel, args, err.Error(), duration)
+		return nil
+	}
+	auditLogger.LogAllowed(ctx, event.User, tool, event.Channel, args, result, duration)
+	return renderers.Render(tool, redactor.Result(result)).Blocks
+}
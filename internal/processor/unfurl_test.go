@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/audit"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/llm"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+)
+
+const (
+	caLink = "https://ca-test.adyen.com/ca/ca/accounts/showTx.shtml?pspReference=8815123456789012&txType=Payment"
+	// The merchant reference, shown in the preview, holds the shopper's email
+	payment = `{"pspReference":"8815123456789012","status":"Authorised","reference":"jane@example.com","amount":{"value":1000,"currency":"EUR"}}`
+)
+
+// linkShared is a link_shared event for links posted by user in channel
+func linkShared(user, channel string, links ...string) *queue.Message {
+	event := `{"channel":"` + channel + `","user":"` + user + `","message_ts":"1.1","links":[`
+	for i, link := range links {
+		if i > 0 {
+			event += ","
+		}
+		event += `{"domain":"ca-test.adyen.com","url":"` + link + `"}`
+	}
+	return &queue.Message{ID: "Ev001", Type: "link_shared", Event: []byte(event + "]}")}
+}
+
+func TestUnfurl(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    func(c *config.Config)
+		user      string
+		links     []string
+		failed    bool // the lookup fails
+		wantCalls []string
+		wantAudit audit.EventType // empty for no entry
+	}{
+		{
+			name:      "allowed",
+			user:      "U1",
+			links:     []string{caLink, caLink, "https://example.com/8815123456789013"},
+			wantCalls: []string{"get_payment"},
+			wantAudit: audit.EventAllowed,
+		},
+		{
+			// Admins get redacted previews too: the whole channel sees them
+			name:      "admin",
+			user:      "UADMIN",
+			links:     []string{caLink},
+			wantCalls: []string{"get_payment"},
+			wantAudit: audit.EventAllowed,
+		},
+		{
+			// A denial isn't posted or audited: nobody asked for the preview
+			name:   "channel not allowed",
+			config: func(c *config.Config) { c.Permissions.Channels = []string{"C2"} },
+			user:   "U1",
+			links:  []string{caLink},
+		},
+		{
+			// A failed lookup leaves the link as it is
+			name:      "lookup fails",
+			user:      "U1",
+			links:     []string{caLink},
+			failed:    true,
+			wantCalls: []string{"get_payment"},
+			wantAudit: audit.EventError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := approvalConfig()
+			if tt.config != nil {
+				tt.config(c)
+			}
+			env := setup(t, c)
+			env.tools.tools = []llm.Tool{{Name: "get_payment"}}
+			env.tools.results["get_payment"] = payment
+			if tt.failed {
+				env.tools.errs["get_payment"] = errors.New("payment not found")
+			}
+
+			if err := handleLinkShared(context.Background(), linkShared(tt.user, "C1", tt.links...)); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := env.tools.called(); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("called %v, want %v", got, tt.wantCalls)
+			}
+			unfurls := env.slack.called("chat.unfurl")
+			if tt.wantAudit != audit.EventAllowed {
+				if len(unfurls) != 0 {
+					t.Errorf("unfurled %v", unfurls)
+				}
+			} else {
+				if len(unfurls) != 1 {
+					t.Fatalf("unfurled %d times, want 1", len(unfurls))
+				}
+				got := unfurls[0].Get("unfurls")
+				if !strings.Contains(got, "8815123456789012") || strings.Contains(got, "example.com/8815") {
+					t.Errorf("unfurls = %s, want a preview of the Adyen link only", got)
+				}
+				if strings.Contains(got, "jane@example.com") {
+					t.Errorf("preview isn't redacted: %s", got)
+				}
+			}
+
+			entries := env.audit.Entries()
+			if tt.wantAudit == "" {
+				if len(entries) != 0 {
+					t.Errorf("audited %+v", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].EventType != tt.wantAudit {
+				t.Fatalf("audited %+v, want one %s entry", entries, tt.wantAudit)
+			}
+		})
+	}
+}
+
+func TestMessageLeavesLinksToUnfurls(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantCalls []map[string]interface{}
+	}{
+		{
+			name: "link alone",
+			text: "<@UBOT> <" + caLink + ">",
+		},
+		{
+			name:      "link and a pasted reference",
+			text:      "<@UBOT> 8815123456789013 <" + caLink + "|this one>",
+			wantCalls: []map[string]interface{}{{"pspReference": "8815123456789013"}},
+		},
+		{
+			// The unfurl is redacted, so a reveal looks the link up itself
+			name:      "reveal",
+			text:      "<@UBOT> reveal <" + caLink + ">",
+			wantCalls: []map[string]interface{}{{"pspReference": "8815123456789012"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := approvalConfig()
+			c.References.MaxLookups = 3
+			env := setup(t, c)
+			env.tools.tools = []llm.Tool{{Name: "get_payment"}}
+			env.tools.results["get_payment"] = payment
+
+			question := MessageEvent{Channel: "C1", User: "UADMIN", Text: tt.text, Ts: "1.1"}
+			if err := answer(context.Background(), question, "UBOT"); err != nil {
+				t.Fatal(err)
+			}
+			var got []map[string]interface{}
+			for _, call := range env.tools.calls {
+				got = append(got, call.Args)
+			}
+			if !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("looked up %v, want %v", got, tt.wantCalls)
+			}
+			if posts := env.slack.called("chat.postMessage"); len(posts) != len(tt.wantCalls) {
+				t.Errorf("posted %d replies, want %d", len(posts), len(tt.wantCalls))
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Dead is a message read from a dead-letter queue for inspection. It stays
+// on the queue until deleted.
+type Dead struct {
+	QueueID      string    // the queue's own message ID
+	Body         string    // raw body, kept for messages that can't be decoded
+	Message      *Message  // nil if the body can't be decoded
+	DecodeErr    error     // why the body couldn't be decoded
+	SentAt       time.Time // when the message first entered the main queue
+	ReceiveCount int
+
+	receipt string
+}
+
+// Matches returns true if id is the message's envelope or queue ID
+func (d *Dead) Matches(id string) bool {
+	return id == d.QueueID || (d.Message != nil && id == d.Message.ID)
+}
+
+// DeadLetters reads and removes messages from a dead-letter queue
+type DeadLetters interface {
+	// Receive returns up to max messages, hiding them from other readers
+	// until they are deleted or released. Like SQS, it may return none while
+	// messages remain, and a message again once it is visible again.
+	Receive(ctx context.Context, max int) ([]*Dead, error)
+	Delete(ctx context.Context, d *Dead) error
+	// Release makes a received message visible again straight away
+	Release(ctx context.Context, d *Dead) error
+}
+
+// emptyReceives is how many receives in a row must bring nothing new before
+// ReceiveAll treats the queue as drained
+const emptyReceives = 3
+
+// ReceiveAll reads every message on the queue once. A message received again
+// replaces its earlier copy, so the latest receipt is the one acted on.
+func ReceiveAll(ctx context.Context, dl DeadLetters) ([]*Dead, error) {
+	var all []*Dead
+	seen := map[string]int{}
+	for empty := 0; empty < emptyReceives; {
+		batch, err := dl.Receive(ctx, 10)
+		if err != nil {
+			return all, err
+		}
+		empty++
+		for _, d := range batch {
+			if i, ok := seen[d.QueueID]; ok {
+				all[i] = d
+				continue
+			}
+			seen[d.QueueID] = len(all)
+			all = append(all, d)
+			empty = 0
+		}
+	}
+	return all, nil
+}
+
+// sqsHideFor is how long received dead letters stay hidden while the CLI
+// works on them, long enough to read and replay a full queue
+const sqsHideFor = 10 * time.Minute
+
+// SQSDeadLetters reads an SQS dead-letter queue
+type SQSDeadLetters struct {
+	client *sqs.Client
+	url    string
+}
+
+// NewSQSDeadLetters creates a reader for the dead-letter queue at url
+func NewSQSDeadLetters(client *sqs.Client, url string) *SQSDeadLetters {
+	return &SQSDeadLetters{client: client, url: url}
+}
+
+func (q *SQSDeadLetters) Receive(ctx context.Context, max int) ([]*Dead, error) {
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: int32(max),
+		VisibilityTimeout:   int32(sqsHideFor.Seconds()),
+		WaitTimeSeconds:     1,
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+			types.MessageSystemAttributeNameSentTimestamp,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter queue: %w", err)
+	}
+
+	dead := make([]*Dead, len(out.Messages))
+	for i, m := range out.Messages {
+		d := newDead(aws.ToString(m.MessageId), aws.ToString(m.Body))
+		d.receipt = aws.ToString(m.ReceiptHandle)
+		d.ReceiveCount, _ = strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		if ms, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+			d.SentAt = time.UnixMilli(ms).UTC()
+		}
+		dead[i] = d
+	}
+	return dead, nil
+}
+
+func (q *SQSDeadLetters) Delete(ctx context.Context, d *Dead) error {
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(d.receipt),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", d.QueueID, err)
+	}
+	return nil
+}
+
+func (q *SQSDeadLetters) Release(ctx context.Context, d *Dead) error {
+	_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.url),
+		ReceiptHandle:     aws.String(d.receipt),
+		VisibilityTimeout: 0,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release %s: %w", d.QueueID, err)
+	}
+	return nil
+}
+
+// MemoryDeadLetters is an in-memory stand-in for a dead-letter queue
+type MemoryDeadLetters struct {
+	mu     sync.Mutex
+	dead   []*Dead
+	hidden map[string]bool
+	seq    int
+}
+
+// NewMemoryDeadLetters creates an empty in-memory dead-letter queue
+func NewMemoryDeadLetters() *MemoryDeadLetters {
+	return &MemoryDeadLetters{hidden: map[string]bool{}}
+}
+
+// Add puts a raw message body on the queue, as if it had failed receiveCount times
+func (q *MemoryDeadLetters) Add(body string, receiveCount int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	d := newDead("dead-"+strconv.Itoa(q.seq), body)
+	d.ReceiveCount = receiveCount
+	d.SentAt = time.Now().UTC()
+	if d.Message != nil && !d.Message.EnqueuedAt.IsZero() {
+		d.SentAt = d.Message.EnqueuedAt
+	}
+	q.dead = append(q.dead, d)
+}
+
+func (q *MemoryDeadLetters) Receive(ctx context.Context, max int) ([]*Dead, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var batch []*Dead
+	for _, d := range q.dead {
+		if len(batch) == max {
+			break
+		}
+		if !q.hidden[d.QueueID] {
+			q.hidden[d.QueueID] = true
+			batch = append(batch, d)
+		}
+	}
+	return batch, nil
+}
+
+func (q *MemoryDeadLetters) Delete(ctx context.Context, d *Dead) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, existing := range q.dead {
+		if existing.QueueID == d.QueueID {
+			q.dead = append(q.dead[:i], q.dead[i+1:]...)
+			delete(q.hidden, d.QueueID)
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s is not on the queue", d.QueueID)
+}
+
+func (q *MemoryDeadLetters) Release(ctx context.Context, d *Dead) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.hidden, d.QueueID)
+	return nil
+}
+
+func newDead(queueID, body string) *Dead {
+	d := &Dead{QueueID: queueID, Body: body}
+	d.Message, d.DecodeErr = Decode(body)
+	return d
+}
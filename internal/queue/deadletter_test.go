@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// scriptedDeadLetters answers each Receive with the next batch of queue IDs
+type scriptedDeadLetters struct {
+	MemoryDeadLetters
+	batches [][]string
+	calls   int
+}
+
+func (q *scriptedDeadLetters) Receive(ctx context.Context, max int) ([]*Dead, error) {
+	q.calls++
+	if len(q.batches) == 0 {
+		return nil, nil
+	}
+	var batch []*Dead
+	for _, id := range q.batches[0] {
+		if id == "error" {
+			return nil, errors.New("throttled")
+		}
+		batch = append(batch, &Dead{QueueID: id, receipt: fmt.Sprintf("receipt-%s-%d", id, q.calls)})
+	}
+	q.batches = q.batches[1:]
+	return batch, nil
+}
+
+func TestReceiveAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   [][]string
+		want      string
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "drained",
+			batches:   [][]string{{"a", "b"}, {"c"}},
+			want:      "a,b,c",
+			wantCalls: 2 + emptyReceives,
+		},
+		{
+			// SQS can come back empty with messages still on the queue
+			name:      "empty receives in between",
+			batches:   [][]string{{}, {"a"}, {}, {}, {"b"}},
+			want:      "a,b",
+			wantCalls: 5 + emptyReceives,
+		},
+		{
+			// Messages visible again after the timeout are only read once
+			name:      "messages received again",
+			batches:   [][]string{{"a", "b"}, {"c", "a"}, {"b", "a"}, {"a"}, {"b"}},
+			want:      "a,b,c",
+			wantCalls: 2 + emptyReceives,
+		},
+		{
+			name:    "error",
+			batches: [][]string{{"a"}, {"error"}},
+			want:    "a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := &scriptedDeadLetters{batches: tt.batches}
+			all, err := ReceiveAll(context.Background(), dl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReceiveAll error = %v, want error %v", err, tt.wantErr)
+			}
+			var ids []string
+			for _, d := range all {
+				ids = append(ids, d.QueueID)
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("ReceiveAll = %s, want %s", got, tt.want)
+			}
+			if tt.wantCalls > 0 && dl.calls != tt.wantCalls {
+				t.Errorf("Receive called %d times, want %d", dl.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestReceiveAllKeepsLatestReceipt(t *testing.T) {
+	dl := &scriptedDeadLetters{batches: [][]string{{"a"}, {"b"}, {"a"}}}
+	all, err := ReceiveAll(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].receipt != "receipt-a-3" {
+		t.Errorf("ReceiveAll = %+v, want a with its second receipt", all)
+	}
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// retryableError marks a transient failure worth another delivery
+type retryableError struct{ err error }
+
+func (e retryableError) Error() string   { return e.err.Error() }
+func (e retryableError) Unwrap() error   { return e.err }
+func (e retryableError) Retryable() bool { return true }
+
+// terminalError marks a failure that must not be delivered again, whatever it wraps
+type terminalError struct{ err error }
+
+func (e terminalError) Error() string { return e.err.Error() }
+func (e terminalError) Unwrap() error { return e.err }
+
+// Retryable marks err as transient: the message goes back on the queue
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err}
+}
+
+// Terminal marks err as final, e.g. once a write has run and delivering the
+// message again could repeat it
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return terminalError{err}
+}
+
+// IsRetryable reports whether the message that failed with err should be
+// delivered again. Errors are terminal unless they are marked Retryable,
+// report themselves as retryable (Slack rate limits and 5xx, Anthropic
+// overload), or are timeouts. Terminal wins over everything it wraps.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var terminal terminalError
+	if errors.As(err, &terminal) {
+		return false
+	}
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// netError is a net.Error that may or may not be a timeout
+type netError struct{ timeout bool }
+
+func (e netError) Error() string   { return "network" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return false }
+
+// selfReported reports its own retryability, like Slack's rate limit errors
+type selfReported bool
+
+func (e selfReported) Error() string   { return "self reported" }
+func (e selfReported) Retryable() bool { return bool(e) }
+
+func TestIsRetryable(t *testing.T) {
+	plain := errors.New("invalid reference")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", plain, false},
+		{"marked retryable", Retryable(plain), true},
+		{"wrapped retryable", fmt.Errorf("failed to reply: %w", Retryable(plain)), true},
+		{"marked terminal", Terminal(plain), false},
+		{"terminal around retryable", Terminal(Retryable(plain)), false},
+		{"retryable around terminal", Retryable(Terminal(plain)), false},
+		{"terminal around a timeout", Terminal(context.DeadlineExceeded), false},
+		{"self reported retryable", fmt.Errorf("failed to post: %w", selfReported(true)), true},
+		{"self reported terminal", selfReported(false), false},
+		{"deadline", fmt.Errorf("failed to call tool: %w", context.DeadlineExceeded), true},
+		{"cancelled", context.Canceled, false},
+		{"network timeout", fmt.Errorf("failed to post: %w", netError{timeout: true}), true},
+		{"network error", netError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	// The marks keep the message
+	if err := Retryable(plain); err.Error() != plain.Error() || !errors.Is(err, plain) {
+		t.Errorf("Retryable = %v, want it to wrap %v", err, plain)
+	}
+	if Retryable(nil) != nil || Terminal(nil) != nil {
+		t.Error("marking nil returned an error")
+	}
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrFull is returned when the in-memory queue has no room, like a throttled send
+var ErrFull = errors.New("queue is full")
+
+// Memory is an in-process queue for local runs. Messages are encoded on the
+// way in and decoded on the way out, exactly as they would be through SQS.
+type Memory struct {
+	ch chan string
+}
+
+// NewMemory creates a queue holding up to size messages
+func NewMemory(size int) *Memory {
+	return &Memory{ch: make(chan string, size)}
+}
+
+// Send encodes and enqueues the message without blocking
+func (q *Memory) Send(ctx context.Context, msg *Message) error {
+	body, err := Encode(ctx, msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case q.ch <- body:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Receive waits for the next message. A message that can't be decoded is
+// returned as an error; ctx cancellation returns ctx.Err().
+func (q *Memory) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case body := <-q.ch:
+		msg, err := Decode(body)
+		if err != nil {
+			return nil, err
+		}
+		// Local runs don't redeliver, so every delivery is the first and last
+		msg.ReceiveCount = 1
+		return msg, nil
+	}
+}
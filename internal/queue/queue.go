@@ -0,0 +1,119 @@
+// Package queue carries Slack events from the webhook to the processor.
+// Messages travel in a versioned envelope so both sides can be deployed
+// independently.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is the envelope version this build writes. Decode accepts it and
+// every earlier version.
+const Version = 1
+
+// Message is the envelope put on the queue
+type Message struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`         // Slack's event ID when there is one, otherwise random
+	EnqueuedAt time.Time `json:"enqueuedAt"` // set by Send
+	TraceID    string    `json:"traceId"`    // follows the request from the webhook through the processor
+
+	// GroupID orders messages on FIFO queues; messages in the same Slack
+	// thread share a group so follow-ups are processed in order
+	GroupID string `json:"groupId,omitempty"`
+
+	Type      string          `json:"type"`
+	Event     json.RawMessage `json:"event"`
+	BotUserID string          `json:"botUserId,omitempty"`
+
+	// AckTs is the placeholder message the webhook posted to acknowledge the
+	// question; the processor replaces it with the answer
+	AckTs string `json:"ackTs,omitempty"`
+
+	// DedupID replaces ID as the FIFO deduplication ID when set. SQS drops a
+	// send with the same deduplication ID for five minutes, so a replay of a
+	// dead letter needs its own.
+	DedupID string `json:"-"`
+
+	// ReceiveCount is how many times the queue has delivered the message,
+	// including this time. It is set by the receiving side.
+	ReceiveCount int `json:"-"`
+}
+
+// Queue delivers messages to the processor
+type Queue interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Encode stamps the envelope and serializes it. The ID and trace ID are
+// generated if the caller didn't set them.
+func Encode(ctx context.Context, msg *Message) (string, error) {
+	msg.Version = Version
+	msg.EnqueuedAt = time.Now().UTC()
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+	if msg.TraceID == "" {
+		msg.TraceID = TraceID(ctx)
+	}
+	if msg.TraceID == "" {
+		msg.TraceID = newID()
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode queue message: %w", err)
+	}
+	return string(body), nil
+}
+
+// Decode reads an envelope. Messages written before the envelope was
+// versioned have the same type, event and botUserId fields and decode as
+// version 0.
+func Decode(body string) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode queue message: %w", err)
+	}
+	if msg.Version > Version {
+		return nil, fmt.Errorf("unsupported queue message version %d (newest known is %d)", msg.Version, Version)
+	}
+	if msg.Type == "" {
+		return nil, fmt.Errorf("queue message has no type")
+	}
+	return &msg, nil
+}
+
+// Age is how long the message has been queued, or zero if unknown
+func (m *Message) Age(now time.Time) time.Duration {
+	if m.EnqueuedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(m.EnqueuedAt)
+}
+
+type traceKey struct{}
+
+// WithTraceID sets the trace ID for messages sent with ctx
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// TraceID returns the trace ID set with WithTraceID
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantVersion int
+		wantID      string
+		wantType    string
+		wantEvent   string
+		wantBot     string
+		wantErr     string
+	}{
+		{
+			// Written before the envelope was versioned
+			name:        "version 0",
+			body:        `{"type":"app_mention","event":{"text":"hi"},"botUserId":"UBOT"}`,
+			wantVersion: 0,
+			wantType:    "app_mention",
+			wantEvent:   `{"text":"hi"}`,
+			wantBot:     "UBOT",
+		},
+		{
+			name:        "version 1",
+			body:        `{"version":1,"id":"Ev001","enqueuedAt":"2026-01-02T03:04:05Z","traceId":"trace-1","groupId":"C1/1700000000.000100","type":"message","event":{"text":"status"},"ackTs":"1700000000.000200"}`,
+			wantVersion: 1,
+			wantID:      "Ev001",
+			wantType:    "message",
+			wantEvent:   `{"text":"status"}`,
+		},
+		{
+			name:    "newer version",
+			body:    `{"version":2,"id":"Ev002","type":"message","event":{}}`,
+			wantErr: "unsupported queue message version 2",
+		},
+		{
+			name:    "no type",
+			body:    `{"version":1,"id":"Ev003","event":{}}`,
+			wantErr: "no type",
+		},
+		{
+			name:    "not JSON",
+			body:    `app_mention`,
+			wantErr: "failed to decode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.body)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Version != tt.wantVersion || msg.ID != tt.wantID || msg.Type != tt.wantType || msg.BotUserID != tt.wantBot {
+				t.Errorf("Decode = %+v", msg)
+			}
+			if string(msg.Event) != tt.wantEvent {
+				t.Errorf("Event = %s, want %s", msg.Event, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestDecodeVersion1Fields(t *testing.T) {
+	msg, err := Decode(`{"version":1,"id":"Ev001","enqueuedAt":"2026-01-02T03:04:05Z","traceId":"trace-1","groupId":"C1/1","type":"message","event":{},"ackTs":"1.2"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.TraceID != "trace-1" || msg.GroupID != "C1/1" || msg.AckTs != "1.2" {
+		t.Errorf("Decode = %+v", msg)
+	}
+	if age := msg.Age(time.Date(2026, 1, 2, 3, 5, 5, 0, time.UTC)); age != time.Minute {
+		t.Errorf("Age = %v, want 1m", age)
+	}
+
+	// Version 0 messages have no enqueue time
+	msg, err = Decode(`{"type":"message","event":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := msg.Age(time.Now()); age != 0 {
+		t.Errorf("Age of a version 0 message = %v, want 0", age)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	ctx := WithTraceID(context.Background(), "trace-1")
+	msg := &Message{Type: "message", Event: []byte(`{"text":"hi"}`), DedupID: "replay-1", ReceiveCount: 3}
+
+	body, err := Encode(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != Version || msg.ID == "" || msg.EnqueuedAt.IsZero() || msg.TraceID != "trace-1" {
+		t.Errorf("Encode didn't stamp the envelope: %+v", msg)
+	}
+	// Delivery details stay off the wire
+	if strings.Contains(body, "replay-1") || strings.Contains(body, "ReceiveCount") {
+		t.Errorf("body carries delivery fields: %s", body)
+	}
+
+	got, err := Decode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != msg.ID || got.TraceID != msg.TraceID || got.Version != Version || string(got.Event) != `{"text":"hi"}` {
+		t.Errorf("Decode(Encode()) = %+v, want %+v", got, msg)
+	}
+
+	// Caller IDs are kept; a missing trace ID is generated
+	msg = &Message{ID: "Ev001", Type: "message"}
+	if _, err := Encode(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != "Ev001" || msg.TraceID == "" {
+		t.Errorf("Encode = %+v", msg)
+	}
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// defaultGroup is the FIFO message group for messages without a GroupID
+const defaultGroup = "default"
+
+// SQS sends messages to an SQS queue. FIFO queues (URLs ending in .fifo) get
+// a message group per GroupID, so messages in a group are processed one at a
+// time in order, and are deduplicated by message ID (or DedupID).
+type SQS struct {
+	client *sqs.Client
+	url    string
+	fifo   bool
+}
+
+// NewSQS creates a sender for the queue at url
+func NewSQS(client *sqs.Client, url string) *SQS {
+	return &SQS{client: client, url: url, fifo: strings.HasSuffix(url, ".fifo")}
+}
+
+// Send encodes and sends the message
+func (q *SQS) Send(ctx context.Context, msg *Message) error {
+	body, err := Encode(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.url),
+		MessageBody: aws.String(body),
+	}
+	if q.fifo {
+		group := msg.GroupID
+		if group == "" {
+			group = defaultGroup
+		}
+		input.MessageGroupId = aws.String(group)
+		dedup := msg.ID
+		if msg.DedupID != "" {
+			dedup = msg.DedupID
+		}
+		input.MessageDeduplicationId = aws.String(dedup)
+	}
+
+	if _, err := q.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("failed to send queue message: %w", err)
+	}
+	return nil
+}
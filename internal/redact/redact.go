@@ -0,0 +1,187 @@
+package redact
+
+import (
+	"encoding/json"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+// Action describes what happens to a matching JSON field
+type Action string
+
+const (
+	ActionMask   Action = "mask"   // Replace the value with a placeholder
+	ActionRemove Action = "remove" // Drop the field entirely
+	ActionKeep   Action = "keep"   // Leave untouched, skipping detectors
+)
+
+// Placeholders used in place of redacted values
+const (
+	Masked      = "[REDACTED]"
+	maskedPAN   = "[CARD REDACTED]"
+	maskedEmail = "[EMAIL REDACTED]"
+	maskedIBAN  = "[IBAN REDACTED]"
+)
+
+const (
+	minPANDigits  = 13
+	maxPANDigits  = 19
+	minIBANLength = 15
+	// Major networks issue from these leading digits (Mastercard 2-series, Amex, Visa, Mastercard, Discover)
+	panIssuerDigits = "23456"
+)
+
+var (
+	// Digit runs that may contain single spaces or dashes, as cards are often written
+	panPattern   = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+)
+
+// Redactor removes PII and card data from tool results and free text
+type Redactor struct {
+	fields map[string]Action
+}
+
+// New creates a redactor from the configured field rules
+func New(cfg *config.Config) *Redactor {
+	fields := make(map[string]Action, len(cfg.Redaction.Fields))
+	for name, action := range cfg.Redaction.Fields {
+		fields[strings.ToLower(name)] = Action(action)
+	}
+	return &Redactor{fields: fields}
+}
+
+// Text applies the PAN, email and IBAN detectors to free text
+func (r *Redactor) Text(s string) string {
+	s = panPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if isPAN(m) {
+			return maskedPAN
+		}
+		return m
+	})
+	s = ibanPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if isIBAN(m) {
+			return maskedIBAN
+		}
+		return m
+	})
+	return emailPattern.ReplaceAllString(s, maskedEmail)
+}
+
+// Result redacts a tool result. JSON results get field rules and detectors
+// applied to every string value; anything else is treated as free text.
+func (r *Redactor) Result(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return r.Text(s)
+	}
+	out, err := json.MarshalIndent(r.Value(v), "", "  ")
+	if err != nil {
+		return r.Text(s)
+	}
+	return string(out)
+}
+
+// Value redacts a decoded JSON value, such as tool arguments
+func (r *Redactor) Value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			switch r.fields[strings.ToLower(k)] {
+			case ActionRemove:
+				continue
+			case ActionMask:
+				out[k] = Masked
+			case ActionKeep:
+				out[k] = child
+			default:
+				out[k] = r.Value(child)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = r.Value(child)
+		}
+		return out
+	case string:
+		return r.Text(val)
+	default:
+		return v
+	}
+}
+
+// Map redacts tool arguments, returning a new map
+func (r *Redactor) Map(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return r.Value(m).(map[string]interface{})
+}
+
+// isPAN checks length, issuer prefix and Luhn checksum, so that numeric
+// PSP references and order IDs are not mistaken for card numbers
+func isPAN(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < minPANDigits || len(digits) > maxPANDigits {
+		return false
+	}
+	if !strings.ContainsAny(digits[:1], panIssuerDigits) {
+		return false
+	}
+	return luhn(digits)
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isIBAN validates the ISO 13616 mod-97 checksum
+func isIBAN(s string) bool {
+	iban := strings.ReplaceAll(s, " ", "")
+	if len(iban) < minIBANLength {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			numeric.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			numeric.WriteString(strconv.Itoa(int(c-'A') + 10))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,116 @@
+package redact
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+)
+
+func TestText(t *testing.T) {
+	r := New(&config.Config{})
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"card", "card 4111111111111111 declined", "card [CARD REDACTED] declined"},
+		{"card with spaces", "card 4111 1111 1111 1111", "card [CARD REDACTED]"},
+		{"card with dashes", "card 5555-5555-5555-4444", "card [CARD REDACTED]"},
+		{"amex", "card 378282246310005", "card [CARD REDACTED]"},
+		{"failed Luhn", "card 4111111111111112", "card 4111111111111112"},
+		// PSP references are 16 digits but don't start with an issuer digit
+		{"PSP reference", "payment 8815123456789012", "payment 8815123456789012"},
+		{"too short", "order 411111111111", "order 411111111111"},
+		{"IBAN", "to DE89370400440532013000 today", "to [IBAN REDACTED] today"},
+		{"IBAN with spaces", "to GB82 WEST 1234 5698 7654 32", "to [IBAN REDACTED]"},
+		{"bad IBAN checksum", "to DE89370400440532013001", "to DE89370400440532013001"},
+		{"email", "from jane.doe+test@example.co.uk", "from [EMAIL REDACTED]"},
+		{"nothing", "refund the last payment", "refund the last payment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := New(&config.Config{Redaction: config.RedactionConfig{Fields: map[string]string{
+		"shopperName":  "mask",
+		"shopperIP":    "remove",
+		"ShopperEmail": "keep", // rules match case-insensitively
+	}}})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "mask",
+			in:   `{"shopperName": "Jane Doe", "status": "Authorised"}`,
+			want: `{"shopperName": "[REDACTED]", "status": "Authorised"}`,
+		},
+		{
+			name: "remove",
+			in:   `{"shopperIP": "10.0.0.1", "status": "Authorised"}`,
+			want: `{"status": "Authorised"}`,
+		},
+		{
+			name: "keep skips detectors",
+			in:   `{"shopperEmail": "jane@example.com", "note": "jane@example.com"}`,
+			want: `{"shopperEmail": "jane@example.com", "note": "[EMAIL REDACTED]"}`,
+		},
+		{
+			name: "nested",
+			in:   `{"items": [{"shopperName": "Jane", "card": "4111111111111111"}], "amount": {"value": 1000}}`,
+			want: `{"items": [{"shopperName": "[REDACTED]", "card": "[CARD REDACTED]"}], "amount": {"value": 1000}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in, want interface{}
+			if err := json.Unmarshal([]byte(tt.in), &in); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Value(in); !reflect.DeepEqual(got, want) {
+				t.Errorf("Value = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	r := New(&config.Config{Redaction: config.RedactionConfig{Fields: map[string]string{"shopperName": "mask"}}})
+
+	got := r.Result(`{"shopperName":"Jane"}`)
+	if want := "{\n  \"shopperName\": \"[REDACTED]\"\n}"; got != want {
+		t.Errorf("Result(JSON) = %q, want %q", got, want)
+	}
+	// Anything that isn't JSON is free text
+	if got := r.Result("shopperName: Jane, card 4111111111111111"); got != "shopperName: Jane, card [CARD REDACTED]" {
+		t.Errorf("Result(text) = %q", got)
+	}
+}
+
+func TestMap(t *testing.T) {
+	r := New(&config.Config{})
+	if got := r.Map(nil); got != nil {
+		t.Errorf("Map(nil) = %v, want nil", got)
+	}
+	args := map[string]interface{}{"reference": "4111111111111111"}
+	got := r.Map(args)
+	if got["reference"] != maskedPAN {
+		t.Errorf("Map = %v", got)
+	}
+	if args["reference"] != "4111111111111111" {
+		t.Errorf("Map changed its argument: %v", args)
+	}
+}
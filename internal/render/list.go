@@ -0,0 +1,218 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxInlineRows is the most list rows shown in the message itself
+	maxInlineRows = 10
+	// maxInlineColumns keeps the inline table narrow enough to read in a thread
+	maxInlineColumns = 5
+	// maxCellWidth truncates long values in the inline table
+	maxCellWidth = 32
+)
+
+// preferredColumns come first in tables, in this order; the rest are sorted
+var preferredColumns = []string{
+	"id", "pspReference", "merchantReference", "reference", "status", "name",
+	"amount.value", "amount.currency", "merchantAccount", "model", "serialNumber",
+}
+
+// listRows finds the rows of a list result: a top-level array of objects, or
+// the largest array of objects inside an object (e.g. {"data": [...]})
+func listRows(data interface{}) ([]map[string]interface{}, bool) {
+	if items, ok := data.([]interface{}); ok {
+		return objectRows(items)
+	}
+
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	var best []map[string]interface{}
+	found := false
+	for _, value := range obj {
+		items, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		if rows, ok := objectRows(items); ok && len(rows) >= len(best) {
+			best, found = rows, true
+		}
+	}
+	return best, found
+}
+
+func objectRows(items []interface{}) ([]map[string]interface{}, bool) {
+	rows := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		rows = append(rows, m)
+	}
+	return rows, true
+}
+
+// list shows the first rows as a table and attaches every row as CSV when
+// the list is too long to show in full
+func list(title string, rows []map[string]interface{}) Output {
+	if len(rows) == 0 {
+		return Output{Text: title, Blocks: []slack.Block{titleBlock(title), textBlock("_No items._")}}
+	}
+
+	flat := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		flat[i] = map[string]string{}
+		flatten("", row, flat[i])
+	}
+	columns := tableColumns(flat)
+
+	heading := fmt.Sprintf("%s (%d)", title, len(rows))
+	shown := flat
+	if len(shown) > maxInlineRows {
+		shown = shown[:maxInlineRows]
+	}
+	inlineColumns := columns
+	if len(inlineColumns) > maxInlineColumns {
+		inlineColumns = inlineColumns[:maxInlineColumns]
+	}
+	table := textTable(inlineColumns, shown)
+
+	complete := len(shown) == len(flat) && len(inlineColumns) == len(columns) && len(table) <= slackClient.MaxInlineText
+	blocks := []slack.Block{titleBlock(heading), codeBlock(table)}
+	if complete {
+		return Output{Text: heading, Blocks: blocks}
+	}
+
+	blocks = append(blocks, noteBlock(fmt.Sprintf("Showing %d of %d rows and %d of %d columns. The full list is attached as CSV.",
+		len(shown), len(flat), len(inlineColumns), len(columns))))
+	return Output{
+		Text:   heading,
+		Blocks: blocks,
+		File:   &slackClient.File{Filename: fileName(title, "csv"), Title: heading, Content: csvTable(columns, flat)},
+	}
+}
+
+// flatten writes nested objects as dotted keys, e.g. amount.value; arrays
+// are kept as compact JSON
+func flatten(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flatten(name, child, out)
+		}
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		out[prefix] = string(data)
+	default:
+		out[prefix] = scalarText(v)
+	}
+}
+
+// tableColumns orders the union of keys, preferred columns first
+func tableColumns(rows []map[string]string) []string {
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for key := range row {
+			seen[key] = true
+		}
+	}
+
+	var columns []string
+	for _, key := range preferredColumns {
+		if seen[key] {
+			columns = append(columns, key)
+			delete(seen, key)
+		}
+	}
+	rest := make([]string, 0, len(seen))
+	for key := range seen {
+		rest = append(rest, key)
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+func textTable(columns []string, rows []map[string]string) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = truncate(row[column], maxCellWidth)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func csvTable(columns []string, rows []map[string]string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
+// indentJSON pretty-prints raw JSON for the attachment, leaving it as is if it isn't valid
+func indentJSON(raw string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(raw), "", "  "); err != nil {
+		return raw
+	}
+	return buf.String()
+}
+
+// fileName builds an attachment name from a tool name or title, e.g. list_terminals.csv
+func fileName(name, ext string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		name = "result"
+	}
+	return name + "." + ext
+}
+
+func byteSize(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
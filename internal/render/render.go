@@ -0,0 +1,390 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getalternative/adyen-slack-assistant/internal/adyen"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	"github.com/slack-go/slack"
+)
+
+// maxFields is the most fields Slack allows in one section block
+const maxFields = 10
+
+// maxFieldText cuts long values so a field stays readable (Slack allows 2000)
+const maxFieldText = 200
+
+// Result is a tool result handed to a renderer
+type Result struct {
+	Tool string
+	Raw  string
+	// Data is the decoded JSON, nil if the result isn't JSON
+	Data interface{}
+}
+
+// Object returns the result as a JSON object, if it is one
+func (r Result) Object() (map[string]interface{}, bool) {
+	m, ok := r.Data.(map[string]interface{})
+	return m, ok
+}
+
+// Output is a rendered result: the inline message, plus the full result as
+// a file when it is too large or too tabular to read inline
+type Output struct {
+	Text   string
+	Blocks []slack.Block
+	File   *slackClient.File
+}
+
+// Renderer turns a tool result into a message
+type Renderer func(r Result) Output
+
+// Registry maps tool names to renderers, with a generic fallback
+type Registry struct {
+	renderers    map[string]Renderer
+	customerArea string
+}
+
+// New creates a registry with renderers for the Adyen tools we know
+func New(cfg *config.Config) *Registry {
+	reg := &Registry{
+		renderers:    map[string]Renderer{},
+		customerArea: "https://ca-test.adyen.com",
+	}
+	if strings.EqualFold(cfg.Adyen.Environment, "LIVE") {
+		reg.customerArea = "https://ca-live.adyen.com"
+	}
+
+	reg.Register("refund_payment", reg.payment("Refund processed"))
+	reg.Register("cancel_payment", reg.payment("Payment cancelled"))
+	reg.Register("capture_payment", reg.payment("Payment captured"))
+	reg.Register("get_payment", reg.payment("Payment"))
+	reg.Register("create_payment_link", reg.paymentLink("Payment link created"))
+	reg.Register("get_payment_link", reg.paymentLink("Payment link"))
+	reg.Register("expire_payment_link", reg.paymentLink("Payment link expired"))
+	reg.Register("update_payment_link", reg.paymentLink("Payment link updated"))
+	return reg
+}
+
+// Register sets the renderer for a tool, replacing any existing one
+func (reg *Registry) Register(tool string, fn Renderer) {
+	reg.renderers[tool] = fn
+}
+
+// Render formats a tool result. Unknown tools are rendered by the shape of
+// their result, falling back to a generic field list or code block.
+func (reg *Registry) Render(tool, raw string) Output {
+	r := Result{Tool: tool, Raw: raw}
+	json.Unmarshal([]byte(raw), &r.Data)
+
+	if fn, ok := reg.renderers[tool]; ok {
+		return fn(r)
+	}
+	if obj, ok := r.Object(); ok {
+		switch {
+		case obj["url"] != nil && obj["expiresAt"] != nil:
+			return reg.paymentLink(titleFor(tool))(r)
+		case obj["pspReference"] != nil || obj["paymentPspReference"] != nil:
+			return reg.payment(titleFor(tool))(r)
+		}
+	}
+	return generic(r)
+}
+
+// CustomerAreaURL links to a payment in the Adyen Customer Area
+func (reg *Registry) CustomerAreaURL(pspReference string) string {
+	return fmt.Sprintf("%s/ca/ca/accounts/showTx.shtml?pspReference=%s&txType=Payment", reg.customerArea, pspReference)
+}
+
+// payment renders payments and modifications (refunds, cancels, captures)
+func (reg *Registry) payment(title string) Renderer {
+	return func(r Result) Output {
+		obj, ok := r.Object()
+		if !ok {
+			return generic(r)
+		}
+
+		status := firstString(obj, "status", "resultCode")
+		fields := fieldList{}
+		fields.add("Status", statusText(status))
+		fields.add("Amount", amountText(obj["amount"]))
+		fields.add("PSP reference", code(firstString(obj, "pspReference")))
+		if original := firstString(obj, "paymentPspReference", "originalReference"); original != "" {
+			fields.add("Payment", code(original))
+		}
+		fields.add("Merchant reference", firstString(obj, "reference", "merchantReference"))
+		fields.add("Merchant account", firstString(obj, "merchantAccount"))
+		fields.add("Payment method", paymentMethodText(obj["paymentMethod"]))
+
+		blocks := []slack.Block{titleBlock(title), fields.block()}
+
+		// Link to the payment itself, not the refund or cancel modification
+		if psp := firstString(obj, "paymentPspReference", "originalReference", "pspReference"); psp != "" {
+			button := slack.NewButtonBlockElement("open_customer_area", psp,
+				slack.NewTextBlockObject(slack.PlainTextType, "View in Customer Area", false, false))
+			button.URL = reg.CustomerAreaURL(psp)
+			blocks = append(blocks, slack.NewActionBlock("", button))
+		}
+
+		text := title
+		if amount := amountText(obj["amount"]); amount != "" {
+			text += ": " + amount
+		}
+		return Output{Text: text, Blocks: blocks}
+	}
+}
+
+// paymentLink renders payment links with a button to open them
+func (reg *Registry) paymentLink(title string) Renderer {
+	return func(r Result) Output {
+		obj, ok := r.Object()
+		if !ok {
+			return generic(r)
+		}
+
+		fields := fieldList{}
+		fields.add("Amount", amountText(obj["amount"]))
+		fields.add("Status", statusText(firstString(obj, "status")))
+		fields.add("Reference", firstString(obj, "reference"))
+		fields.add("Expires", timeText(firstString(obj, "expiresAt")))
+		fields.add("Merchant account", firstString(obj, "merchantAccount"))
+		fields.add("Link ID", code(firstString(obj, "id")))
+
+		blocks := []slack.Block{titleBlock(title), fields.block()}
+
+		url := firstString(obj, "url")
+		if url != "" {
+			button := slack.NewButtonBlockElement("open_payment_link", firstString(obj, "id"),
+				slack.NewTextBlockObject(slack.PlainTextType, "Open payment link", false, false))
+			button.URL = url
+			button.Style = slack.StylePrimary
+			blocks = append(blocks, slack.NewActionBlock("", button))
+		}
+
+		text := title
+		if url != "" {
+			text += ": " + url
+		}
+		return Output{Text: text, Blocks: blocks}
+	}
+}
+
+// generic renders tools without a renderer: lists as tables, small objects
+// as fields and anything else as code, attaching the full result when it
+// doesn't fit inline
+func generic(r Result) Output {
+	title := titleFor(r.Tool)
+
+	if rows, ok := listRows(r.Data); ok {
+		return list(title, rows)
+	}
+
+	obj, isObject := r.Object()
+	var fields fieldList
+	if isObject {
+		var nested bool
+		fields, nested = scalarFields(obj)
+		if !nested && len(fields) > 0 && len(fields) <= maxFields {
+			return Output{Text: title, Blocks: []slack.Block{titleBlock(title), fields.block()}}
+		}
+		if len(obj) == 0 {
+			return Output{Text: title, Blocks: []slack.Block{titleBlock(title), textBlock("_No details returned._")}}
+		}
+	}
+
+	if len(r.Raw) <= slackClient.MaxInlineText {
+		return Output{Text: title, Blocks: []slack.Block{titleBlock(title), codeBlock(r.Raw)}}
+	}
+
+	// Too large to read inline: summarize the top-level fields and attach the rest
+	blocks := []slack.Block{titleBlock(title)}
+	if len(fields) > 0 {
+		blocks = append(blocks, fields.block())
+	}
+	blocks = append(blocks, noteBlock(fmt.Sprintf("Full result attached (%s).", byteSize(len(r.Raw)))))
+
+	file := &slackClient.File{Filename: fileName(r.Tool, "txt"), Title: title, Content: r.Raw}
+	if r.Data != nil {
+		file.Filename = fileName(r.Tool, "json")
+		file.Content = indentJSON(r.Raw)
+	}
+	return Output{Text: title, Blocks: blocks, File: file}
+}
+
+// scalarFields lists an object's scalar fields and amounts, sorted by key,
+// reporting whether it also has other nested data
+func scalarFields(obj map[string]interface{}) (fieldList, bool) {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := fieldList{}
+	nested := false
+	for _, key := range keys {
+		switch value := obj[key].(type) {
+		case map[string]interface{}, []interface{}:
+			if amount, ok := adyen.AmountFrom(value); ok {
+				fields.add(humanize(key), amount.String())
+			} else {
+				nested = true
+			}
+		default:
+			fields.add(humanize(key), scalarText(value))
+		}
+	}
+	return fields, nested
+}
+
+// titleFor derives a heading from the tool name, e.g. list_terminals -> List terminals
+func titleFor(tool string) string {
+	if tool == "" {
+		return "Result"
+	}
+	words := strings.ReplaceAll(tool, "_", " ")
+	return strings.ToUpper(words[:1]) + words[1:]
+}
+
+// fieldList collects the label/value pairs of a section, skipping empty values
+type fieldList []*slack.TextBlockObject
+
+func (f *fieldList) add(label, value string) {
+	if value == "" {
+		return
+	}
+	*f = append(*f, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", label, truncate(value, maxFieldText)), false, false))
+}
+
+func (f fieldList) block() slack.Block {
+	if len(f) == 0 {
+		return textBlock("_No details returned._")
+	}
+	if len(f) > maxFields {
+		f = f[:maxFields]
+	}
+	return slack.NewSectionBlock(nil, f, nil)
+}
+
+// noteBlock is a small grey line under a result
+func noteBlock(text string) slack.Block {
+	return slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, text, false, false))
+}
+
+func titleBlock(title string) slack.Block {
+	return textBlock("*" + title + "*")
+}
+
+func textBlock(text string) slack.Block {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// codeBlock shows raw output, cut to fit in a single section
+func codeBlock(raw string) slack.Block {
+	if runes := []rune(raw); len(runes) > slackClient.MaxInlineText {
+		raw = string(runes[:slackClient.MaxInlineText]) + "…"
+	}
+	return textBlock("```\n" + raw + "\n```")
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func amountText(v interface{}) string {
+	if amount, ok := adyen.AmountFrom(v); ok {
+		return amount.String()
+	}
+	return ""
+}
+
+func paymentMethodText(v interface{}) string {
+	switch pm := v.(type) {
+	case string:
+		return pm
+	case map[string]interface{}:
+		brand := firstString(pm, "brand", "type")
+		if last := firstString(pm, "lastFour"); last != "" {
+			return fmt.Sprintf("%s •••• %s", brand, last)
+		}
+		return brand
+	}
+	return ""
+}
+
+// statusText adds an emoji to the statuses people scan for
+func statusText(status string) string {
+	switch strings.ToLower(status) {
+	case "":
+		return ""
+	case "authorised", "received", "active", "completed", "success":
+		return ":white_check_mark: " + status
+	case "refused", "error", "cancelled", "expired":
+		return ":x: " + status
+	case "pending", "processing":
+		return ":hourglass_flowing_sand: " + status
+	}
+	return status
+}
+
+func timeText(s string) string {
+	if s == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+func scalarText(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		if value {
+			return "yes"
+		}
+		return "no"
+	}
+	return fmt.Sprint(v)
+}
+
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
+
+// humanize turns a JSON key into a label, e.g. merchantAccount -> Merchant account
+func humanize(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case i == 0:
+			b.WriteString(strings.ToUpper(string(r)))
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte(' ')
+			b.WriteRune(r + ('a' - 'A'))
+		case r == '_':
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
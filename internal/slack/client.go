@@ -1,10 +1,25 @@
 package slack
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/getalternative/adyen-slack-assistant/internal/config"
 	"github.com/slack-go/slack"
 )
 
+// AckReaction marks a message the bot has received but not yet answered
+const AckReaction = "eyes"
+
+// maxMessageText is Slack's limit on the text of a single message
+const maxMessageText = 40000
+
+// MaxInlineText is the most raw output shown in a message block; anything
+// longer is summarized inline and uploaded as a file
+const MaxInlineText = 2900
+
 type Client struct {
 	api *slack.Client
 }
@@ -15,6 +30,11 @@ func New(cfg *config.Config) *Client {
 	}
 }
 
+// NewWithAPI wraps a slack-go client, e.g. one pointed at another API URL
+func NewWithAPI(api *slack.Client) *Client {
+	return &Client{api: api}
+}
+
 // Message represents an incoming Slack message
 type Message struct {
 	Channel  string
@@ -22,6 +42,12 @@ type Message struct {
 	Text     string
 	Ts       string // Message timestamp
 	ThreadTs string // Thread timestamp (empty if not in a thread)
+	// AckTs is a message the bot posted in the thread, a "working on it…"
+	// placeholder or the answer to a question since edited; the first reply
+	// replaces it instead of posting a new message
+	AckTs string
+	// Answered is the first reply in the thread, set once one is sent
+	Answered string
 }
 
 // GetThreadTs returns the thread timestamp to reply to.
@@ -36,23 +62,204 @@ func (m *Message) GetThreadTs() string {
 
 // Reply sends a message in the same thread as the original message.
 // Always creates/continues a thread - never posts at channel level.
+// Text over Slack's message limit is cut short and uploaded in full.
 func (c *Client) Reply(msg *Message, text string) error {
-	_, _, err := c.api.PostMessage(
+	if len(text) > maxMessageText {
+		return c.replyOversized(msg, text)
+	}
+	if ts := msg.takeAck(); ts != "" {
+		return c.replaceAck(msg, ts, text, nil)
+	}
+	_, ts, err := c.api.PostMessage(
 		msg.Channel,
 		slack.MsgOptionText(text, false),
 		slack.MsgOptionTS(msg.GetThreadTs()),
 	)
+	if err == nil {
+		msg.answered(ts)
+	}
 	return err
 }
 
 // ReplyBlocks sends a message with blocks in the same thread.
 func (c *Client) ReplyBlocks(msg *Message, text string, blocks ...slack.Block) error {
-	_, _, err := c.api.PostMessage(
+	if ts := msg.takeAck(); ts != "" {
+		return c.replaceAck(msg, ts, text, blocks)
+	}
+	_, ts, err := c.api.PostMessage(
 		msg.Channel,
 		slack.MsgOptionText(text, false),
 		slack.MsgOptionTS(msg.GetThreadTs()),
 		slack.MsgOptionBlocks(blocks...),
 	)
+	if err == nil {
+		msg.answered(ts)
+	}
+	return err
+}
+
+// File is content uploaded to a thread alongside a reply
+type File struct {
+	Filename string
+	Title    string
+	Content  string
+}
+
+// ReplyWithFile posts a summary in the thread and, if file is set, uploads it
+// there with the full content
+func (c *Client) ReplyWithFile(msg *Message, text string, blocks []slack.Block, file *File) error {
+	if err := c.ReplyBlocks(msg, text, blocks...); err != nil {
+		return err
+	}
+	if file == nil {
+		return nil
+	}
+	if err := c.UploadFile(msg, file.Filename, file.Title, file.Content); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", file.Filename, err)
+	}
+	return nil
+}
+
+// replyOversized posts the start of text and uploads all of it
+func (c *Client) replyOversized(msg *Message, text string) error {
+	head := text
+	if runes := []rune(head); len(runes) > MaxInlineText {
+		head = string(runes[:MaxInlineText])
+	}
+	// Don't leave a code block open in the preview
+	if strings.Count(head, "```")%2 == 1 {
+		head += "\n```"
+	}
+	head += "\n\n_(message too long, the full text is attached)_"
+
+	return c.ReplyWithFile(msg, head, []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, head, false, false), nil, nil),
+	}, &File{Filename: "reply.txt", Title: "Full reply", Content: text})
+}
+
+// ReplyEphemeral shows a message in the thread to the requester only.
+// Slack doesn't keep ephemeral messages, so they vanish on reload.
+func (c *Client) ReplyEphemeral(msg *Message, text string, blocks ...slack.Block) error {
+	options := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionTS(msg.GetThreadTs()),
+	}
+	if len(blocks) > 0 {
+		options = append(options, slack.MsgOptionBlocks(blocks...))
+	}
+	_, err := c.api.PostEphemeral(msg.Channel, msg.User, options...)
+	return err
+}
+
+// SendDM sends a direct message to a user and returns the DM channel ID
+func (c *Client) SendDM(userID, text string, blocks ...slack.Block) (string, error) {
+	channel, err := c.openDM(userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = c.PostBlocksToChannel(channel, "", text, blocks...)
+	return channel, err
+}
+
+// ReplyPrivately shows a message to the requester only: ephemerally in the
+// thread, or by DM when that isn't possible (e.g. the bot isn't in the
+// channel). A file can't be ephemeral, so it is always sent by DM.
+func (c *Client) ReplyPrivately(msg *Message, text string, blocks []slack.Block, file *File) error {
+	// The placeholder is public, so it can't carry a private reply
+	c.DropAck(msg)
+
+	if file != nil {
+		channel, err := c.openDM(msg.User)
+		if err != nil {
+			return fmt.Errorf("failed to open DM: %w", err)
+		}
+		dm := &Message{Channel: channel, User: msg.User}
+		if err := c.ReplyWithFile(dm, text, blocks, file); err != nil {
+			return err
+		}
+		return c.ReplyEphemeral(msg, "I've sent you the result in a direct message.")
+	}
+
+	if err := c.ReplyEphemeral(msg, text, blocks...); err != nil {
+		fmt.Printf("Ephemeral reply failed, sending DM instead: %v\n", err)
+		if _, dmErr := c.SendDM(msg.User, text, blocks...); dmErr != nil {
+			return fmt.Errorf("failed to reply privately: %w", errors.Join(err, dmErr))
+		}
+	}
+	return nil
+}
+
+// DropAck deletes the message's placeholder if no reply has replaced it
+func (c *Client) DropAck(msg *Message) {
+	ts := msg.takeAck()
+	if ts == "" {
+		return
+	}
+	if err := c.DeleteMessage(msg.Channel, ts); err != nil {
+		fmt.Printf("Failed to delete placeholder %s: %v\n", ts, err)
+	}
+}
+
+// replaceAck turns the placeholder into a reply. Blocks are always sent, so
+// a placeholder that was an earlier answer keeps none of its old blocks.
+func (c *Client) replaceAck(msg *Message, ts, text string, blocks []slack.Block) error {
+	if blocks == nil {
+		blocks = []slack.Block{}
+	}
+	if err := c.UpdateMessage(msg.Channel, ts, text, blocks...); err != nil {
+		return err
+	}
+	msg.answered(ts)
+	return nil
+}
+
+// takeAck returns the placeholder to replace, at most once
+func (m *Message) takeAck() string {
+	ts := m.AckTs
+	m.AckTs = ""
+	return ts
+}
+
+// answered records ts as the reply to the message, unless one came before
+func (m *Message) answered(ts string) {
+	if m.Answered == "" {
+		m.Answered = ts
+	}
+}
+
+func (c *Client) openDM(userID string) (string, error) {
+	channel, _, _, err := c.api.OpenConversation(&slack.OpenConversationParameters{Users: []string{userID}})
+	if err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+// UpdateMessage replaces the text and blocks of a message the bot posted
+func (c *Client) UpdateMessage(channel, ts, text string, blocks ...slack.Block) error {
+	_, _, _, err := c.api.UpdateMessage(
+		channel,
+		ts,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return err
+}
+
+// DeleteMessage deletes a message the bot posted
+func (c *Client) DeleteMessage(channel, ts string) error {
+	_, _, err := c.api.DeleteMessage(channel, ts)
+	return err
+}
+
+// Unfurl attaches previews to the links in a message, keyed by URL. Each
+// preview is shown as its blocks.
+func (c *Client) Unfurl(channel, ts string, previews map[string][]slack.Block) error {
+	unfurls := make(map[string]slack.Attachment, len(previews))
+	for url, blocks := range previews {
+		unfurls[url] = slack.Attachment{Blocks: slack.Blocks{BlockSet: blocks}}
+	}
+	_, _, _, err := c.api.UnfurlMessage(channel, ts, unfurls)
 	return err
 }
 
@@ -66,6 +273,62 @@ func (c *Client) PostToChannel(channel, threadTs, text string) (string, error) {
 	return ts, err
 }
 
+// UploadFile uploads content as a file in the same thread as the message.
+func (c *Client) UploadFile(msg *Message, filename, title, content string) error {
+	_, err := c.api.UploadFileV2(slack.UploadFileV2Parameters{
+		Channel:         msg.Channel,
+		ThreadTimestamp: msg.GetThreadTs(),
+		Filename:        filename,
+		Title:           title,
+		Content:         content,
+		FileSize:        len(content),
+	})
+	return err
+}
+
+// PostBlocksToChannel posts a message with blocks to a specific channel and thread.
+func (c *Client) PostBlocksToChannel(channel, threadTs, text string, blocks ...slack.Block) (string, error) {
+	_, ts, err := c.api.PostMessage(
+		channel,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionTS(threadTs),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return ts, err
+}
+
+// GetThreadReplies lists the messages in a thread, starting with its parent
+func (c *Client) GetThreadReplies(channel, threadTs string) ([]slack.Message, error) {
+	var all []slack.Message
+	params := &slack.GetConversationRepliesParameters{ChannelID: channel, Timestamp: threadTs, Limit: 200}
+	for {
+		msgs, hasMore, cursor, err := c.api.GetConversationReplies(params)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, msgs...)
+		if !hasMore || cursor == "" {
+			return all, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// DownloadFile reads a file shared with the bot, refusing files over maxBytes
+func (c *Client) DownloadFile(file slack.File, maxBytes int) ([]byte, error) {
+	if file.Size > maxBytes {
+		return nil, fmt.Errorf("%s is too large (%d bytes, limit %d)", file.Name, file.Size, maxBytes)
+	}
+	var buf bytes.Buffer
+	if err := c.api.GetFile(file.URLPrivateDownload, &buf); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", file.Name, err)
+	}
+	if buf.Len() > maxBytes {
+		return nil, fmt.Errorf("%s is too large (limit %d bytes)", file.Name, maxBytes)
+	}
+	return buf.Bytes(), nil
+}
+
 // GetUserInfo retrieves user information
 func (c *Client) GetUserInfo(userID string) (*slack.User, error) {
 	return c.api.GetUserInfo(userID)
@@ -83,3 +346,44 @@ func (c *Client) AddReaction(channel, timestamp, reaction string) error {
 		Timestamp: timestamp,
 	})
 }
+
+// RemoveReaction removes the bot's reaction from a message
+func (c *Client) RemoveReaction(channel, timestamp, reaction string) error {
+	return c.api.RemoveReaction(reaction, slack.ItemRef{
+		Channel:   channel,
+		Timestamp: timestamp,
+	})
+}
+
+// GetReactions lists the reactions on a message, with every user who added each one
+func (c *Client) GetReactions(channel, timestamp string) ([]slack.ItemReaction, error) {
+	return c.api.GetReactions(slack.ItemRef{
+		Channel:   channel,
+		Timestamp: timestamp,
+	}, slack.GetReactionsParameters{Full: true})
+}
+
+// PublishHome replaces the user's App Home tab with blocks
+func (c *Client) PublishHome(userID string, blocks ...slack.Block) error {
+	_, err := c.api.PublishView(userID, slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}, "")
+	return err
+}
+
+// OpenView opens a modal and returns its view ID. The trigger ID expires
+// three seconds after the user's click, so this must run in the webhook.
+func (c *Client) OpenView(triggerID string, view slack.ModalViewRequest) (string, error) {
+	resp, err := c.api.OpenView(triggerID, view)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// UpdateView replaces the contents of an open modal
+func (c *Client) UpdateView(viewID string, view slack.ModalViewRequest) error {
+	_, err := c.api.UpdateView(view, "", "", viewID)
+	return err
+}
@@ -0,0 +1,102 @@
+// Package socket receives Slack events, interactions and slash commands over
+// Socket Mode, for workspaces that can't expose a public HTTP endpoint. Each
+// request is handed to the webhook handlers, so it is filtered, validated and
+// queued exactly as if it had arrived over HTTP.
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	"github.com/getalternative/adyen-slack-assistant/internal/webhook"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// Run connects to Slack and serves requests until ctx is cancelled. The
+// webhook must be initialized first.
+func Run(ctx context.Context, cfg *config.Config) error {
+	if cfg.Slack.AppToken == "" {
+		return errors.New("SLACK_APP_TOKEN is required for Socket Mode")
+	}
+
+	api := slack.New(cfg.Slack.BotToken, slack.OptionAppLevelToken(cfg.Slack.AppToken))
+	client := socketmode.New(api)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt := <-client.Events:
+				handle(ctx, client, evt)
+			}
+		}
+	}()
+
+	if err := client.RunContext(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("socket mode connection failed: %w", err)
+	}
+	return nil
+}
+
+// handle acknowledges a request with the webhook's response, which for
+// view submissions may carry validation errors
+func handle(ctx context.Context, client *socketmode.Client, evt socketmode.Event) {
+	if evt.Request != nil {
+		ctx = queue.WithTraceID(ctx, evt.Request.EnvelopeID)
+	}
+
+	var resp events.APIGatewayProxyResponse
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		fmt.Println("Connecting to Slack over Socket Mode")
+		return
+	case socketmode.EventTypeConnected:
+		fmt.Println("Connected to Slack over Socket Mode")
+		return
+	case socketmode.EventTypeConnectionError:
+		fmt.Printf("Socket Mode connection error: %v\n", evt.Data)
+		return
+	case socketmode.EventTypeEventsAPI:
+		// The payload is the same event_callback body the Events API posts
+		resp, _ = webhook.HandleEvent(ctx, string(evt.Request.Payload))
+		client.Ack(*evt.Request)
+		logFailure(evt, resp)
+		return
+	case socketmode.EventTypeInteractive:
+		payload, ok := evt.Data.(slack.InteractionCallback)
+		if !ok {
+			return
+		}
+		resp, _ = webhook.HandleInteraction(ctx, payload)
+	case socketmode.EventTypeSlashCommand:
+		cmd, ok := evt.Data.(slack.SlashCommand)
+		if !ok {
+			return
+		}
+		resp, _ = webhook.HandleCommand(ctx, cmd)
+	default:
+		return
+	}
+
+	if resp.Body != "" && resp.StatusCode == 200 {
+		client.Ack(*evt.Request, json.RawMessage(resp.Body))
+	} else {
+		client.Ack(*evt.Request)
+	}
+	logFailure(evt, resp)
+}
+
+// logFailure reports requests the webhook couldn't queue. Socket Mode has
+// no status codes, so Slack won't retry them.
+func logFailure(evt socketmode.Event, resp events.APIGatewayProxyResponse) {
+	if resp.StatusCode >= 300 {
+		fmt.Printf("Failed to handle %s request: %d %s\n", evt.Type, resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,473 @@
+// Package webhook receives Slack events and interactions over HTTP and
+// queues them for the processor.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/getalternative/adyen-slack-assistant/internal/approval"
+	"github.com/getalternative/adyen-slack-assistant/internal/config"
+	"github.com/getalternative/adyen-slack-assistant/internal/forms"
+	"github.com/getalternative/adyen-slack-assistant/internal/idempotency"
+	"github.com/getalternative/adyen-slack-assistant/internal/queue"
+	slackClient "github.com/getalternative/adyen-slack-assistant/internal/slack"
+	"github.com/slack-go/slack"
+)
+
+var (
+	cfg      *config.Config
+	slackAPI *slackClient.Client
+	q        queue.Queue
+	seen     idempotency.Store
+)
+
+// ackText is the placeholder posted when SLACK_ACK=message
+const ackText = "Working on it…"
+
+// eventTTL covers Slack's retries of an event, which stop after about an hour
+const eventTTL = 2 * time.Hour
+
+// SlackEvent represents a Slack event callback
+type SlackEvent struct {
+	Token          string          `json:"token"`
+	Challenge      string          `json:"challenge"`
+	Type           string          `json:"type"`
+	EventID        string          `json:"event_id"`
+	Event          json.RawMessage `json:"event"`
+	Authorizations []struct {
+		UserID string `json:"user_id"`
+	} `json:"authorizations"`
+}
+
+// MessageEvent for filtering
+type MessageEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	BotID       string `json:"bot_id"`
+	ChannelType string `json:"channel_type"`
+	Tab         string `json:"tab"`
+	Channel     string `json:"channel"`
+	User        string `json:"user"`
+	Ts          string `json:"ts"`
+	ThreadTs    string `json:"thread_ts"`
+	MessageTs   string `json:"message_ts"` // link_shared: the message with the links
+
+	// Edits and deletions carry the message before and after
+	Message         *ChangedMessage `json:"message"`
+	PreviousMessage *ChangedMessage `json:"previous_message"`
+}
+
+// ChangedMessage is the message inside message_changed and message_deleted events
+type ChangedMessage struct {
+	Subtype  string `json:"subtype"`
+	BotID    string `json:"bot_id"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts"`
+}
+
+// OpenFormEvent asks the processor to fill a modal the webhook has opened
+type OpenFormEvent struct {
+	User   string `json:"user"`
+	Tool   string `json:"tool"`
+	ViewID string `json:"viewId"`
+}
+
+// ApprovalEvent carries a click on an approval prompt's buttons
+type ApprovalEvent struct {
+	Action    string `json:"action"`
+	User      string `json:"user"`
+	Value     string `json:"value"`
+	Channel   string `json:"channel"`
+	MessageTs string `json:"messageTs"`
+}
+
+// CommandEvent carries a slash command
+type CommandEvent struct {
+	Command string `json:"command"`
+	Text    string `json:"text"`
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+}
+
+// SubmissionEvent carries a validated form submission
+type SubmissionEvent struct {
+	User string `json:"user"`
+	forms.Submission
+}
+
+// Init sets up the webhook to queue events on processing, dropping
+// events already recorded in events
+func Init(c *config.Config, processing queue.Queue, events idempotency.Store) {
+	cfg = c
+	slackAPI = slackClient.New(cfg)
+	q = processing
+	seen = events
+	if cfg.Slack.SigningSecret == "" {
+		fmt.Println("SLACK_SIGNING_SECRET is not set: requests can't be verified, so interactions and slash commands are refused")
+	}
+}
+
+// Handle serves a Slack request to the events, interactions or commands route
+func Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Verify Slack signature
+	if !verifySlackSignature(request) {
+		return response(401, `{"error": "invalid signature"}`)
+	}
+	ctx = queue.WithTraceID(ctx, request.Headers["X-Amzn-Trace-Id"])
+
+	// Without a signing secret nothing above was checked. Unsigned events
+	// are still accepted for local testing, but a forged click could approve
+	// a write, so buttons, modals and slash commands need a secret.
+	interaction := strings.HasSuffix(request.Path, "/interactions")
+	command := strings.HasSuffix(request.Path, "/commands")
+	if cfg.Slack.SigningSecret == "" && (interaction || command) {
+		return response(401, `{"error": "signing secret not configured"}`)
+	}
+
+	// Buttons, modals and slash commands are posted to separate URLs
+	switch {
+	case interaction:
+		form, err := url.ParseQuery(request.Body)
+		if err != nil {
+			return response(400, `{"error": "invalid request"}`)
+		}
+		var payload slack.InteractionCallback
+		if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+			return response(400, `{"error": "invalid payload"}`)
+		}
+		return HandleInteraction(ctx, payload)
+	case command:
+		form, err := url.ParseQuery(request.Body)
+		if err != nil {
+			return response(400, `{"error": "invalid request"}`)
+		}
+		return HandleCommand(ctx, slack.SlashCommand{
+			Command:   form.Get("command"),
+			Text:      form.Get("text"),
+			UserID:    form.Get("user_id"),
+			ChannelID: form.Get("channel_id"),
+			TriggerID: form.Get("trigger_id"),
+		})
+	}
+	return HandleEvent(ctx, request.Body)
+}
+
+// HandleEvent filters an Events API callback and queues the events the
+// processor handles. Requests must already be verified.
+func HandleEvent(ctx context.Context, body string) (events.APIGatewayProxyResponse, error) {
+	var slackEvent SlackEvent
+	if err := json.Unmarshal([]byte(body), &slackEvent); err != nil {
+		return response(400, `{"error": "invalid request"}`)
+	}
+
+	// URL verification challenge
+	if slackEvent.Type == "url_verification" {
+		return response(200, fmt.Sprintf(`{"challenge": "%s"}`, slackEvent.Challenge))
+	}
+
+	// Handle events
+	if slackEvent.Type == "event_callback" {
+		var msgEvent MessageEvent
+		json.Unmarshal(slackEvent.Event, &msgEvent)
+
+		// Get bot user ID
+		botUserID := ""
+		if len(slackEvent.Authorizations) > 0 {
+			botUserID = slackEvent.Authorizations[0].UserID
+		}
+
+		queueType, group := route(msgEvent, botUserID)
+		if queueType == "" {
+			return response(200, `{"ok": true}`)
+		}
+
+		// Queue for processing; Slack's retries of an event keep its ID
+		queueMsg := &queue.Message{
+			ID:        slackEvent.EventID,
+			GroupID:   group,
+			Type:      queueType,
+			Event:     slackEvent.Event,
+			BotUserID: botUserID,
+		}
+
+		// Slack retries events it thinks we missed; queue each one once
+		key := "event/" + slackEvent.EventID
+		if slackEvent.EventID != "" {
+			claimed, err := seen.Claim(ctx, key, eventTTL)
+			if err != nil {
+				fmt.Printf("Failed to check event %s: %v\n", slackEvent.EventID, err)
+			} else if !claimed {
+				return response(200, `{"ok": true}`)
+			}
+		}
+
+		// Show the question arrived; SQS delivery and starting the Adyen MCP
+		// server can take a while
+		if queueType == "app_mention" || queueType == "message" {
+			queueMsg.AckTs = acknowledge(msgEvent)
+		}
+
+		if err := send(ctx, queueMsg); err != nil {
+			if slackEvent.EventID != "" {
+				seen.Release(ctx, key)
+			}
+			// Slack will retry, which acknowledges again
+			unacknowledge(msgEvent, queueMsg.AckTs)
+			return response(500, `{"error": "queue failed"}`)
+		}
+	}
+
+	return response(200, `{"ok": true}`)
+}
+
+// route decides whether the processor handles an event, and as what. It
+// returns the queue message type and FIFO group, or an empty type to drop
+// the event.
+func route(event MessageEvent, botUserID string) (string, string) {
+	// Skip bot messages
+	if event.BotID != "" {
+		return "", ""
+	}
+
+	switch event.Type {
+	case "app_mention":
+		return event.Type, threadGroup(event.Channel, event.Ts, event.ThreadTs)
+	case "app_home_opened":
+		if event.Tab == "home" {
+			return event.Type, userGroup(event.User)
+		}
+		return "", ""
+	case "link_shared":
+		// Links still being typed can't be unfurled with chat.unfurl's
+		// channel and ts, and the bot's own links are already cards
+		if event.Channel == "COMPOSER" || event.User == botUserID {
+			return "", ""
+		}
+		return event.Type, threadGroup(event.Channel, event.MessageTs, event.ThreadTs)
+	case "message":
+	default:
+		return "", ""
+	}
+
+	// Channel messages only matter once they mention the bot, and new ones
+	// arrive as app_mention
+	dm := event.ChannelType == "im"
+	switch event.Subtype {
+	case "", "file_share", "thread_broadcast":
+		if dm {
+			return event.Type, threadGroup(event.Channel, event.Ts, event.ThreadTs)
+		}
+	case "message_changed":
+		edited, previous := event.Message, event.PreviousMessage
+		if edited == nil || previous == nil || previous.BotID != "" || previous.User == botUserID {
+			return "", ""
+		}
+		if !dm && !mentions(previous.Text, botUserID) && !mentions(edited.Text, botUserID) {
+			return "", ""
+		}
+		// Deleting a thread's parent leaves a tombstone in its place
+		if edited.Subtype == "tombstone" {
+			return "message_deleted", threadGroup(event.Channel, previous.Ts, previous.ThreadTs)
+		}
+		// Unfurls change a message without changing its text
+		if edited.Text != previous.Text {
+			return "message_changed", threadGroup(event.Channel, edited.Ts, edited.ThreadTs)
+		}
+	case "message_deleted":
+		previous := event.PreviousMessage
+		if previous != nil && previous.BotID == "" && (dm || mentions(previous.Text, botUserID)) {
+			return "message_deleted", threadGroup(event.Channel, previous.Ts, previous.ThreadTs)
+		}
+	}
+	return "", ""
+}
+
+// mentions returns true if text mentions the bot
+func mentions(text, botUserID string) bool {
+	return botUserID != "" && strings.Contains(text, "<@"+botUserID+">")
+}
+
+// acknowledge reacts to the question or posts a placeholder in its thread,
+// as SLACK_ACK says. It returns the placeholder's ts, for the processor to
+// replace with the answer. Failures are logged and never drop the event.
+func acknowledge(event MessageEvent) string {
+	switch cfg.Slack.Ack {
+	case "reaction":
+		// The same reaction the processor shows once it picks the question up
+		if err := slackAPI.AddReaction(event.Channel, event.Ts, slackClient.AckReaction); err != nil {
+			fmt.Printf("Failed to acknowledge %s: %v\n", event.Ts, err)
+		}
+	case "message":
+		threadTs := event.ThreadTs
+		if threadTs == "" {
+			threadTs = event.Ts
+		}
+		ts, err := slackAPI.PostToChannel(event.Channel, threadTs, ackText)
+		if err != nil {
+			fmt.Printf("Failed to acknowledge %s: %v\n", event.Ts, err)
+			return ""
+		}
+		return ts
+	}
+	return ""
+}
+
+// unacknowledge removes the acknowledgement of a question that couldn't be queued
+func unacknowledge(event MessageEvent, ackTs string) {
+	var err error
+	switch cfg.Slack.Ack {
+	case "reaction":
+		err = slackAPI.RemoveReaction(event.Channel, event.Ts, slackClient.AckReaction)
+	case "message":
+		if ackTs != "" {
+			err = slackAPI.DeleteMessage(event.Channel, ackTs)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to remove acknowledgement of %s: %v\n", event.Ts, err)
+	}
+}
+
+// HandleCommand queues a slash command as a question; the processor posts
+// it in the channel and answers in a thread
+func HandleCommand(ctx context.Context, cmd slack.SlashCommand) (events.APIGatewayProxyResponse, error) {
+	if strings.TrimSpace(cmd.Text) == "" {
+		body, _ := json.Marshal(map[string]string{
+			"response_type": slack.ResponseTypeEphemeral,
+			"text":          fmt.Sprintf("Ask me about a payment, e.g. `%s status of payment ABC123`.", cmd.Command),
+		})
+		return response(200, string(body))
+	}
+
+	event, _ := json.Marshal(CommandEvent{Command: cmd.Command, Text: cmd.Text, User: cmd.UserID, Channel: cmd.ChannelID})
+	if err := send(ctx, &queue.Message{Type: "slash_command", GroupID: userGroup(cmd.UserID), Event: event}); err != nil {
+		return response(500, `{"error": "queue failed"}`)
+	}
+	return response(200, "")
+}
+
+// HandleInteraction handles block actions and form submissions. Modals must
+// be opened within three seconds of the click, so the webhook opens a
+// placeholder and the processor fills it in. Submissions are validated here
+// so errors can be shown inline in the form.
+func HandleInteraction(ctx context.Context, payload slack.InteractionCallback) (events.APIGatewayProxyResponse, error) {
+	switch payload.Type {
+	case slack.InteractionTypeBlockActions:
+		return handleBlockActions(ctx, payload)
+	case slack.InteractionTypeViewSubmission:
+		if payload.View.CallbackID == forms.CallbackID {
+			return handleSubmission(ctx, payload)
+		}
+	}
+	return response(200, "")
+}
+
+func handleBlockActions(ctx context.Context, payload slack.InteractionCallback) (events.APIGatewayProxyResponse, error) {
+	for _, action := range payload.ActionCallback.BlockActions {
+		var queueMsg *queue.Message
+		switch action.ActionID {
+		case forms.OpenAction:
+			viewID, err := slackAPI.OpenView(payload.TriggerID, forms.Loading(action.Value))
+			if err != nil {
+				fmt.Printf("Failed to open form for %s: %v\n", action.Value, err)
+				return response(200, "")
+			}
+			event, _ := json.Marshal(OpenFormEvent{User: payload.User.ID, Tool: action.Value, ViewID: viewID})
+			queueMsg = &queue.Message{Type: "open_form", GroupID: userGroup(payload.User.ID), Event: event}
+		case approval.ApproveAction, approval.RejectAction:
+			event, _ := json.Marshal(ApprovalEvent{
+				Action:    action.ActionID,
+				User:      payload.User.ID,
+				Value:     action.Value,
+				Channel:   payload.Container.ChannelID,
+				MessageTs: payload.Container.MessageTs,
+			})
+			// Decisions are ordered with the rest of the requester's thread
+			group := threadGroup(payload.Container.ChannelID, payload.Container.MessageTs, payload.Container.ThreadTs)
+			queueMsg = &queue.Message{Type: "approval", GroupID: group, Event: event}
+		default:
+			continue
+		}
+		if err := send(ctx, queueMsg); err != nil {
+			return response(500, `{"error": "queue failed"}`)
+		}
+	}
+	return response(200, "")
+}
+
+// handleSubmission validates a form and queues it, or keeps the form open with errors
+func handleSubmission(ctx context.Context, payload slack.InteractionCallback) (events.APIGatewayProxyResponse, error) {
+	sub, errs := forms.Parse(payload.View)
+	if len(errs) > 0 {
+		body, _ := json.Marshal(slack.NewErrorsViewSubmissionResponse(errs))
+		return response(200, string(body))
+	}
+
+	event, _ := json.Marshal(SubmissionEvent{User: payload.User.ID, Submission: sub})
+	if err := send(ctx, &queue.Message{Type: "view_submission", GroupID: userGroup(payload.User.ID), Event: event}); err != nil {
+		return response(500, `{"error": "queue failed"}`)
+	}
+	return response(200, "")
+}
+
+func verifySlackSignature(request events.APIGatewayProxyRequest) bool {
+	secret := cfg.Slack.SigningSecret
+	if secret == "" {
+		return true
+	}
+
+	timestamp := request.Headers["X-Slack-Request-Timestamp"]
+	signature := request.Headers["X-Slack-Signature"]
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Now().Unix()-ts > 300 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("v0:%s:%s", timestamp, request.Body)))
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func send(ctx context.Context, msg *queue.Message) error {
+	if err := q.Send(ctx, msg); err != nil {
+		fmt.Printf("Failed to queue %s: %v\n", msg.Type, err)
+		return err
+	}
+	return nil
+}
+
+// threadGroup is the FIFO group of a message's thread
+func threadGroup(channel, ts, threadTs string) string {
+	if threadTs == "" {
+		threadTs = ts
+	}
+	return channel + "/" + threadTs
+}
+
+// userGroup is the FIFO group for a user's actions outside any thread
+func userGroup(userID string) string {
+	return "user/" + userID
+}
+
+func response(code int, body string) (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		StatusCode: code,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
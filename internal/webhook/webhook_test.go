@@ -0,0 +1,131 @@
+package webhook
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	const bot = "UBOT"
+	mention := "<@UBOT> refund 8815123456789012"
+	tests := []struct {
+		name      string
+		event     MessageEvent
+		wantType  string
+		wantGroup string
+	}{
+		{
+			name:      "mention",
+			event:     MessageEvent{Type: "app_mention", Channel: "C1", Ts: "1.1"},
+			wantType:  "app_mention",
+			wantGroup: "C1/1.1",
+		},
+		{
+			name:  "bot message",
+			event: MessageEvent{Type: "app_mention", BotID: "B1", Channel: "C1", Ts: "1.1"},
+		},
+		{
+			// New channel messages that mention the bot arrive as app_mention
+			name:  "channel message",
+			event: MessageEvent{Type: "message", Channel: "C1", Ts: "1.1"},
+		},
+		{
+			name:      "DM in a thread",
+			event:     MessageEvent{Type: "message", ChannelType: "im", Channel: "D1", Ts: "1.2", ThreadTs: "1.1"},
+			wantType:  "message",
+			wantGroup: "D1/1.1",
+		},
+		{
+			name: "edited question",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{User: "U1", Text: mention + " and 8815123456789013", Ts: "1.2", ThreadTs: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: mention, Ts: "1.2", ThreadTs: "1.1"}},
+			wantType:  "message_changed",
+			wantGroup: "C1/1.1",
+		},
+		{
+			// Editing the mention out still replaces the answer
+			name: "mention edited out",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{User: "U1", Text: "never mind", Ts: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: mention, Ts: "1.1"}},
+			wantType:  "message_changed",
+			wantGroup: "C1/1.1",
+		},
+		{
+			name: "edited DM",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", ChannelType: "im", Channel: "D1",
+				Message:         &ChangedMessage{User: "U1", Text: "status of 8815123456789013", Ts: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: "status of 8815123456789012", Ts: "1.1"}},
+			wantType:  "message_changed",
+			wantGroup: "D1/1.1",
+		},
+		{
+			name: "edit without the bot",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{User: "U1", Text: "lunch at 1?", Ts: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: "lunch at 12?", Ts: "1.1"}},
+		},
+		{
+			// Unfurls change a message without changing its text
+			name: "unfurl",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{User: "U1", Text: mention, Ts: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: mention, Ts: "1.1"}},
+		},
+		{
+			name: "bot edits its own reply",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{User: bot, Text: "Done <@UBOT>", Ts: "1.2", ThreadTs: "1.1"},
+				PreviousMessage: &ChangedMessage{User: bot, Text: "Working <@UBOT>", Ts: "1.2", ThreadTs: "1.1"}},
+		},
+		{
+			name: "another bot edits",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{BotID: "B2", Text: "<@UBOT> v2", Ts: "1.2"},
+				PreviousMessage: &ChangedMessage{BotID: "B2", Text: "<@UBOT> v1", Ts: "1.2"}},
+		},
+		{
+			name:  "edit without the previous message",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1", Message: &ChangedMessage{User: "U1", Text: mention, Ts: "1.1"}},
+		},
+		{
+			// Deleting a thread's parent leaves a tombstone in its place
+			name: "deleted parent",
+			event: MessageEvent{Type: "message", Subtype: "message_changed", Channel: "C1",
+				Message:         &ChangedMessage{Subtype: "tombstone", Text: "This message was deleted.", Ts: "1.1"},
+				PreviousMessage: &ChangedMessage{User: "U1", Text: mention, Ts: "1.1"}},
+			wantType:  "message_deleted",
+			wantGroup: "C1/1.1",
+		},
+		{
+			name:      "deleted question",
+			event:     MessageEvent{Type: "message", Subtype: "message_deleted", Channel: "C1", PreviousMessage: &ChangedMessage{User: "U1", Text: mention, Ts: "1.2", ThreadTs: "1.1"}},
+			wantType:  "message_deleted",
+			wantGroup: "C1/1.1",
+		},
+		{
+			name:      "deleted DM",
+			event:     MessageEvent{Type: "message", Subtype: "message_deleted", ChannelType: "im", Channel: "D1", PreviousMessage: &ChangedMessage{User: "U1", Text: "refund it", Ts: "1.1"}},
+			wantType:  "message_deleted",
+			wantGroup: "D1/1.1",
+		},
+		{
+			name:  "deleted message without the bot",
+			event: MessageEvent{Type: "message", Subtype: "message_deleted", Channel: "C1", PreviousMessage: &ChangedMessage{User: "U1", Text: "lunch?", Ts: "1.1"}},
+		},
+		{
+			name:  "deleted bot message",
+			event: MessageEvent{Type: "message", Subtype: "message_deleted", Channel: "C1", PreviousMessage: &ChangedMessage{BotID: "B1", Text: mention, Ts: "1.1"}},
+		},
+		{
+			name:  "deletion without the previous message",
+			event: MessageEvent{Type: "message", Subtype: "message_deleted", Channel: "C1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, gotGroup := route(tt.event, bot)
+			if gotType != tt.wantType || gotGroup != tt.wantGroup {
+				t.Errorf("route = %q, %q; want %q, %q", gotType, gotGroup, tt.wantType, tt.wantGroup)
+			}
+		})
+	}
+}